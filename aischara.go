@@ -5,13 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
 	"time"
 
 	"github.com/sulfur/bbio"
-	"github.com/vmihailenco/msgpack/v5"
 )
 
 // AISHeaderInfo strcture
@@ -22,11 +22,35 @@ type AISHeaderInfo struct {
 	size    int64
 }
 
-func (info *AISHeaderInfo) fromMap(m map[string]interface{}) {
-	info.name = fmt.Sprintf("%s", m["name"])
-	info.version = fmt.Sprintf("%s", m["version"])
-	info.pos = bbio.Cast.Int64(m["pos"])
-	info.size = bbio.Cast.Int64(m["size"])
+func (info *AISHeaderInfo) fromMap(m bbio.Value) (err error) {
+	name, nameErr := m.Key("name").String()
+	if nameErr != nil {
+		err = nameErr
+		return
+	}
+	info.name = name
+
+	version, verErr := m.Key("version").String()
+	if verErr != nil {
+		err = verErr
+		return
+	}
+	info.version = version
+
+	pos, posErr := m.Key("pos").Int64()
+	if posErr != nil {
+		err = posErr
+		return
+	}
+	info.pos = pos
+
+	size, sizeErr := m.Key("size").Int64()
+	if sizeErr != nil {
+		err = sizeErr
+		return
+	}
+	info.size = size
+	return
 }
 
 // AISCharaCard strcture
@@ -46,8 +70,12 @@ type AISCharaCard struct {
 	infoHeader     struct {
 		lstInfo []AISHeaderInfo
 	}
-	dataSize int64
-	data     map[string][]byte
+	dataSize  int64
+	data      map[string][]byte
+	endOffset int64
+	rawData   []byte
+	// original thumbnail of a standalone card
+	pngData []byte
 }
 
 func (sf *AISCharaCard) findInfo(name string) (info AISHeaderInfo) {
@@ -60,26 +88,43 @@ func (sf *AISCharaCard) findInfo(name string) (info AISHeaderInfo) {
 	return
 }
 
-func (sf *AISCharaCard) loadPreviewInfo() (err error) {
-	// Game Type
-	pInfo2 := sf.findInfo("Parameter2")
-	gInfo2 := sf.findInfo("GameInfo2")
-
-	if pInfo2.name == "Parameter2" && gInfo2.name == "GameInfo2" {
-		sf.gameType = "HS2"
+// detectGameType tells AIS and HS2 cards apart by the HS2-only blocks.
+// Both games write ChaFile version 1.0.0 with the same Parameter and
+// GameInfo keys, so an HS2 card stripped of both blocks reads as AIS
+func (sf *AISCharaCard) detectGameType() string {
+	// HS2 adds Parameter2 and GameInfo2, some tools keep only one of them
+	for _, key := range []string{"Parameter2", "GameInfo2"} {
+		info := sf.findInfo(key)
+		if info.name == key {
+			return gameHS2
+		}
 	}
-	sf.gameType = "AIS"
+	return gameAIS
+}
+
+func (sf *AISCharaCard) loadPreviewInfo() (err error) {
+	sf.gameType = sf.detectGameType()
 
 	// sex, name
 	paraData := sf.data["Parameter"]
-	para := map[string]interface{}{}
-	paraErr := msgpack.Unmarshal(paraData, &para)
+	para, paraErr := unmarshalMsgMap(paraData)
 	if paraErr != nil {
 		err = paraErr
 		return
 	}
-	sf.sex = bbio.Cast.Int32(para["sex"])
-	sf.fullname = fmt.Sprintf("%s", para["fullname"])
+	paraVal := bbio.Cast.Value("Parameter", para)
+
+	sex, sexErr := paraVal.Key("sex").Int32()
+	if sexErr != nil {
+		printWarning(sexErr)
+	}
+	sf.sex = sex
+
+	fullname, fnErr := paraVal.Key("fullname").String()
+	if fnErr != nil {
+		printWarning(fnErr)
+	}
+	sf.fullname = fullname
 
 	return
 }
@@ -95,7 +140,11 @@ var aisCharaMark = "【AIS_Chara】"
 
 // AISChara strcture
 type AISChara struct {
-	card *AISSceneCard
+	card  *AISSceneCard
+	thumb Thumbnailer
+	meta  *CardMeta
+	// copy the whole KKEx block of the chara into coordinate cards
+	coordExt bool
 }
 
 // NewAISChara implements for AISChara
@@ -109,6 +158,11 @@ func IsNeoV2SceneCard(reader *bbio.Reader) bool {
 	return (reader.Index([]byte(neoV2Mark)) > 0)
 }
 
+// IsAISCharaCard implements for standalone AIS and HS2 chara card
+func IsAISCharaCard(reader *bbio.Reader, pngSize int64) bool {
+	return readCardMark(reader, pngSize, 4) == aisCharaMark
+}
+
 // GenerateFileName implements for KKChara
 func (sf *AISChara) GenerateFileName(prefix string, sex int32) string {
 	time.Sleep(2 * time.Millisecond)
@@ -130,6 +184,8 @@ func (sf *AISChara) GenerateFileName(prefix string, sex int32) string {
 
 // ReadChara implements for AISChara
 func (sf *AISChara) ReadChara(reader *bbio.Reader, offset int64) (card AISCharaCard, err error) {
+	defer recoverParse(&err)
+
 	startOffset, seekErr := reader.Seek(offset, io.SeekStart)
 	if seekErr != nil {
 		err = seekErr
@@ -193,21 +249,26 @@ func (sf *AISChara) ReadChara(reader *bbio.Reader, offset int64) (card AISCharaC
 		return
 	}
 
-	headerBytes := make([]byte, headersz)
-	_, hrErr := reader.Read(headerBytes)
+	headerBytes, hrErr := readBlock(reader, int64(headersz))
 	if hrErr != nil {
 		err = hrErr
 		return
 	}
 	card.infoHeaderSize = headersz
 
-	blockHead := map[string][]map[string]interface{}{}
-	bhErr := msgpack.Unmarshal(headerBytes, &blockHead)
+	blockHead, bhErr := unmarshalMsgMap(headerBytes)
 	if bhErr != nil {
 		err = bhErr
 		return
 	}
 
+	lstInfo := bbio.Cast.Value("BlockHeader", blockHead).Key("lstInfo")
+	lstInfoArr, lstErr := lstInfo.Slice()
+	if lstErr != nil {
+		err = lstErr
+		return
+	}
+
 	datasz, dataszErr := reader.ReadInt64()
 	if dataszErr != nil {
 		err = dataszErr
@@ -218,11 +279,15 @@ func (sf *AISChara) ReadChara(reader *bbio.Reader, offset int64) (card AISCharaC
 	dataOffset := reader.Position()
 	card.data = make(map[string][]byte)
 
-	infoCount := len(blockHead["lstInfo"])
+	infoCount := len(lstInfoArr)
 	card.infoHeader.lstInfo = make([]AISHeaderInfo, infoCount)
 
 	for i := 0; i < infoCount; i++ {
-		card.infoHeader.lstInfo[i].fromMap(blockHead["lstInfo"][i])
+		infoErr := card.infoHeader.lstInfo[i].fromMap(lstInfo.Index(i))
+		if infoErr != nil {
+			err = infoErr
+			return
+		}
 		info := card.infoHeader.lstInfo[i]
 
 		sbOffset := dataOffset + info.pos
@@ -232,8 +297,7 @@ func (sf *AISChara) ReadChara(reader *bbio.Reader, offset int64) (card AISCharaC
 			return
 		}
 
-		bBytes := make([]byte, info.size)
-		_, rbErr := reader.Read(bBytes)
+		bBytes, rbErr := readBlock(reader, info.size)
 		if rbErr != nil {
 			err = rbErr
 			return
@@ -242,6 +306,9 @@ func (sf *AISChara) ReadChara(reader *bbio.Reader, offset int64) (card AISCharaC
 		card.data[info.name] = bBytes
 	}
 
+	card.endOffset = dataOffset + datasz
+	card.rawData = rawRange(reader, card.startOffset, card.endOffset)
+
 	loadErr := card.loadPreviewInfo()
 	if loadErr != nil {
 		err = loadErr
@@ -252,10 +319,13 @@ func (sf *AISChara) ReadChara(reader *bbio.Reader, offset int64) (card AISCharaC
 }
 
 // ReadScene implements for AISChara
-func (sf *AISChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
+func (sf *AISChara) ReadScene(reader *bbio.Reader, pngSize int64) (re bool, err error) {
+	defer recoverParse(&err)
+
 	_, seekErr := reader.Seek(pngSize, io.SeekStart)
 	if seekErr != nil {
-		return false, seekErr
+		err = seekErr
+		return
 	}
 
 	sf.card.pngSize = pngSize
@@ -263,6 +333,12 @@ func (sf *AISChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error)
 
 	idxs := reader.FindAll([]byte(aisCharaMark))
 	for _, v := range idxs {
+		countErr := checkCharaCount(len(sf.card.charaCards))
+		if countErr != nil {
+			err = countErr
+			return
+		}
+
 		chara, cerr := sf.ReadChara(reader, int64(v-5))
 		if cerr != nil {
 			if isDebug {
@@ -277,15 +353,38 @@ func (sf *AISChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error)
 		}
 	}
 
-	return len(sf.card.charaCards) > 0, nil
+	re = len(sf.card.charaCards) > 0
+	return
+}
+
+// ReadCard implements for AISChara, reads a standalone chara card
+func (sf *AISChara) ReadCard(reader *bbio.Reader, pngSize int64) (re bool, err error) {
+	defer recoverParse(&err)
+
+	sf.card.pngSize = pngSize
+	sf.card.charaCards = make(map[string]AISCharaCard)
+
+	chara, cErr := sf.ReadChara(reader, pngSize)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	chara.pngSize = pngSize
+	chara.pngData = rawRange(reader, 0, pngSize)
+
+	charFileName := sf.GenerateFileName(chara.gameType, chara.sex)
+	sf.card.charaCards[charFileName] = chara
+
+	re = true
+	return
 }
 
 // WriteChara implements for AISChara
 func (sf *AISChara) WriteChara(card AISCharaCard, w io.Writer) (re bool, err error) {
 	re = false
-	writer := bbio.NewWriter(w)
+	writer := bbio.NewWriterBuffer()
 
-	pngBytes, pngErr := createPng(252, 352, int(card.sex))
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, card.pngData, ThumbInfo{game: card.gameType, sex: card.sex, name: card.fullname})
 	if pngErr != nil {
 		err = pngErr
 		return
@@ -333,79 +432,31 @@ func (sf *AISChara) WriteChara(card AISCharaCard, w io.Writer) (re bool, err err
 		return
 	}
 
-	keyArr := []string{"Custom", "Coordinate", "Parameter", "GameInfo", "Status", "Parameter2", "GameInfo2"}
-	keyExtra := "KKEx"
-
 	infoCount := len(card.infoHeader.lstInfo)
-	lstInfo := make([]map[string]interface{}, infoCount)
-	lstData := make(map[int][]byte)
+	lstInfo := make([]msgBlockInfo, infoCount)
+	lstPos := make([]int64, infoCount)
 
-	var i, d int
-	var pos, datasz int64
-	d = 0
-	pos = int64(0)
-
-	infoEx := card.findInfo(keyExtra)
-	if infoEx.name == keyExtra {
-		i++
+	for i, info := range card.infoHeader.lstInfo {
+		lstInfo[i] = msgBlockInfo{Name: info.name, Version: info.version}
+		lstPos[i] = info.pos
 	}
 
-	for _, key := range keyArr {
-		info := card.findInfo(key)
-		if info.name == key {
-			lstData[d] = card.data[key]
-			size := int64(len(lstData[d]))
-
-			infoMap := map[string]interface{}{
-				"name":    fmt.Sprintf(info.name),
-				"version": fmt.Sprintf("%s", info.version),
-				"pos":     pos,
-				"size":    size,
-			}
-			lstInfo[i] = infoMap
-
-			pos += size
-			datasz += size
-
-			d++
-			i++
-		}
-	}
-
-	if infoEx.name == keyExtra {
-		lstData[d] = card.data[keyExtra]
-		size := int64(len(lstData[d]))
-
-		infoMap := map[string]interface{}{
-			"name":    fmt.Sprintf(infoEx.name),
-			"version": fmt.Sprintf("%s", infoEx.version),
-			"pos":     pos,
-			"size":    size,
-		}
-		lstInfo[0] = infoMap
-
-		d++
+	var pos int64
+	order := blockDataOrder(lstPos)
+	for _, i := range order {
+		size := int64(len(card.data[lstInfo[i].Name]))
+		lstInfo[i].Pos = pos
+		lstInfo[i].Size = size
 		pos += size
-		datasz += size
-	}
-
-	blockHead := map[string][]map[string]interface{}{
-		"lstInfo": lstInfo,
 	}
 
-	// j, jErr := json.Marshal(&blockHead)
-	// if jErr == nil {
-	// 	fmt.Println(string(j))
-	// }
-
-	head, msgErr := msgpack.Marshal(&blockHead)
+	head, msgErr := marshalBlockHeader(lstInfo)
 	if msgErr != nil {
 		err = msgErr
 		return
 	}
 
-	headsz := len(head)
-	headszErr := writer.WriteInt(int32(headsz))
+	headsz, headszErr := writer.ReserveInt()
 	if headszErr != nil {
 		err = headszErr
 		return
@@ -417,23 +468,35 @@ func (sf *AISChara) WriteChara(card AISCharaCard, w io.Writer) (re bool, err err
 		return
 	}
 
-	dataszErr := writer.WriteLong(datasz)
+	hpErr := writer.PatchLength(headsz)
+	if hpErr != nil {
+		err = hpErr
+		return
+	}
+
+	datasz, dataszErr := writer.ReserveLong()
 	if dataszErr != nil {
 		err = dataszErr
 		return
 	}
 
-	for j := 0; j < d; j++ {
-		_, sErr := writer.Write(lstData[j])
+	for _, i := range order {
+		_, sErr := writer.Write(card.data[lstInfo[i].Name])
 		if sErr != nil {
 			err = sErr
 			return
 		}
 	}
 
-	fluErr := writer.Flush()
-	if fluErr != nil {
-		err = fluErr
+	dpErr := writer.PatchLength(datasz)
+	if dpErr != nil {
+		err = dpErr
+		return
+	}
+
+	_, wtErr := writer.WriteTo(w)
+	if wtErr != nil {
+		err = wtErr
 		return
 	}
 
@@ -441,8 +504,83 @@ func (sf *AISChara) WriteChara(card AISCharaCard, w io.Writer) (re bool, err err
 	return
 }
 
+// WriteCharaRaw implements for AISChara, copies the original chara bytes
+func (sf *AISChara) WriteCharaRaw(card AISCharaCard, w io.Writer) (re bool, err error) {
+	re = false
+	if card.rawData == nil {
+		err = errors.New("Raw chara data not available")
+		return
+	}
+
+	writer := bbio.NewWriterBuffer()
+
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, card.pngData, ThumbInfo{game: card.gameType, sex: card.sex, name: card.fullname})
+	if pngErr != nil {
+		err = pngErr
+		return
+	}
+
+	_, pwErr := writer.Write(pngBytes)
+	if pwErr != nil {
+		err = pwErr
+		return
+	}
+
+	_, rwErr := writer.Write(card.rawData)
+	if rwErr != nil {
+		err = rwErr
+		return
+	}
+
+	_, wtErr := writer.WriteTo(w)
+	if wtErr != nil {
+		err = wtErr
+		return
+	}
+
+	re = true
+	return
+}
+
+// VerifyCharaFile implements for AISChara, re-reads a written card and
+// compares its blocks with the scene ones
+func (sf *AISChara) VerifyCharaFile(card AISCharaCard, filePath string) (err error) {
+	fileBytes, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	reader := bbio.NewReaderBytes(fileBytes)
+	written, wErr := sf.ReadChara(reader, getPngSize(reader))
+	if wErr != nil {
+		err = wErr
+		return
+	}
+
+	if len(written.infoHeader.lstInfo) != len(card.infoHeader.lstInfo) {
+		err = fmt.Errorf("Block count differs after write (%d, want %d)", len(written.infoHeader.lstInfo), len(card.infoHeader.lstInfo))
+		return
+	}
+
+	for i, info := range card.infoHeader.lstInfo {
+		wInfo := written.infoHeader.lstInfo[i]
+		if wInfo.name != info.name || wInfo.version != info.version {
+			err = fmt.Errorf("Block header %d differs after write (%s %v, want %s %v)", i, wInfo.name, wInfo.version, info.name, info.version)
+			return
+		}
+
+		cErr := compareBlockData(info.name, card.data[info.name], written.data[info.name])
+		if cErr != nil {
+			err = cErr
+			return
+		}
+	}
+	return
+}
+
 // WriteCharaFile implements for AISChara
-func (sf *AISChara) WriteCharaFile(card AISCharaCard, filePath string) (re bool, err error) {
+func (sf *AISChara) WriteCharaFile(card AISCharaCard, filePath string, opts ExtractOptions) (re bool, err error) {
 	re = false
 	f, cErr := os.Create(filePath)
 	if cErr != nil {
@@ -452,21 +590,24 @@ func (sf *AISChara) WriteCharaFile(card AISCharaCard, filePath string) (re bool,
 	defer f.Close()
 
 	writer := bufio.NewWriter(f)
+	if opts.raw {
+		return sf.WriteCharaRaw(card, writer)
+	}
 	return sf.WriteChara(card, writer)
 }
 
 // ExtractChara implements for AISChara
-func (sf *AISChara) ExtractChara(currDir string, flag int) (total int, write int, err error) {
-	for k, v := range sf.card.charaCards {
-		total++
+func (sf *AISChara) ExtractChara(currDir string, opts ExtractOptions, report *ExtractReport) (err error) {
+	sf.thumb = opts.thumb
+	sf.meta = opts.cardMeta
 
-		// Not male
-		if flag == 1 && v.sex != 0 {
+	for k, v := range sf.card.charaCards {
+		if opts.skipGame(v.gameType) {
 			continue
 		}
+		report.found(v.gameType)
 
-		// Not female
-		if flag == 2 && v.sex != 1 {
+		if opts.skipSex(v.sex) {
 			continue
 		}
 
@@ -483,11 +624,19 @@ func (sf *AISChara) ExtractChara(currDir string, flag int) (total int, write int
 			saveFilePath = path.Join(currDir, fmt.Sprintf("%s-%d.png", k, c))
 		}
 
-		_, saveErr := sf.WriteCharaFile(v, saveFilePath)
+		_, saveErr := sf.WriteCharaFile(v, saveFilePath, opts)
 		if saveErr != nil {
 			printError(saveErr)
-		} else {
-			write++
+			continue
+		}
+		report.wrote(v.gameType)
+
+		if opts.verify {
+			vErr := sf.VerifyCharaFile(v, saveFilePath)
+			if vErr != nil {
+				printError(fmt.Errorf("%s: %v", saveFilePath, vErr))
+				report.verifyFailed(v.gameType)
+			}
 		}
 	}
 	return
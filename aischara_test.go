@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sulfur/bbio"
+)
+
+func TestAISDetectGameType(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		blocks  []string
+		want    string
+	}{
+		{"AIS", "1.0.0", nil, gameAIS},
+		{"HS2", "1.0.0", []string{"Parameter2", "GameInfo2"}, gameHS2},
+		{"HS2 without GameInfo2", "1.0.0", []string{"Parameter2"}, gameHS2},
+		{"HS2 without Parameter2", "1.0.0", []string{"GameInfo2"}, gameHS2},
+		{"version is not used", "9.9.9", nil, gameAIS},
+		{"version is not used with HS2 blocks", "9.9.9", []string{"Parameter2"}, gameHS2},
+	}
+
+	for _, tt := range tests {
+		card := testAISCard(t)
+		card.loadVersion = tt.version
+		for _, name := range tt.blocks {
+			card.infoHeader.lstInfo = append(card.infoHeader.lstInfo, AISHeaderInfo{name: name, version: "0.0.0"})
+			card.data[name] = testMsgMap(t, "version", "0.0.0")
+		}
+		if got := card.detectGameType(); got != tt.want {
+			t.Errorf("%s: detectGameType = %s, want %s", tt.name, got, tt.want)
+		}
+
+		// the game survives a write and read back
+		var b bytes.Buffer
+		if _, err := NewAISChara().WriteChara(card, &b); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		h := NewAISChara()
+		reader := bbio.NewReaderBytes(b.Bytes())
+		if _, err := h.ReadCard(reader, getPngSize(reader)); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(h.card.charaCards) != 1 {
+			t.Fatalf("%s: read %d charas", tt.name, len(h.card.charaCards))
+		}
+		for _, read := range h.card.charaCards {
+			if read.gameType != tt.want {
+				t.Errorf("%s: read back as %s, want %s", tt.name, read.gameType, tt.want)
+			}
+		}
+	}
+}
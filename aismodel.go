@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// AISParameter strcture
+type AISParameter struct {
+	msgRaw
+	Version     string  `msgpack:"version"`
+	Sex         int32   `msgpack:"sex"`
+	Fullname    string  `msgpack:"fullname"`
+	Personality int32   `msgpack:"personality"`
+	BirthMonth  int32   `msgpack:"birthMonth"`
+	BirthDay    int32   `msgpack:"birthDay"`
+	VoiceRate   float32 `msgpack:"voiceRate"`
+	HsWish      []int32 `msgpack:"hsWish"`
+	Futanari    bool    `msgpack:"futanari"`
+}
+
+// DecodeMsgpack implements for AISParameter
+func (m *AISParameter) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISParameter
+func (m *AISParameter) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISGameInfo strcture
+type AISGameInfo struct {
+	msgRaw
+	Version          string    `msgpack:"version"`
+	GameRegistration bool      `msgpack:"gameRegistration"`
+	FlavorState      msgIntMap `msgpack:"flavorState"`
+	TotalFlavor      int32     `msgpack:"totalFlavor"`
+	DesireDefVal     msgIntMap `msgpack:"desireDefVal"`
+	DesireBuffVal    msgIntMap `msgpack:"desireBuffVal"`
+	Phase            int32     `msgpack:"phase"`
+	NormalSkill      msgIntMap `msgpack:"normalSkill"`
+	HSkill           msgIntMap `msgpack:"hSkill"`
+	FavoritePlace    int32     `msgpack:"favoritePlace"`
+	Lifestyle        int32     `msgpack:"lifestyle"`
+	Morality         int32     `msgpack:"morality"`
+	Motivation       int32     `msgpack:"motivation"`
+	Immoral          int32     `msgpack:"immoral"`
+}
+
+// DecodeMsgpack implements for AISGameInfo
+func (m *AISGameInfo) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISGameInfo
+func (m *AISGameInfo) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISStatus strcture
+type AISStatus struct {
+	msgRaw
+	Version           string  `msgpack:"version"`
+	ClothesState      []byte  `msgpack:"clothesState"`
+	ShowAccessory     []bool  `msgpack:"showAccessory"`
+	EyebrowPtn        int32   `msgpack:"eyebrowPtn"`
+	EyebrowOpenMax    float32 `msgpack:"eyebrowOpenMax"`
+	EyesPtn           int32   `msgpack:"eyesPtn"`
+	EyesOpenMax       float32 `msgpack:"eyesOpenMax"`
+	EyesBlink         bool    `msgpack:"eyesBlink"`
+	MouthPtn          int32   `msgpack:"mouthPtn"`
+	MouthOpenMax      float32 `msgpack:"mouthOpenMax"`
+	MouthFixed        bool    `msgpack:"mouthFixed"`
+	TongueState       int32   `msgpack:"tongueState"`
+	EyesLookPtn       int32   `msgpack:"eyesLookPtn"`
+	NeckLookPtn       int32   `msgpack:"neckLookPtn"`
+	NipStandRate      float32 `msgpack:"nipStandRate"`
+	SkinTuyaRate      float32 `msgpack:"skinTuyaRate"`
+	HohoAkaRate       float32 `msgpack:"hohoAkaRate"`
+	TearsRate         float32 `msgpack:"tearsRate"`
+	HideEyesHighlight bool    `msgpack:"hideEyesHighlight"`
+	VisibleSonAlways  bool    `msgpack:"visibleSonAlways"`
+}
+
+// DecodeMsgpack implements for AISStatus
+func (m *AISStatus) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISStatus
+func (m *AISStatus) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISParameter2 strcture
+type AISParameter2 struct {
+	msgRaw
+	Version     string  `msgpack:"version"`
+	Personality int32   `msgpack:"personality"`
+	VoiceRate   float32 `msgpack:"voiceRate"`
+	Trait       int32   `msgpack:"trait"`
+	Mind        int32   `msgpack:"mind"`
+	HAttribute  int32   `msgpack:"hAttribute"`
+}
+
+// DecodeMsgpack implements for AISParameter2
+func (m *AISParameter2) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISParameter2
+func (m *AISParameter2) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISGameInfo2 strcture
+type AISGameInfo2 struct {
+	msgRaw
+	Version           string  `msgpack:"version"`
+	Favor             int32   `msgpack:"Favor"`
+	Enjoyment         int32   `msgpack:"Enjoyment"`
+	Aversion          int32   `msgpack:"Aversion"`
+	Slavery           int32   `msgpack:"Slavery"`
+	Broken            int32   `msgpack:"Broken"`
+	Dependence        int32   `msgpack:"Dependence"`
+	Dirty             int32   `msgpack:"Dirty"`
+	Tiredness         int32   `msgpack:"Tiredness"`
+	Toilet            int32   `msgpack:"Toilet"`
+	Libido            int32   `msgpack:"Libido"`
+	Alertness         int32   `msgpack:"alertness"`
+	NowState          int32   `msgpack:"nowState"`
+	NowDrawState      int32   `msgpack:"nowDrawState"`
+	LockNowState      bool    `msgpack:"lockNowState"`
+	LockBroken        bool    `msgpack:"lockBroken"`
+	LockDependence    bool    `msgpack:"lockDependence"`
+	HCount            int32   `msgpack:"hCount"`
+	Map               []int32 `msgpack:"map"`
+	ArriveRoom        bool    `msgpack:"arriveRoom"`
+	ArriveRoomHAfter  bool    `msgpack:"arriveRoomHAfter"`
+	ResistH           int32   `msgpack:"resistH"`
+	ResistPain        int32   `msgpack:"resistPain"`
+	ResistAnal        int32   `msgpack:"resistAnal"`
+	UsedItem          int32   `msgpack:"usedItem"`
+	IsChangeParameter bool    `msgpack:"isChangeParameter"`
+	IsConcierge       bool    `msgpack:"isConcierge"`
+}
+
+// DecodeMsgpack implements for AISGameInfo2
+func (m *AISGameInfo2) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISGameInfo2
+func (m *AISGameInfo2) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISFace strcture
+type AISFace struct {
+	msgRaw
+	Version        string    `msgpack:"version"`
+	ShapeValueFace []float32 `msgpack:"shapeValueFace"`
+	HeadID         int32     `msgpack:"headId"`
+	SkinID         int32     `msgpack:"skinId"`
+	DetailID       int32     `msgpack:"detailId"`
+	DetailPower    float32   `msgpack:"detailPower"`
+	EyebrowID      int32     `msgpack:"eyebrowId"`
+	EyebrowColor   []float32 `msgpack:"eyebrowColor"`
+	NoseID         int32     `msgpack:"noseId"`
+	HlID           int32     `msgpack:"hlId"`
+	EyelashesID    int32     `msgpack:"eyelashesId"`
+	MoleID         int32     `msgpack:"moleId"`
+	MoleColor      []float32 `msgpack:"moleColor"`
+	MoleLayout     []float32 `msgpack:"moleLayout"`
+	LipID          int32     `msgpack:"lipId"`
+	LipColor       []float32 `msgpack:"lipColor"`
+}
+
+// DecodeMsgpack implements for AISFace
+func (m *AISFace) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISFace
+func (m *AISFace) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISBody strcture
+type AISBody struct {
+	msgRaw
+	Version           string    `msgpack:"version"`
+	ShapeValueBody    []float32 `msgpack:"shapeValueBody"`
+	BustSoftness      float32   `msgpack:"bustSoftness"`
+	BustWeight        float32   `msgpack:"bustWeight"`
+	SkinID            int32     `msgpack:"skinId"`
+	DetailID          int32     `msgpack:"detailId"`
+	DetailPower       float32   `msgpack:"detailPower"`
+	SkinColor         []float32 `msgpack:"skinColor"`
+	SkinGlossPower    float32   `msgpack:"skinGlossPower"`
+	SkinMetallicPower float32   `msgpack:"skinMetallicPower"`
+	SunburnID         int32     `msgpack:"sunburnId"`
+	SunburnColor      []float32 `msgpack:"sunburnColor"`
+	NipID             int32     `msgpack:"nipId"`
+	NipColor          []float32 `msgpack:"nipColor"`
+	AreolaSize        float32   `msgpack:"areolaSize"`
+	UnderhairID       int32     `msgpack:"underhairId"`
+	UnderhairColor    []float32 `msgpack:"underhairColor"`
+	NailColor         []float32 `msgpack:"nailColor"`
+}
+
+// DecodeMsgpack implements for AISBody
+func (m *AISBody) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISBody
+func (m *AISBody) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISHairParts strcture
+type AISHairParts struct {
+	msgRaw
+	ID         int32     `msgpack:"id"`
+	BaseColor  []float32 `msgpack:"baseColor"`
+	TopColor   []float32 `msgpack:"topColor"`
+	UnderColor []float32 `msgpack:"underColor"`
+	Specular   []float32 `msgpack:"specular"`
+	Metallic   float32   `msgpack:"metallic"`
+	Smoothness float32   `msgpack:"smoothness"`
+	MeshType   int32     `msgpack:"meshType"`
+	MeshColor  []float32 `msgpack:"meshColor"`
+	MeshLayout []float32 `msgpack:"meshLayout"`
+}
+
+// DecodeMsgpack implements for AISHairParts
+func (m *AISHairParts) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISHairParts
+func (m *AISHairParts) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISHair strcture
+type AISHair struct {
+	msgRaw
+	Version      string         `msgpack:"version"`
+	SameSetting  bool           `msgpack:"sameSetting"`
+	AutoSetting  bool           `msgpack:"autoSetting"`
+	CtrlTogether bool           `msgpack:"ctrlTogether"`
+	Parts        []AISHairParts `msgpack:"parts"`
+	Kind         int32          `msgpack:"kind"`
+	ShaderType   int32          `msgpack:"shaderType"`
+}
+
+// DecodeMsgpack implements for AISHair
+func (m *AISHair) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISHair
+func (m *AISHair) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISCustom strcture
+type AISCustom struct {
+	Face  AISFace
+	Body  AISBody
+	Hair  AISHair
+	extra []byte
+}
+
+func parseAISCustom(data []byte) (custom AISCustom, err error) {
+	var off int
+	models := []msgModel{&custom.Face, &custom.Body, &custom.Hair}
+	for _, m := range models {
+		block, bErr := readSizedBlock(data, &off)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+
+		mErr := unmarshalModel(block, m)
+		if mErr != nil {
+			err = mErr
+			return
+		}
+	}
+	custom.extra = data[off:]
+	return
+}
+
+func (custom *AISCustom) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	models := []msgModel{&custom.Face, &custom.Body, &custom.Hair}
+	for _, m := range models {
+		block, mErr := marshalModel(m)
+		if mErr != nil {
+			return nil, mErr
+		}
+		writeSizedBlock(&buf, block)
+	}
+	buf.Write(custom.extra)
+	return buf.Bytes(), nil
+}
+
+// AISClothesColor strcture
+type AISClothesColor struct {
+	msgRaw
+	BaseColor       []float32 `msgpack:"baseColor"`
+	GlossPower      float32   `msgpack:"glossPower"`
+	MetallicPower   float32   `msgpack:"metallicPower"`
+	SmoothnessPower float32   `msgpack:"smoothnessPower"`
+}
+
+// DecodeMsgpack implements for AISClothesColor
+func (m *AISClothesColor) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISClothesColor
+func (m *AISClothesColor) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISClothesParts strcture
+type AISClothesParts struct {
+	msgRaw
+	ID        int32             `msgpack:"id"`
+	ColorInfo []AISClothesColor `msgpack:"colorInfo"`
+	BreakRate float32           `msgpack:"breakRate"`
+	HideOpt   []bool            `msgpack:"hideOpt"`
+}
+
+// DecodeMsgpack implements for AISClothesParts
+func (m *AISClothesParts) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISClothesParts
+func (m *AISClothesParts) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISClothes strcture
+type AISClothes struct {
+	msgRaw
+	Version string            `msgpack:"version"`
+	Parts   []AISClothesParts `msgpack:"parts"`
+}
+
+// DecodeMsgpack implements for AISClothes
+func (m *AISClothes) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISClothes
+func (m *AISClothes) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISAccessoryParts strcture
+type AISAccessoryParts struct {
+	msgRaw
+	Type         int32             `msgpack:"type"`
+	ID           int32             `msgpack:"id"`
+	ParentKey    string            `msgpack:"parentKey"`
+	ColorInfo    []AISClothesColor `msgpack:"colorInfo"`
+	HideCategory int32             `msgpack:"hideCategory"`
+	HideTiming   int32             `msgpack:"hideTiming"`
+	NoShake      bool              `msgpack:"noShake"`
+}
+
+// DecodeMsgpack implements for AISAccessoryParts
+func (m *AISAccessoryParts) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISAccessoryParts
+func (m *AISAccessoryParts) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISAccessory strcture
+type AISAccessory struct {
+	msgRaw
+	Version string              `msgpack:"version"`
+	Parts   []AISAccessoryParts `msgpack:"parts"`
+}
+
+// DecodeMsgpack implements for AISAccessory
+func (m *AISAccessory) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for AISAccessory
+func (m *AISAccessory) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// AISCoordinate strcture
+type AISCoordinate struct {
+	Clothes   AISClothes
+	Accessory AISAccessory
+	extra     []byte
+}
+
+func parseAISCoordinate(data []byte) (coord AISCoordinate, err error) {
+	var off int
+	models := []msgModel{&coord.Clothes, &coord.Accessory}
+	for _, m := range models {
+		block, bErr := readSizedBlock(data, &off)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+
+		mErr := unmarshalModel(block, m)
+		if mErr != nil {
+			err = mErr
+			return
+		}
+	}
+	coord.extra = data[off:]
+	return
+}
+
+func (coord *AISCoordinate) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	models := []msgModel{&coord.Clothes, &coord.Accessory}
+	for _, m := range models {
+		block, mErr := marshalModel(m)
+		if mErr != nil {
+			return nil, mErr
+		}
+		writeSizedBlock(&buf, block)
+	}
+	buf.Write(coord.extra)
+	return buf.Bytes(), nil
+}
+
+// Parameter implements for AISCharaCard
+func (sf *AISCharaCard) Parameter() (para AISParameter, err error) {
+	err = loadModel(sf.data, "Parameter", &para)
+	return
+}
+
+// SetParameter implements for AISCharaCard
+func (sf *AISCharaCard) SetParameter(para *AISParameter) error {
+	return storeModel(sf.data, "Parameter", para)
+}
+
+// GameInfo implements for AISCharaCard
+func (sf *AISCharaCard) GameInfo() (info AISGameInfo, err error) {
+	err = loadModel(sf.data, "GameInfo", &info)
+	return
+}
+
+// SetGameInfo implements for AISCharaCard
+func (sf *AISCharaCard) SetGameInfo(info *AISGameInfo) error {
+	return storeModel(sf.data, "GameInfo", info)
+}
+
+// Status implements for AISCharaCard
+func (sf *AISCharaCard) Status() (status AISStatus, err error) {
+	err = loadModel(sf.data, "Status", &status)
+	return
+}
+
+// SetStatus implements for AISCharaCard
+func (sf *AISCharaCard) SetStatus(status *AISStatus) error {
+	return storeModel(sf.data, "Status", status)
+}
+
+// Parameter2 implements for AISCharaCard, HS2 only
+func (sf *AISCharaCard) Parameter2() (para AISParameter2, err error) {
+	err = loadModel(sf.data, "Parameter2", &para)
+	return
+}
+
+// SetParameter2 implements for AISCharaCard
+func (sf *AISCharaCard) SetParameter2(para *AISParameter2) error {
+	return storeModel(sf.data, "Parameter2", para)
+}
+
+// GameInfo2 implements for AISCharaCard, HS2 only
+func (sf *AISCharaCard) GameInfo2() (info AISGameInfo2, err error) {
+	err = loadModel(sf.data, "GameInfo2", &info)
+	return
+}
+
+// SetGameInfo2 implements for AISCharaCard
+func (sf *AISCharaCard) SetGameInfo2(info *AISGameInfo2) error {
+	return storeModel(sf.data, "GameInfo2", info)
+}
+
+// Custom implements for AISCharaCard
+func (sf *AISCharaCard) Custom() (AISCustom, error) {
+	return parseAISCustom(sf.data["Custom"])
+}
+
+// SetCustom implements for AISCharaCard
+func (sf *AISCharaCard) SetCustom(custom *AISCustom) (err error) {
+	data, mErr := custom.bytes()
+	if mErr != nil {
+		err = mErr
+		return
+	}
+	sf.data["Custom"] = data
+	return
+}
+
+// Coordinate implements for AISCharaCard
+func (sf *AISCharaCard) Coordinate() (AISCoordinate, error) {
+	return parseAISCoordinate(sf.data["Coordinate"])
+}
+
+// SetCoordinate implements for AISCharaCard
+func (sf *AISCharaCard) SetCoordinate(coord *AISCoordinate) (err error) {
+	data, mErr := coord.bytes()
+	if mErr != nil {
+		err = mErr
+		return
+	}
+	sf.data["Coordinate"] = data
+	return
+}
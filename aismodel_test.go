@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func testAISGameInfo(t testing.TB) []byte {
+	// keys out of order, the way a Dictionary is serialized
+	flavor := msgpack.RawMessage{0x83, 5, 0xd2, 0, 0, 0, 1, 1, 2, 3, 3}
+	return testMsgMap(t,
+		"version", "1.0.0",
+		"flavorState", flavor,
+		"totalFlavor", testMsgInt32(6),
+		"normalSkill", msgpack.RawMessage{0x82, 4, 0xff, 0, 1},
+		"futureGame", "x",
+	)
+}
+
+func TestAISModelRoundTrip(t *testing.T) {
+	card := testAISCard(t)
+	card.data["GameInfo"] = testAISGameInfo(t)
+	card.data["Custom"] = append(testSizedBlocks(
+		testMsgMap(t, "version", "0.0.1", "headId", testMsgInt32(2), "futureFace", []interface{}{}),
+		testMsgMap(t, "version", "0.0.0", "skinId", testMsgInt32(1), "detailPower", testMsgFloat32(t, 0.3)),
+		testMsgMap(t, "version", "0.0.1", "sameSetting", true),
+	), 1)
+	card.data["Coordinate"] = testSizedBlocks(
+		testMsgMap(t, "version", "0.0.0", "parts", []interface{}{
+			msgpack.RawMessage(testMsgMap(t, "id", testMsgInt32(9), "breakRate", testMsgFloat32(t, 0.1))),
+		}),
+		testMsgMap(t, "version", "0.0.0", "parts", []interface{}{}),
+	)
+	orig := make(map[string][]byte)
+	for k, v := range card.data {
+		orig[k] = append([]byte{}, v...)
+	}
+
+	para, pErr := card.Parameter()
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	info, gErr := card.GameInfo()
+	if gErr != nil {
+		t.Fatal(gErr)
+	}
+	if info.FlavorState[5] != 1 || info.FlavorState[1] != 2 || info.NormalSkill[4] != -1 {
+		t.Errorf("game info read as %+v", info)
+	}
+	status, sErr := card.Status()
+	if sErr != nil {
+		t.Fatal(sErr)
+	}
+	custom, cErr := card.Custom()
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	coord, oErr := card.Coordinate()
+	if oErr != nil {
+		t.Fatal(oErr)
+	}
+	if coord.Clothes.Parts[0].ID != 9 {
+		t.Errorf("coordinate read as %+v", coord)
+	}
+
+	for _, err := range []error{
+		card.SetParameter(&para),
+		card.SetGameInfo(&info),
+		card.SetStatus(&status),
+		card.SetCustom(&custom),
+		card.SetCoordinate(&coord),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range orig {
+		if !bytes.Equal(card.data[name], want) {
+			t.Errorf("%s block changed\n got % x\nwant % x", name, card.data[name], want)
+		}
+	}
+}
+
+func TestAISGameInfoSortedMaps(t *testing.T) {
+	var info AISGameInfo
+	if err := unmarshalModel(testAISGameInfo(t), &info); err != nil {
+		t.Fatal(err)
+	}
+	info.FlavorState[0] = 4
+	info.HSkill = msgIntMap{2: 1, 0: 3, 1: 2}
+
+	want := testMsgMap(t,
+		"version", "1.0.0",
+		"flavorState", msgpack.RawMessage{0x84, 0, 4, 1, 2, 3, 3, 5, 1},
+		"totalFlavor", testMsgInt32(6),
+		"normalSkill", msgpack.RawMessage{0x82, 4, 0xff, 0, 1},
+		"futureGame", "x",
+		"hSkill", msgpack.RawMessage{0x83, 0, 3, 1, 2, 2, 1},
+	)
+	for i := 0; i < 20; i++ {
+		out, err := marshalModel(&info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, want) {
+			t.Fatalf("got % x\nwant % x", out, want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"sort"
 )
@@ -83,6 +84,9 @@ func read7BitEncodedInt(r *bytes.Reader) (int, int, error) {
 	return count, n, nil
 }
 
+// errNegativeCount is returned when a read is asked for a negative number of bytes.
+var errNegativeCount = errors.New("bbio.Reader: negative count")
+
 // Reader implements of the Reader
 type Reader struct {
 	s   []byte
@@ -217,6 +221,13 @@ func (br *Reader) ReadAt(b []byte, off int64) (n int, err error) {
 	return
 }
 
+// readFull reads exactly len(b) bytes, a short read is reported as io.ErrUnexpectedEOF.
+func (br *Reader) readFull(b []byte) (n int, err error) {
+	n, err = io.ReadFull(br.r, b)
+	br.pos += int64(n)
+	return
+}
+
 // Read implements the io.Reader interface.
 func (br *Reader) Read(b []byte) (n int, err error) {
 	n, err = br.r.Read(b)
@@ -251,13 +262,18 @@ func (br *Reader) ReadByte() (byte, error) {
 
 // ReadBytes implements the Reader
 func (br *Reader) ReadBytes(c int) ([]byte, error) {
+	if c < 0 {
+		return nil, errNegativeCount
+	}
+	if c > br.r.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+
 	b := make([]byte, c)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return nil, err
 	}
-
-	br.pos += int64(n)
 	return b, nil
 }
 
@@ -276,60 +292,55 @@ func (br *Reader) ReadChar() (ch rune, err error) {
 // ReadInt16 implements of the Reader
 func (br *Reader) ReadInt16() (int16, error) {
 	b := make([]byte, 2)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return 0, err
 	}
 
-	br.pos += int64(n)
 	return int16(b[0]) | int16(b[1])<<8, nil
 }
 
 // ReadUInt16 implements of the Reader
 func (br *Reader) ReadUInt16() (uint16, error) {
 	b := make([]byte, 2)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return 0, err
 	}
 
-	br.pos += int64(n)
 	return uint16(b[0]) | uint16(b[1])<<8, nil
 }
 
 // ReadInt32 implements of the Reader
 func (br *Reader) ReadInt32() (int32, error) {
 	b := make([]byte, 4)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return 0, err
 	}
 
-	br.pos += int64(n)
 	return int32(b[0]) | int32(b[1])<<8 | int32(b[2])<<16 | int32(b[3])<<24, nil
 }
 
 // ReadUInt32 implements of the Reader
 func (br *Reader) ReadUInt32() (uint32, error) {
 	b := make([]byte, 4)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return 0, err
 	}
 
-	br.pos += int64(n)
 	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24, nil
 }
 
 // ReadInt64 implements of the Reader
 func (br *Reader) ReadInt64() (int64, error) {
 	b := make([]byte, 8)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return 0, err
 	}
 
-	br.pos += int64(n)
 	lo := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 	hi := uint32(b[4]) | uint32(b[5])<<8 | uint32(b[6])<<16 | uint32(b[7])<<24
 	return int64(hi)<<32 | int64(lo), nil
@@ -338,12 +349,11 @@ func (br *Reader) ReadInt64() (int64, error) {
 // ReadUInt64 implements of the Reader
 func (br *Reader) ReadUInt64() (uint64, error) {
 	b := make([]byte, 8)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return 0, err
 	}
 
-	br.pos += int64(n)
 	lo := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 	hi := uint32(b[4]) | uint32(b[5])<<8 | uint32(b[6])<<16 | uint32(b[7])<<24
 	return uint64(hi)<<32 | uint64(lo), nil
@@ -352,29 +362,27 @@ func (br *Reader) ReadUInt64() (uint64, error) {
 // ReadSingle implements of the Reader
 func (br *Reader) ReadSingle() (float32, error) {
 	b := make([]byte, 4)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return 0, err
 	}
 
-	br.pos += int64(n)
 	tmp := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
-	return float32(tmp), nil
+	return math.Float32frombits(tmp), nil
 }
 
 // ReadDouble implements of the Reader
 func (br *Reader) ReadDouble() (float64, error) {
 	b := make([]byte, 8)
-	n, err := br.r.Read(b)
+	_, err := br.readFull(b)
 	if err != nil {
 		return 0, err
 	}
 
-	br.pos += int64(n)
 	lo := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 	hi := uint32(b[4]) | uint32(b[5])<<8 | uint32(b[6])<<16 | uint32(b[7])<<24
 	tmp := uint64(hi)<<32 | uint64(lo)
-	return float64(tmp), nil
+	return math.Float64frombits(tmp), nil
 }
 
 // ReadString implements of the Reader
@@ -392,6 +400,11 @@ func (br *Reader) ReadString() (s string, err error) {
 	if slen == 0 {
 		return
 	}
+	if slen > br.r.Len() {
+		br.pos += int64(sn)
+		err = io.ErrUnexpectedEOF
+		return
+	}
 
 	var currPos, readLen int
 	currPos = 0
@@ -484,13 +497,11 @@ func (br *Reader) ReadStringSlice(delim byte) (s string, err error) {
 
 // ReadStringFixed implements of the Reader
 func (br *Reader) ReadStringFixed(count int, trimZero bool) (s string, err error) {
-	b := make([]byte, count)
-	n, err := br.r.Read(b)
+	b, err := br.ReadBytes(count)
 	if err != nil {
 		return
 	}
 
-	br.pos += int64(n)
 	if trimZero {
 		s = string(bytes.Trim(b, "\x00"))
 	} else {
@@ -566,6 +577,7 @@ func write7BitEncodedInt(w io.Writer, val int) (n int, err error) {
 type Writer struct {
 	pos int64
 	w   *bufio.Writer
+	buf *seekBuffer
 }
 
 // NewWriter implements for create Writer
@@ -601,7 +613,7 @@ func (bw *Writer) Position() int64 {
 
 // Size returns the size of the underlying buffer in bytes.
 func (bw *Writer) Size() int {
-	return bw.Size()
+	return bw.w.Size()
 }
 
 // Flush writes any buffered data to the underlying io.Writer.
@@ -656,7 +668,7 @@ func (bw *Writer) Write(v []byte) (n int, err error) {
 // WriteFloat implements of the Writer
 func (bw *Writer) WriteFloat(v float32) error {
 	b := make([]byte, 4)
-	tmp := uint32(v)
+	tmp := math.Float32bits(v)
 	b[0] = byte(tmp)
 	b[1] = byte(tmp >> 8)
 	b[2] = byte(tmp >> 16)
@@ -672,7 +684,7 @@ func (bw *Writer) WriteFloat(v float32) error {
 // WriteDouble implements of the Writer
 func (bw *Writer) WriteDouble(v float64) error {
 	b := make([]byte, 8)
-	tmp := uint64(v)
+	tmp := math.Float64bits(v)
 	b[0] = byte(tmp)
 	b[1] = byte(tmp >> 8)
 	b[2] = byte(tmp >> 16)
@@ -800,6 +812,6 @@ func (bw *Writer) WriteString(v string) (n int, err error) {
 		return
 	}
 	n += wn
-	bw.pos += int64(n)
+	bw.pos += int64(wn)
 	return
 }
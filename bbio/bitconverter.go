@@ -1,5 +1,7 @@
 package bbio
 
+import "math"
+
 type bitConverter struct {
 }
 
@@ -73,7 +75,7 @@ func (*bitConverter) GetUInt64Bytes(v uint64) (b []byte) {
 // GetFloat32Bytes implements for BitConverter
 func (*bitConverter) GetFloat32Bytes(v float32) (b []byte) {
 	b = make([]byte, 4)
-	tmp := uint32(v)
+	tmp := math.Float32bits(v)
 	b[0] = byte(tmp)
 	b[1] = byte(tmp >> 8)
 	b[2] = byte(tmp >> 16)
@@ -84,7 +86,7 @@ func (*bitConverter) GetFloat32Bytes(v float32) (b []byte) {
 // GetFloat64Bytes implements for BitConverter
 func (*bitConverter) GetFloat64Bytes(v float64) (b []byte) {
 	b = make([]byte, 8)
-	tmp := uint64(v)
+	tmp := math.Float64bits(v)
 	b[0] = byte(tmp)
 	b[1] = byte(tmp >> 8)
 	b[2] = byte(tmp >> 16)
@@ -156,16 +158,16 @@ func (*bitConverter) ToFloat32(b []byte) float32 {
 		return float32(0)
 	}
 	tmp := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
-	return float32(tmp)
+	return math.Float32frombits(tmp)
 }
 
 // ToFloat64 implements for BitConverter
 func (*bitConverter) ToFloat64(b []byte) float64 {
-	if len(b) < 4 {
+	if len(b) < 8 {
 		return float64(0)
 	}
 	lo := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 	hi := uint32(b[4]) | uint32(b[5])<<8 | uint32(b[6])<<16 | uint32(b[7])<<24
 	tmp := uint64(hi)<<32 | uint64(lo)
-	return float64(tmp)
+	return math.Float64frombits(tmp)
 }
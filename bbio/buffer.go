@@ -3,6 +3,7 @@ package bbio
 import (
 	"bytes"
 	"io"
+	"math"
 )
 
 // bufWrite7BitEncodedInt is write out an int 7 bits at a time.  The high bit of the byte,
@@ -108,7 +109,7 @@ func (bl *Buffer) WriteString(v string) (n int, err error) {
 // PutFloat implements for Buffer
 func (bl *Buffer) PutFloat(v float32) (n int, err error) {
 	b := make([]byte, 4)
-	tmp := uint32(v)
+	tmp := math.Float32bits(v)
 	b[0] = byte(tmp)
 	b[1] = byte(tmp >> 8)
 	b[2] = byte(tmp >> 16)
@@ -119,7 +120,7 @@ func (bl *Buffer) PutFloat(v float32) (n int, err error) {
 // PutDouble implements for Buffer
 func (bl *Buffer) PutDouble(v float64) (n int, err error) {
 	b := make([]byte, 8)
-	tmp := uint64(v)
+	tmp := math.Float64bits(v)
 	b[0] = byte(tmp)
 	b[1] = byte(tmp >> 8)
 	b[2] = byte(tmp >> 16)
@@ -200,7 +201,7 @@ func (bl *Buffer) PutFloatAll(v ...float32) (n int, err error) {
 	l := len(v)
 	for i := 0; i < l; i++ {
 		b := make([]byte, 4)
-		tmp := uint32(v[i])
+		tmp := math.Float32bits(v[i])
 		b[0] = byte(tmp)
 		b[1] = byte(tmp >> 8)
 		b[2] = byte(tmp >> 16)
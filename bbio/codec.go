@@ -0,0 +1,391 @@
+package bbio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Struct tags understood by Reader.Unmarshal and Writer.Marshal.
+//
+//	bbio:"int32"           fixed-size value: bool, int8, uint8, int16, uint16,
+//	                       int32, uint32, int64, uint64, float32, float64
+//	bbio:"string"          7-bit length-prefixed string
+//	bbio:"fixed=128"       fixed-width string, zero padded
+//	bbio:"bytes"           int32 length-prefixed byte slice
+//	bbio:"bytes=16"        fixed-size byte slice
+//	bbio:"-"               field is skipped
+//
+// Fields without a bbio tag use the kind of their Go type: int is read as
+// int32, []byte as bytes and structs field by field. Only exported fields
+// are visited.
+
+// codecField is a parsed bbio tag
+type codecField struct {
+	kind string
+	size int
+}
+
+var errCodecTarget = errors.New("bbio: codec target must be a pointer to a struct")
+
+func parseCodecTag(f reflect.StructField) (c codecField, err error) {
+	tag := f.Tag.Get("bbio")
+	if strings.IndexByte(tag, ',') >= 0 {
+		err = fmt.Errorf("bbio: unknown tag option in %q", tag)
+		return
+	}
+
+	c.kind = tag
+	if i := strings.IndexByte(tag, '='); i >= 0 {
+		c.kind = tag[:i]
+		c.size, err = strconv.Atoi(tag[i+1:])
+		if err == nil && c.size < 0 {
+			err = fmt.Errorf("bbio: negative size in tag %q", tag)
+		}
+	}
+	return
+}
+
+// kindOf returns the default kind for a Go type.
+func kindOf(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int8:
+		return "int8"
+	case reflect.Uint8:
+		return "uint8"
+	case reflect.Int16:
+		return "int16"
+	case reflect.Uint16:
+		return "uint16"
+	case reflect.Int32, reflect.Int:
+		return "int32"
+	case reflect.Uint32, reflect.Uint:
+		return "uint32"
+	case reflect.Int64:
+		return "int64"
+	case reflect.Uint64:
+		return "uint64"
+	case reflect.Float32:
+		return "float32"
+	case reflect.Float64:
+		return "float64"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+	case reflect.Struct:
+		return "struct"
+	}
+	return ""
+}
+
+// Unmarshal reads the tagged fields of the struct pointed to by v.
+func (br *Reader) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errCodecTarget
+	}
+	return br.readStruct(rv.Elem())
+}
+
+func (br *Reader) readStruct(sv reflect.Value) error {
+	t := sv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("bbio") == "-" {
+			continue
+		}
+
+		c, err := parseCodecTag(f)
+		if err != nil {
+			return err
+		}
+		if c.kind == "" {
+			c.kind = kindOf(f.Type)
+		}
+
+		err = br.readValue(sv.Field(i), c)
+		if err != nil {
+			return fmt.Errorf("bbio: %s.%s: %v", t.Name(), f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (br *Reader) readValue(v reflect.Value, c codecField) error {
+	switch c.kind {
+	case "bool":
+		b, err := br.ReadBoolean()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case "int8", "int16", "int32", "int64":
+		n, err := br.readInt(c.kind)
+		if err != nil {
+			return err
+		}
+		return setInt(v, n)
+	case "uint8", "uint16", "uint32", "uint64":
+		n, err := br.readInt(c.kind)
+		if err != nil {
+			return err
+		}
+		// uint64 values above MaxInt64 come back negative, the cast undoes it
+		return setUint(v, uint64(n))
+	case "float32":
+		f, err := br.ReadSingle()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(f))
+	case "float64":
+		f, err := br.ReadDouble()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case "string":
+		s, err := br.ReadString()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case "fixed":
+		s, err := br.ReadStringFixed(c.size, true)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case "bytes":
+		size := c.size
+		if size == 0 {
+			n, err := br.ReadInt32()
+			if err != nil {
+				return err
+			}
+			size = int(n)
+		}
+		b, err := br.ReadBytes(size)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+	case "struct":
+		return br.readStruct(v)
+	default:
+		return fmt.Errorf("unsupported kind %q", c.kind)
+	}
+	return nil
+}
+
+func (br *Reader) readInt(kind string) (int64, error) {
+	switch kind {
+	case "int8":
+		b, err := br.ReadByte()
+		return int64(int8(b)), err
+	case "uint8":
+		b, err := br.ReadByte()
+		return int64(b), err
+	case "int16":
+		n, err := br.ReadInt16()
+		return int64(n), err
+	case "uint16":
+		n, err := br.ReadUInt16()
+		return int64(n), err
+	case "int32":
+		n, err := br.ReadInt32()
+		return int64(n), err
+	case "uint32":
+		n, err := br.ReadUInt32()
+		return int64(n), err
+	case "uint64":
+		n, err := br.ReadUInt64()
+		return int64(n), err
+	}
+	return br.ReadInt64()
+}
+
+// Marshal writes the tagged fields of the struct pointed to by v.
+func (bw *Writer) Marshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errCodecTarget
+	}
+	return bw.writeStruct(rv)
+}
+
+func (bw *Writer) writeStruct(sv reflect.Value) error {
+	t := sv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("bbio") == "-" {
+			continue
+		}
+
+		c, err := parseCodecTag(f)
+		if err != nil {
+			return err
+		}
+		if c.kind == "" {
+			c.kind = kindOf(f.Type)
+		}
+
+		err = bw.writeValue(sv.Field(i), c)
+		if err != nil {
+			return fmt.Errorf("bbio: %s.%s: %v", t.Name(), f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (bw *Writer) writeValue(v reflect.Value, c codecField) error {
+	switch c.kind {
+	case "bool":
+		var b byte
+		if v.Bool() {
+			b = 1
+		}
+		return bw.WriteByte(b)
+	case "int8", "uint8", "int16", "uint16", "int32", "uint32":
+		n := valueInt(v)
+		min, max := kindRange(c.kind)
+		if n < min || n > max {
+			return fmt.Errorf("value %d overflows %s", n, c.kind)
+		}
+
+		switch c.kind {
+		case "int8", "uint8":
+			return bw.WriteByte(byte(n))
+		case "int16", "uint16":
+			return bw.WriteShort(int16(n))
+		}
+		return bw.WriteInt(int32(n))
+	case "int64", "uint64":
+		return bw.WriteLong(valueInt(v))
+	case "float32":
+		return bw.WriteFloat(float32(v.Float()))
+	case "float64":
+		return bw.WriteDouble(v.Float())
+	case "string":
+		_, err := bw.WriteString(v.String())
+		return err
+	case "fixed":
+		s := v.String()
+		if len(s) > c.size {
+			return fmt.Errorf("string longer than %d bytes", c.size)
+		}
+		b := make([]byte, c.size)
+		copy(b, s)
+		_, err := bw.Write(b)
+		return err
+	case "bytes":
+		b := v.Bytes()
+		if c.size != 0 {
+			if len(b) != c.size {
+				return fmt.Errorf("expected %d bytes, got %d", c.size, len(b))
+			}
+		} else {
+			err := bw.WriteInt(int32(len(b)))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := bw.Write(b)
+		return err
+	case "struct":
+		return bw.writeStruct(v)
+	}
+	return fmt.Errorf("unsupported kind %q", c.kind)
+}
+
+// kindRange is the range of values a fixed-size integer kind can hold
+func kindRange(kind string) (min int64, max int64) {
+	switch kind {
+	case "int8":
+		return math.MinInt8, math.MaxInt8
+	case "uint8":
+		return 0, math.MaxUint8
+	case "int16":
+		return math.MinInt16, math.MaxInt16
+	case "uint16":
+		return 0, math.MaxUint16
+	case "int32":
+		return math.MinInt32, math.MaxInt32
+	case "uint32":
+		return 0, math.MaxUint32
+	}
+	return math.MinInt64, math.MaxInt64
+}
+
+func valueInt(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// setInt stores a signed value, refusing values the field can not hold
+func setInt(v reflect.Value, n int64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetUint(uint64(n))
+	case reflect.Bool:
+		if n != 0 && n != 1 {
+			return fmt.Errorf("value %d is not a bool", n)
+		}
+		v.SetBool(n != 0)
+	default:
+		return fmt.Errorf("cannot store integer in %s", v.Type())
+	}
+	return nil
+}
+
+// setUint stores an unsigned value, refusing values the field can not hold
+func setUint(v reflect.Value, n uint64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n > math.MaxInt64 || v.OverflowInt(int64(n)) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.OverflowUint(n) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+	case reflect.Bool:
+		if n > 1 {
+			return fmt.Errorf("value %d is not a bool", n)
+		}
+		v.SetBool(n != 0)
+	default:
+		return fmt.Errorf("cannot store integer in %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package bbio
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type codecPoint struct {
+	X int16
+	Y int16
+}
+
+type codecRecord struct {
+	Version int32  `bbio:"int32"`
+	Name    string `bbio:"fixed=6"`
+	Title   string `bbio:"string"`
+	Key     []byte `bbio:"bytes=2"`
+	Data    []byte `bbio:"bytes"`
+	Small   uint8  `bbio:"uint8"`
+	Big     uint64
+	Pos     int64
+	Point   codecPoint
+	Flag    bool
+	Skip    int32 `bbio:"-"`
+	hidden  int32
+}
+
+// codecBytes is the encoding of codecValue
+func codecBytes() []byte {
+	b := []byte{3, 0, 0, 0}
+	b = append(b, 'a', 'b', 'c', 0, 0, 0)
+	b = append(b, 2, 'h', 'i')
+	b = append(b, 0xde, 0xad)
+	b = append(b, 3, 0, 0, 0, 1, 2, 3)
+	b = append(b, 0xfe)
+	b = append(b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	b = append(b, 0xf8, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	b = append(b, 0xff, 0xff, 8, 0)
+	return append(b, 1)
+}
+
+func codecValue() codecRecord {
+	return codecRecord{
+		Version: 3,
+		Name:    "abc",
+		Title:   "hi",
+		Key:     []byte{0xde, 0xad},
+		Data:    []byte{1, 2, 3},
+		Small:   0xfe,
+		Big:     1<<64 - 1,
+		Pos:     -8,
+		Point:   codecPoint{X: -1, Y: 8},
+		Flag:    true,
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	data := codecBytes()
+
+	var got codecRecord
+	br := NewReaderBytes(data)
+	if err := br.Unmarshal(&got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if want := codecValue(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal = %+v, want %+v", got, want)
+	}
+	if br.Len() != 0 {
+		t.Errorf("%d bytes left unread", br.Len())
+	}
+
+	var b bytes.Buffer
+	bw := NewWriter(&b)
+	if err := bw.Marshal(&got); err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	bw.Flush()
+	if !bytes.Equal(b.Bytes(), data) {
+		t.Errorf("Marshal = % x, want % x", b.Bytes(), data)
+	}
+}
+
+type codecLongName struct {
+	Name string `bbio:"fixed=2"`
+}
+
+type codecFixedBytes struct {
+	Key []byte `bbio:"bytes=2"`
+}
+
+type codecBadTag struct {
+	Value int32 `bbio:"int32,nope"`
+}
+
+type codecList struct {
+	Values []int32
+}
+
+type codecNarrow struct {
+	Value int8 `bbio:"int32"`
+}
+
+type codecSigned struct {
+	Value int32 `bbio:"uint32"`
+}
+
+type codecUnsigned struct {
+	Value uint16 `bbio:"int32"`
+}
+
+type codecFlag struct {
+	Value bool `bbio:"int32"`
+}
+
+type codecWide struct {
+	Value int64 `bbio:"int32"`
+}
+
+type codecNegative struct {
+	Value int32 `bbio:"uint16"`
+}
+
+func TestCodecErrors(t *testing.T) {
+	writes := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"fixed string too long", codecLongName{Name: "abc"}, "longer than 2"},
+		{"fixed bytes", codecFixedBytes{Key: []byte{1}}, "expected 2 bytes"},
+		{"unknown option", codecBadTag{}, "unknown tag option"},
+		{"array", codecList{Values: []int32{1}}, "unsupported kind"},
+		{"int64 in int32", codecWide{Value: 1 << 40}, "overflows int32"},
+		{"negative uint16", codecNegative{Value: -1}, "overflows uint16"},
+		{"not a struct", 5, "pointer to a struct"},
+	}
+	for _, tt := range writes {
+		err := NewWriter(&bytes.Buffer{}).Marshal(tt.v)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Marshal error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	reads := []struct {
+		name string
+		v    interface{}
+		data []byte
+		want string
+	}{
+		{"int32 in int8", &codecNarrow{}, []byte{0x2c, 1, 0, 0}, "overflows int8"},
+		{"uint32 in int32", &codecSigned{}, []byte{0xff, 0xff, 0xff, 0xff}, "overflows int32"},
+		{"negative in uint16", &codecUnsigned{}, []byte{0xff, 0xff, 0xff, 0xff}, "overflows uint16"},
+		{"int32 in uint16", &codecUnsigned{}, []byte{0, 0, 1, 0}, "overflows uint16"},
+		{"bool 2", &codecFlag{}, []byte{2, 0, 0, 0}, "not a bool"},
+		{"truncated", &codecNarrow{}, []byte{1, 0}, "codecNarrow.Value"},
+		{"array", &codecList{}, []byte{0, 0, 0, 0}, "unsupported kind"},
+	}
+	for _, tt := range reads {
+		err := NewReaderBytes(tt.data).Unmarshal(tt.v)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Unmarshal error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// values that fit are stored
+	var narrow codecNarrow
+	if err := NewReaderBytes([]byte{0x80, 0xff, 0xff, 0xff}).Unmarshal(&narrow); err != nil || narrow.Value != -128 {
+		t.Errorf("int8 -128: %d, %v", narrow.Value, err)
+	}
+
+	var v codecList
+	if err := NewReaderBytes(nil).Unmarshal(v); err != errCodecTarget {
+		t.Errorf("Unmarshal of a value: %v, want %v", err, errCodecTarget)
+	}
+}
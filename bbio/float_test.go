@@ -0,0 +1,68 @@
+package bbio
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 1.5 as little-endian IEEE 754 single and double
+var (
+	float32Bytes = []byte{0x00, 0x00, 0xc0, 0x3f}
+	float64Bytes = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f}
+)
+
+func TestFloatWrite(t *testing.T) {
+	var b bytes.Buffer
+	bw := NewWriter(&b)
+	if err := bw.WriteFloat(1.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.WriteDouble(1.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := append(append([]byte{}, float32Bytes...), float64Bytes...); !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("Writer wrote % x, want % x", b.Bytes(), want)
+	}
+
+	buf := NewBuffer()
+	buf.PutFloat(1.5)
+	buf.PutDouble(1.5)
+	buf.PutFloatAll(1.5, -0.25)
+	want := append(append(append([]byte{}, float32Bytes...), float64Bytes...), float32Bytes...)
+	want = append(want, 0x00, 0x00, 0x80, 0xbe)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Buffer wrote % x, want % x", buf.Bytes(), want)
+	}
+
+	if got := BitConverter.GetFloat32Bytes(1.5); !bytes.Equal(got, float32Bytes) {
+		t.Errorf("GetFloat32Bytes = % x, want % x", got, float32Bytes)
+	}
+	if got := BitConverter.GetFloat64Bytes(1.5); !bytes.Equal(got, float64Bytes) {
+		t.Errorf("GetFloat64Bytes = % x, want % x", got, float64Bytes)
+	}
+}
+
+func TestFloatRead(t *testing.T) {
+	br := NewReaderBytes(append(append([]byte{}, float32Bytes...), float64Bytes...))
+	single, err := br.ReadSingle()
+	if err != nil || single != 1.5 {
+		t.Errorf("ReadSingle = %v, %v, want 1.5", single, err)
+	}
+	double, dErr := br.ReadDouble()
+	if dErr != nil || double != 1.5 {
+		t.Errorf("ReadDouble = %v, %v, want 1.5", double, dErr)
+	}
+
+	if got := BitConverter.ToFloat32(float32Bytes); got != 1.5 {
+		t.Errorf("ToFloat32 = %v, want 1.5", got)
+	}
+	if got := BitConverter.ToFloat64(float64Bytes); got != 1.5 {
+		t.Errorf("ToFloat64 = %v, want 1.5", got)
+	}
+	if got := BitConverter.ToFloat64(float64Bytes[:4]); got != 0 {
+		t.Errorf("ToFloat64 of 4 bytes = %v, want 0", got)
+	}
+}
@@ -0,0 +1,133 @@
+package bbio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var errNotPatchable = errors.New("bbio.Writer: patching needs a writer from NewWriterBuffer")
+
+// seekBuffer is an in-memory io.Writer that can overwrite bytes it already holds.
+type seekBuffer struct {
+	b []byte
+}
+
+// Write implements the io.Writer interface.
+func (sb *seekBuffer) Write(p []byte) (int, error) {
+	sb.b = append(sb.b, p...)
+	return len(p), nil
+}
+
+// WriteAt implements the io.WriterAt interface, it never grows the buffer.
+func (sb *seekBuffer) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(sb.b)) {
+		return 0, errors.New("bbio.seekBuffer.WriteAt: offset out of range")
+	}
+	return copy(sb.b[off:], p), nil
+}
+
+// Placeholder is a field reserved by ReserveInt or ReserveLong.
+type Placeholder struct {
+	pos  int64
+	size int
+}
+
+// Position returns the offset of the reserved field.
+func (p Placeholder) Position() int64 {
+	return p.pos
+}
+
+// End returns the offset just after the reserved field.
+func (p Placeholder) End() int64 {
+	return p.pos + int64(p.size)
+}
+
+// NewWriterBuffer creates a Writer over an in-memory buffer. Fields reserved
+// with ReserveInt or ReserveLong can be patched once their value is known,
+// which suits length and offset fields written before their payload.
+func NewWriterBuffer() *Writer {
+	sb := &seekBuffer{}
+	return &Writer{w: bufio.NewWriter(sb), buf: sb}
+}
+
+// ReserveInt writes a zero int32 to be patched later.
+func (bw *Writer) ReserveInt() (p Placeholder, err error) {
+	return bw.reserve(4)
+}
+
+// ReserveLong writes a zero int64 to be patched later.
+func (bw *Writer) ReserveLong() (p Placeholder, err error) {
+	return bw.reserve(8)
+}
+
+func (bw *Writer) reserve(size int) (p Placeholder, err error) {
+	if bw.buf == nil {
+		err = errNotPatchable
+		return
+	}
+	p = Placeholder{pos: bw.pos, size: size}
+	_, err = bw.Write(make([]byte, size))
+	return
+}
+
+// Patch overwrites a reserved field with v, an int32 field refuses values
+// it can not hold.
+func (bw *Writer) Patch(p Placeholder, v int64) error {
+	if bw.buf == nil {
+		return errNotPatchable
+	}
+	if p.size == 4 && (v < math.MinInt32 || v > math.MaxInt32) {
+		return fmt.Errorf("bbio.Writer.Patch: %d overflows int32", v)
+	}
+	err := bw.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, p.size)
+	for i := range b {
+		b[i] = byte(v >> (8 * uint(i)))
+	}
+	_, err = bw.buf.WriteAt(b, p.pos)
+	return err
+}
+
+// PatchLength patches a reserved field with the number of bytes written after it.
+func (bw *Writer) PatchLength(p Placeholder) error {
+	return bw.Patch(p, bw.pos-p.End())
+}
+
+// Bytes returns everything written to a writer from NewWriterBuffer.
+func (bw *Writer) Bytes() ([]byte, error) {
+	if bw.buf == nil {
+		return nil, errNotPatchable
+	}
+	err := bw.w.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return bw.buf.b, nil
+}
+
+// WriteTo copies the contents of a writer from NewWriterBuffer to w,
+// flushing w afterwards when it is buffered.
+func (bw *Writer) WriteTo(w io.Writer) (n int64, err error) {
+	b, err := bw.Bytes()
+	if err != nil {
+		return
+	}
+
+	wn, err := w.Write(b)
+	n = int64(wn)
+	if err != nil {
+		return
+	}
+
+	if f, ok := w.(interface{ Flush() error }); ok {
+		err = f.Flush()
+	}
+	return
+}
@@ -0,0 +1,129 @@
+package bbio
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPatchNested(t *testing.T) {
+	bw := NewWriterBuffer()
+	outer, err := bw.ReserveInt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bw.Write([]byte{1, 2, 3})
+	inner, err := bw.ReserveLong()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bw.Write([]byte{4, 5, 6, 7, 8})
+	if err := bw.PatchLength(inner); err != nil {
+		t.Fatal(err)
+	}
+	bw.Write([]byte{9})
+	if err := bw.PatchLength(outer); err != nil {
+		t.Fatal(err)
+	}
+
+	if outer.Position() != 0 || outer.End() != 4 || inner.Position() != 7 || inner.End() != 15 {
+		t.Errorf("outer %d-%d, inner %d-%d", outer.Position(), outer.End(), inner.Position(), inner.End())
+	}
+
+	got, err := bw.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		17, 0, 0, 0, 1, 2, 3,
+		5, 0, 0, 0, 0, 0, 0, 0, 4, 5, 6, 7, 8,
+		9,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+}
+
+func TestPatchAfterFlush(t *testing.T) {
+	bw := NewWriterBuffer()
+	head, err := bw.ReserveInt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// more than the bufio buffer, the field has left it before the patch
+	payload := bytes.Repeat([]byte{0xaa}, 3*bw.Size())
+	bw.Write(payload)
+	if err := bw.PatchLength(head); err != nil {
+		t.Fatal(err)
+	}
+
+	// a field still in the bufio buffer after an explicit flush
+	tail, err := bw.ReserveLong()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Patch(tail, -2); err != nil {
+		t.Fatal(err)
+	}
+	bw.Write([]byte{7})
+
+	got, err := bw.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := NewReaderBytes(got).ReadInt32(); n != int32(len(payload)) {
+		t.Errorf("length %d, want %d", n, len(payload))
+	}
+	if !bytes.Equal(got[4:4+len(payload)], payload) {
+		t.Error("payload changed")
+	}
+	last := got[4+len(payload):]
+	if !bytes.Equal(last, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 7}) {
+		t.Errorf("tail % x", last)
+	}
+}
+
+func TestWriteToBufio(t *testing.T) {
+	bw := NewWriterBuffer()
+	p, _ := bw.ReserveInt()
+	bw.Write([]byte("card"))
+	bw.PatchLength(p)
+
+	var out bytes.Buffer
+	target := bufio.NewWriter(&out)
+	n, err := bw.WriteTo(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing left in the bufio buffer of the target
+	if n != 8 || target.Buffered() != 0 || !bytes.Equal(out.Bytes(), []byte{4, 0, 0, 0, 'c', 'a', 'r', 'd'}) {
+		t.Errorf("wrote %d, %d buffered, target % x", n, target.Buffered(), out.Bytes())
+	}
+}
+
+func TestPatchErrors(t *testing.T) {
+	bw := NewWriter(&bytes.Buffer{})
+	if _, err := bw.ReserveInt(); err != errNotPatchable {
+		t.Errorf("ReserveInt: %v", err)
+	}
+	if err := bw.Patch(Placeholder{size: 4}, 1); err != errNotPatchable {
+		t.Errorf("Patch: %v", err)
+	}
+	if _, err := bw.Bytes(); err != errNotPatchable {
+		t.Errorf("Bytes: %v", err)
+	}
+
+	pb := NewWriterBuffer()
+	p, _ := pb.ReserveInt()
+	if err := pb.Patch(p, 1<<31); err == nil || !strings.Contains(err.Error(), "overflows int32") {
+		t.Errorf("int32 overflow: %v", err)
+	}
+	if err := pb.Patch(Placeholder{pos: 2, size: 4}, 1); err == nil {
+		t.Error("patch past the end accepted")
+	}
+}
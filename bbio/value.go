@@ -0,0 +1,351 @@
+package bbio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type cast struct{}
+
+// Cast converts decoded msgpack values, every conversion reports values
+// that do not fit instead of truncating them
+var Cast cast
+
+// CastError reports a value that can not be coerced to the wanted type
+type CastError struct {
+	Path  string
+	Want  string
+	Value interface{}
+	Found bool
+}
+
+func (e *CastError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "(root)"
+	}
+	if !e.Found {
+		return fmt.Sprintf("bbio: %s: missing, want %s", path, e.Want)
+	}
+	return fmt.Sprintf("bbio: %s: cannot use %T (%v) as %s", path, e.Value, e.Value, e.Want)
+}
+
+func castError(path string, want string, val interface{}) error {
+	return &CastError{Path: path, Want: want, Value: val, Found: true}
+}
+
+func toInt64(path string, want string, val interface{}, min int64, max int64) (ret int64, err error) {
+	switch t := val.(type) {
+	case int:
+		ret = int64(t)
+	case int8:
+		ret = int64(t)
+	case int16:
+		ret = int64(t)
+	case int32:
+		ret = int64(t)
+	case int64:
+		ret = t
+	case uint8:
+		ret = int64(t)
+	case uint16:
+		ret = int64(t)
+	case uint32:
+		ret = int64(t)
+	case uint64:
+		if t > math.MaxInt64 {
+			err = castError(path, want, val)
+			return
+		}
+		ret = int64(t)
+	case float32:
+		// float64(math.MaxInt64) rounds up to 1<<63, which int64 can't hold
+		f := float64(t)
+		if f != math.Trunc(f) || f < float64(min) || f > float64(max) || f >= 1<<63 {
+			err = castError(path, want, val)
+			return
+		}
+		ret = int64(f)
+	case float64:
+		if t != math.Trunc(t) || t < float64(min) || t > float64(max) || t >= 1<<63 {
+			err = castError(path, want, val)
+			return
+		}
+		ret = int64(t)
+	default:
+		err = castError(path, want, val)
+		return
+	}
+
+	if ret < min || ret > max {
+		ret = 0
+		err = castError(path, want, val)
+	}
+	return
+}
+
+func toFloat64(path string, want string, val interface{}) (ret float64, err error) {
+	switch t := val.(type) {
+	case float32:
+		ret = float64(t)
+	case float64:
+		ret = t
+	case int:
+		ret = float64(t)
+	case int8:
+		ret = float64(t)
+	case int16:
+		ret = float64(t)
+	case int32:
+		ret = float64(t)
+	case int64:
+		ret = float64(t)
+	case uint8:
+		ret = float64(t)
+	case uint16:
+		ret = float64(t)
+	case uint32:
+		ret = float64(t)
+	case uint64:
+		ret = float64(t)
+	default:
+		err = castError(path, want, val)
+	}
+	return
+}
+
+// ToInt32 implements for Cast
+func (cast) ToInt32(val interface{}) (int32, error) {
+	return Cast.Value("", val).Int32()
+}
+
+// ToInt64 implements for Cast
+func (cast) ToInt64(val interface{}) (int64, error) {
+	return Cast.Value("", val).Int64()
+}
+
+// ToBool implements for Cast
+func (cast) ToBool(val interface{}) (bool, error) {
+	return Cast.Value("", val).Bool()
+}
+
+// ToFloat32 implements for Cast
+func (cast) ToFloat32(val interface{}) (float32, error) {
+	return Cast.Value("", val).Float32()
+}
+
+// ToFloat64 implements for Cast
+func (cast) ToFloat64(val interface{}) (float64, error) {
+	return Cast.Value("", val).Float64()
+}
+
+// ToString implements for Cast
+func (cast) ToString(val interface{}) (string, error) {
+	return Cast.Value("", val).String()
+}
+
+// ToBytes implements for Cast
+func (cast) ToBytes(val interface{}) ([]byte, error) {
+	return Cast.Value("", val).Bytes()
+}
+
+// ToSlice implements for Cast
+func (cast) ToSlice(val interface{}) ([]interface{}, error) {
+	return Cast.Value("", val).Slice()
+}
+
+// ToMap implements for Cast
+func (cast) ToMap(val interface{}) (map[string]interface{}, error) {
+	return Cast.Value("", val).Map()
+}
+
+// Value wraps a decoded msgpack value and keeps its key path for errors
+type Value struct {
+	path  string
+	val   interface{}
+	found bool
+}
+
+// Value implements for Cast
+func (cast) Value(name string, val interface{}) Value {
+	return Value{path: name, val: val, found: true}
+}
+
+// Path implements for Value
+func (v Value) Path() string {
+	return v.path
+}
+
+// Exists implements for Value
+func (v Value) Exists() bool {
+	return v.found
+}
+
+// Interface implements for Value
+func (v Value) Interface() interface{} {
+	return v.val
+}
+
+func (v Value) missing(want string) error {
+	return &CastError{Path: v.path, Want: want}
+}
+
+// Key implements for Value
+func (v Value) Key(name string) Value {
+	child := Value{path: name}
+	if v.path != "" {
+		child.path = v.path + "." + name
+	}
+
+	m, mErr := v.Map()
+	if mErr != nil {
+		return child
+	}
+	child.val, child.found = m[name]
+	return child
+}
+
+// Index implements for Value
+func (v Value) Index(i int) Value {
+	child := Value{path: fmt.Sprintf("%s[%d]", v.path, i)}
+
+	s, sErr := v.Slice()
+	if sErr != nil || i < 0 || i >= len(s) {
+		return child
+	}
+	child.val = s[i]
+	child.found = true
+	return child
+}
+
+// Int32 implements for Value
+func (v Value) Int32() (int32, error) {
+	if !v.found {
+		return 0, v.missing("int32")
+	}
+	ret, err := toInt64(v.path, "int32", v.val, math.MinInt32, math.MaxInt32)
+	return int32(ret), err
+}
+
+// Int64 implements for Value
+func (v Value) Int64() (int64, error) {
+	if !v.found {
+		return 0, v.missing("int64")
+	}
+	return toInt64(v.path, "int64", v.val, math.MinInt64, math.MaxInt64)
+}
+
+// Bool implements for Value
+func (v Value) Bool() (bool, error) {
+	if !v.found {
+		return false, v.missing("bool")
+	}
+	b, ok := v.val.(bool)
+	if !ok {
+		return false, castError(v.path, "bool", v.val)
+	}
+	return b, nil
+}
+
+// Float32 implements for Value
+func (v Value) Float32() (float32, error) {
+	if !v.found {
+		return 0, v.missing("float32")
+	}
+	if f, ok := v.val.(float32); ok {
+		return f, nil
+	}
+	ret, err := toFloat64(v.path, "float32", v.val)
+	return float32(ret), err
+}
+
+// Float64 implements for Value
+func (v Value) Float64() (float64, error) {
+	if !v.found {
+		return 0, v.missing("float64")
+	}
+	return toFloat64(v.path, "float64", v.val)
+}
+
+// String implements for Value
+func (v Value) String() (string, error) {
+	if !v.found {
+		return "", v.missing("string")
+	}
+	switch t := v.val.(type) {
+	case string:
+		return t, nil
+	case []byte:
+		return string(t), nil
+	}
+	return "", castError(v.path, "string", v.val)
+}
+
+// Bytes implements for Value
+func (v Value) Bytes() ([]byte, error) {
+	if !v.found {
+		return nil, v.missing("bytes")
+	}
+	switch t := v.val.(type) {
+	case []byte:
+		return t, nil
+	case string:
+		return []byte(t), nil
+	case nil:
+		return nil, nil
+	}
+	return nil, castError(v.path, "bytes", v.val)
+}
+
+// Slice implements for Value
+func (v Value) Slice() ([]interface{}, error) {
+	if !v.found {
+		return nil, v.missing("array")
+	}
+	switch t := v.val.(type) {
+	case []interface{}:
+		return t, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, castError(v.path, "array", v.val)
+}
+
+// Map implements for Value
+func (v Value) Map() (map[string]interface{}, error) {
+	if !v.found {
+		return nil, v.missing("map")
+	}
+	switch t := v.val.(type) {
+	case map[string]interface{}:
+		return t, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			s, ok := k.(string)
+			if !ok {
+				return nil, castError(v.path, "map", v.val)
+			}
+			m[s] = e
+		}
+		return m, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, castError(v.path, "map", v.val)
+}
+
+// Keys implements for Value
+func (v Value) Keys() ([]string, error) {
+	m, err := v.Map()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
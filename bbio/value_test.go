@@ -0,0 +1,114 @@
+package bbio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValueInt64(t *testing.T) {
+	tests := []struct {
+		val  interface{}
+		want int64
+		ok   bool
+	}{
+		{int8(-5), -5, true},
+		{uint32(7), 7, true},
+		{float64(3), 3, true},
+		{float32(-2), -2, true},
+		{float64(1.5), 0, false},
+		{uint64(math.MaxUint64), 0, false},
+		{float64(1 << 62), 1 << 62, true},
+		{float64(1 << 63), 0, false},
+		{float32(1 << 63), 0, false},
+		{float64(-1 << 63), math.MinInt64, true},
+		{"1", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := Cast.Value("n", tt.val).Int64()
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Int64(%T %v) = %d, %v, want %d ok=%v", tt.val, tt.val, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValueInt32Range(t *testing.T) {
+	tests := []struct {
+		val interface{}
+		ok  bool
+	}{
+		{int64(math.MaxInt32), true},
+		{int64(math.MaxInt32 + 1), false},
+		{float64(math.MinInt32), true},
+		{float64(math.MinInt32 - 1), false},
+	}
+	for _, tt := range tests {
+		_, err := Cast.Value("n", tt.val).Int32()
+		if (err == nil) != tt.ok {
+			t.Errorf("Int32(%T %v) error %v, want ok=%v", tt.val, tt.val, err, tt.ok)
+		}
+	}
+}
+
+func TestCastError(t *testing.T) {
+	_, err := Cast.Value("sex", "x").Int32()
+	ce, ok := err.(*CastError)
+	if !ok {
+		t.Fatalf("error %T %v, want *CastError", err, err)
+	}
+	if ce.Path != "sex" || ce.Want != "int32" || ce.Value != "x" || !ce.Found {
+		t.Errorf("CastError = %+v", ce)
+	}
+	if want := "bbio: sex: cannot use string (x) as int32"; ce.Error() != want {
+		t.Errorf("Error() = %q, want %q", ce.Error(), want)
+	}
+
+	missing := &CastError{Want: "map"}
+	if want := "bbio: (root): missing, want map"; missing.Error() != want {
+		t.Errorf("Error() = %q, want %q", missing.Error(), want)
+	}
+}
+
+func TestValuePath(t *testing.T) {
+	root := Cast.Value("", map[string]interface{}{
+		"parts": []interface{}{
+			map[interface{}]interface{}{"id": int8(4)},
+			"bad",
+		},
+	})
+
+	tests := []struct {
+		v     Value
+		path  string
+		found bool
+		want  string
+	}{
+		{root.Key("parts").Index(0).Key("id"), "parts[0].id", true, ""},
+		{root.Key("parts").Index(1).Key("id"), "parts[1].id", false, "bbio: parts[1].id: missing, want int32"},
+		{root.Key("parts").Index(5), "parts[5]", false, "bbio: parts[5]: missing, want int32"},
+		{root.Key("none").Key("id"), "none.id", false, "bbio: none.id: missing, want int32"},
+		{root.Key("parts").Index(1), "parts[1]", true, "bbio: parts[1]: cannot use string (bad) as int32"},
+	}
+	for _, tt := range tests {
+		if tt.v.Path() != tt.path || tt.v.Exists() != tt.found {
+			t.Errorf("path %q found %v, want %q %v", tt.v.Path(), tt.v.Exists(), tt.path, tt.found)
+		}
+		n, err := tt.v.Int32()
+		if tt.want == "" {
+			if err != nil || n != 4 {
+				t.Errorf("%s: %d, %v, want 4", tt.path, n, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: error %v, want %q", tt.path, err, tt.want)
+		}
+	}
+
+	if _, err := root.Key("parts").Map(); err == nil {
+		t.Error("Map of an array succeeded")
+	}
+	keys, kErr := root.Key("parts").Index(0).Keys()
+	if kErr != nil || len(keys) != 1 || keys[0] != "id" {
+		t.Errorf("Keys = %v, %v", keys, kErr)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sulfur/bbio"
+)
+
+func dumpVersionString(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("Block version '%v' is not a string", v)
+	}
+	return s, nil
+}
+
+func dumpVersionInt(v interface{}) (int32, error) {
+	f, ok := v.(float64)
+	if !ok || f != float64(int32(f)) {
+		return 0, fmt.Errorf("Block version '%v' is not an int32", v)
+	}
+	return int32(f), nil
+}
+
+// LoadDump implements for KKChara
+func (sf *KKChara) LoadDump(dump CharaDump) (card KKCharaCard, err error) {
+	var header KKDumpHeader
+	hErr := json.Unmarshal(dump.Header, &header)
+	if hErr != nil {
+		err = hErr
+		return
+	}
+	if header.Marker != kkCharaMark && header.Marker != kkCharaSMark && header.Marker != kkCharaSPMark {
+		err = errors.New("KK Chara mark not found")
+		return
+	}
+
+	card.loadProductNo = header.LoadProductNo
+	card.marker = header.Marker
+	card.loadVersion = header.LoadVersion
+	card.faceData = header.Face
+	card.faceLength = int32(len(header.Face))
+	card.data = make(map[string][]byte)
+
+	for _, b := range dump.Blocks {
+		version, vErr := dumpVersionString(b.Version)
+		if vErr != nil {
+			err = vErr
+			return
+		}
+
+		data, dErr := b.bytes()
+		if dErr != nil {
+			err = fmt.Errorf("Block '%s': %v", b.Name, dErr)
+			return
+		}
+
+		card.infoHeader.lstInfo = append(card.infoHeader.lstInfo, KKHeaderInfo{name: b.Name, version: version, pos: b.Pos, size: int64(len(data))})
+		card.data[b.Name] = data
+	}
+
+	err = card.loadPreviewInfo()
+	return
+}
+
+// LoadDump implements for AISChara
+func (sf *AISChara) LoadDump(dump CharaDump) (card AISCharaCard, err error) {
+	var header AISDumpHeader
+	hErr := json.Unmarshal(dump.Header, &header)
+	if hErr != nil {
+		err = hErr
+		return
+	}
+	if header.Marker != aisCharaMark {
+		err = errors.New("AIS Chara mark not found")
+		return
+	}
+
+	card.loadProductNo = header.LoadProductNo
+	card.marker = header.Marker
+	card.loadVersion = header.LoadVersion
+	card.language = header.Language
+	card.userID = header.UserID
+	card.dataID = header.DataID
+	card.data = make(map[string][]byte)
+
+	for _, b := range dump.Blocks {
+		version, vErr := dumpVersionString(b.Version)
+		if vErr != nil {
+			err = vErr
+			return
+		}
+
+		data, dErr := b.bytes()
+		if dErr != nil {
+			err = fmt.Errorf("Block '%s': %v", b.Name, dErr)
+			return
+		}
+
+		card.infoHeader.lstInfo = append(card.infoHeader.lstInfo, AISHeaderInfo{name: b.Name, version: version, pos: b.Pos, size: int64(len(data))})
+		card.data[b.Name] = data
+	}
+
+	err = card.loadPreviewInfo()
+	return
+}
+
+// LoadDump implements for HSChara, the signature is always regenerated
+func (sf *HSChara) LoadDump(dump CharaDump) (card HSCharaCard, err error) {
+	var header HSDumpHeader
+	hErr := json.Unmarshal(dump.Header, &header)
+	if hErr != nil {
+		err = hErr
+		return
+	}
+
+	switch header.Marker {
+	case hsCharaMaleMark:
+		card.sex = 0
+	case hsCharaFemaleMark:
+		card.sex = 1
+	default:
+		err = errors.New("HS Chara mark not found")
+		return
+	}
+
+	card.marker = header.Marker
+	card.loadVersion = header.LoadVersion
+	card.data = make(map[string][]byte)
+
+	for _, b := range dump.Blocks {
+		version, vErr := dumpVersionInt(b.Version)
+		if vErr != nil {
+			err = vErr
+			return
+		}
+
+		data, dErr := b.bytes()
+		if dErr != nil {
+			err = fmt.Errorf("Block '%s': %v", b.Name, dErr)
+			return
+		}
+
+		card.infoHeader.lstInfo = append(card.infoHeader.lstInfo, HSHeaderInfo{Name: b.Name, Version: version, Pos: b.Pos, Size: int64(len(data))})
+		card.data[b.Name] = data
+	}
+
+	err = card.loadPreviewInfo()
+	return
+}
+
+// LoadDump implements for PHChara
+func (sf *PHChara) LoadDump(dump CharaDump) (card PHCharaCard, err error) {
+	var header PHDumpHeader
+	hErr := json.Unmarshal(dump.Header, &header)
+	if hErr != nil {
+		err = hErr
+		return
+	}
+
+	sexInfo, sexErr := phSexByMarker(header.Marker)
+	if sexErr != nil {
+		err = sexErr
+		return
+	}
+
+	if len(dump.Blocks) != 1 {
+		err = errors.New("PlayHome chara expects one CustomParameter block")
+		return
+	}
+
+	data, dErr := dump.Blocks[0].bytes()
+	if dErr != nil {
+		err = dErr
+		return
+	}
+
+	card, err = readPHCustomParameter(bbio.NewReaderBytes(data))
+	if err != nil {
+		return
+	}
+	if card.sex != sexInfo.custom {
+		printWarning(fmt.Errorf("PlayHome chara sex %d does not match card mark %s", card.sex, header.Marker))
+	}
+	card.sceneSex = sexInfo.scene
+	card.name = dump.Name
+	return
+}
+
+func (h *CardHandlers) loadDump(dump CharaDump) (err error) {
+	switch dump.Game {
+	case gameKK:
+		if h.kk == nil {
+			h.kk = NewKKChara()
+			h.kk.card.charaCards = make(map[string]KKCharaCard)
+		}
+
+		card, cErr := h.kk.LoadDump(dump)
+		if cErr != nil {
+			err = cErr
+			return
+		}
+		h.kk.card.charaCards[h.kk.GenerateFileName(card.sex)] = card
+
+	case gameAIS, gameHS2:
+		if h.ais == nil {
+			h.ais = NewAISChara()
+			h.ais.card.charaCards = make(map[string]AISCharaCard)
+		}
+
+		card, cErr := h.ais.LoadDump(dump)
+		if cErr != nil {
+			err = cErr
+			return
+		}
+		h.ais.card.charaCards[h.ais.GenerateFileName(card.gameType, card.sex)] = card
+
+	case gameHS:
+		if h.hs == nil {
+			h.hs = NewHSChara()
+			h.hs.card.charaCards = make(map[string]HSCharaCard)
+		}
+
+		card, cErr := h.hs.LoadDump(dump)
+		if cErr != nil {
+			err = cErr
+			return
+		}
+		h.hs.card.charaCards[h.hs.GenerateFileName(card.sex)] = card
+
+	case gamePH:
+		if h.ph == nil {
+			h.ph = NewPHChara()
+			h.ph.card.charaCards = make(map[string]PHCharaCard)
+		}
+
+		card, cErr := h.ph.LoadDump(dump)
+		if cErr != nil {
+			err = cErr
+			return
+		}
+
+		name := card.name
+		if name == "" {
+			name = strings.ReplaceAll(time.Now().Format("2006.01.02.15.04.05.000"), ".", "")
+		}
+		key := name
+		for c := 0; ; c++ {
+			if _, ok := h.ph.card.charaCards[key]; !ok {
+				break
+			}
+			key = fmt.Sprintf("%s (%d)", name, c)
+		}
+		h.ph.card.charaCards[key] = card
+
+	default:
+		err = fmt.Errorf("Unknown game '%s'", dump.Game)
+	}
+	return
+}
+
+// buildScene writes a chara card for every chara of a JSON dump
+func buildScene(currDir string, filePath string, opts ExtractOptions) (report ExtractReport, err error) {
+	b, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	var lst []CharaDump
+	jErr := json.Unmarshal(b, &lst)
+	if jErr != nil {
+		err = jErr
+		return
+	}
+
+	var h CardHandlers
+	for i, v := range lst {
+		dErr := h.loadDump(v)
+		if dErr != nil {
+			err = fmt.Errorf("Chara %d: %v", i, dErr)
+			return
+		}
+	}
+
+	// there are no original bytes to copy
+	if opts.raw {
+		printWarning(errors.New("--raw is ignored by build, a dump has no original bytes"))
+		opts.raw = false
+	}
+
+	opts.thumb, err = newThumbnailer(opts, filepath.Base(filePath), nil)
+	if err != nil {
+		return
+	}
+
+	if opts.meta {
+		opts.cardMeta, err = newCardMeta(filePath)
+		if err != nil {
+			return
+		}
+	}
+
+	err = h.ExtractChara(currDir, opts, &report)
+	return
+}
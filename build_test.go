@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildScene(t *testing.T) {
+	for game, card := range testWriteCards(t) {
+		srcDir, dumpDir, outDir := t.TempDir(), t.TempDir(), t.TempDir()
+		cardPath := filepath.Join(srcDir, "card.png")
+		if err := ioutil.WriteFile(cardPath, card, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dumpScene(dumpDir, cardPath, ExtractOptions{json: true}, true); err != nil {
+			t.Fatalf("%s: %v", game, err)
+		}
+
+		// --raw has nothing to copy and is ignored
+		report, err := buildScene(outDir, filepath.Join(dumpDir, "card.json"), ExtractOptions{raw: true})
+		if err != nil {
+			t.Fatalf("%s: %v", game, err)
+		}
+		if report.Write() != 1 {
+			t.Fatalf("%s: wrote %d cards", game, report.Write())
+		}
+
+		files, rErr := ioutil.ReadDir(outDir)
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		if len(files) != 1 {
+			t.Fatalf("%s: %d files written", game, len(files))
+		}
+		src, sErr := loadCard(cardPath, true)
+		if sErr != nil {
+			t.Fatal(sErr)
+		}
+		built, bErr := loadCard(filepath.Join(outDir, files[0].Name()), true)
+		if bErr != nil {
+			t.Fatalf("%s: built card does not load: %v", game, bErr)
+		}
+
+		names, blocks := testCardBlocks(src)
+		gotNames, gotBlocks := testCardBlocks(built)
+		if !reflect.DeepEqual(gotNames, names) {
+			t.Errorf("%s: built blocks %v, want %v", game, gotNames, names)
+			continue
+		}
+		for i := range blocks {
+			if !bytes.Equal(gotBlocks[i], blocks[i]) {
+				t.Errorf("%s: block %s changed", game, names[i])
+			}
+		}
+	}
+}
+
+func TestLoadDumpErrors(t *testing.T) {
+	kk, err := NewKKChara().DumpChara(testKKCard(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs, hErr := NewHSChara().DumpChara(testHSCard(t))
+	if hErr != nil {
+		t.Fatal(hErr)
+	}
+	ph, pErr := NewPHChara().DumpChara(testPHCard(t, phSexFemale))
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	// each case changes a copy of one of the dumps
+	tests := []struct {
+		name string
+		dump CharaDump
+		edit func(d *CharaDump)
+		want string
+	}{
+		{"unknown game", kk, func(d *CharaDump) { d.Game = "XX" }, "Unknown game"},
+		{"KK marker", kk, func(d *CharaDump) { d.Header = json.RawMessage(`{"marker":"【HoneySelectCharaFemale】"}`) }, "KK Chara mark not found"},
+		{"AIS header", kk, func(d *CharaDump) { d.Game = gameAIS }, "AIS Chara mark not found"},
+		{"KK number version", kk, func(d *CharaDump) { d.Blocks[0].Version = 1.0 }, "is not a string"},
+		{"HS string version", hs, func(d *CharaDump) { d.Blocks[0].Version = "0.0.0" }, "is not an int32"},
+		{"bad layout", kk, func(d *CharaDump) { d.Blocks[0].Layout = "nope" }, "unknown layout"},
+		{"PH two blocks", ph, func(d *CharaDump) { d.Blocks = append(d.Blocks, d.Blocks[0]) }, "one CustomParameter block"},
+		{"PH marker", ph, func(d *CharaDump) { d.Header = json.RawMessage(`{"marker":"nope"}`) }, "PH Chara mark not found"},
+	}
+	for _, tt := range tests {
+		dump := tt.dump
+		dump.Blocks = append([]BlockDump{}, tt.dump.Blocks...)
+		tt.edit(&dump)
+
+		var h CardHandlers
+		err := h.loadDump(dump)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -1,17 +1,14 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/binary"
-	"errors"
 	"fmt"
 	"image"
-	"image/color"
-	"image/png"
+	"image/draw"
 	"io"
 
 	"github.com/sulfur/bbio"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 func printError(err error) {
@@ -19,114 +16,96 @@ func printError(err error) {
 	fmt.Println("\033[97;101m ERROR \033[0m", "\033[31m", msg, "\033[0m")
 }
 
-func createPng(width int, height int, sex int) ([]byte, error) {
-	upLeft := image.Point{0, 0}
-	lowRight := image.Point{width, height}
-
-	img := image.NewRGBA(image.Rectangle{upLeft, lowRight})
-
-	bkgColorMale := color.RGBA{0x0, 0x0, 0xff, 0xff}
-	bkgColorFemale := color.RGBA{0xff, 0x80, 0xff, 0xff}
-
-	// Set color for each pixel.
-	for x := 0; x < width; x++ {
-		for y := 0; y < height; y++ {
-			if sex == 0 {
-				img.Set(x, y, bkgColorMale)
-			} else {
-				img.Set(x, y, bkgColorFemale)
-			}
-		}
-	}
+func printWarning(err error) {
+	msg := fmt.Sprint(err)
+	fmt.Println("\033[30;103m WARN \033[0m", "\033[33m", msg, "\033[0m")
+}
 
-	buf := new(bytes.Buffer)
-	bufr := bufio.NewWriter(buf)
-	err := png.Encode(bufr, img)
+// decodeMsgMap only accepts string keys, so odd maps fail with an error
+// instead of building an unhashable map type
+func decodeMsgMap(d *msgpack.Decoder) (interface{}, error) {
+	n, err := d.DecodeMapLen()
 	if err != nil {
 		return nil, err
 	}
-
-	ferr := bufr.Flush()
-	if ferr != nil {
-		return nil, err
+	if n == -1 {
+		return nil, nil
 	}
 
-	pngBytes := buf.Bytes()
-	return pngBytes, nil
-}
-
-func getPngSize(reader *bbio.Reader) int64 {
-	pngEndChunk := []byte{0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82}
-	pngEndIdx := reader.Index(pngEndChunk)
-	return int64(pngEndIdx + len(pngEndChunk))
+	m := make(map[string]interface{})
+	for i := 0; i < n; i++ {
+		k, kErr := d.DecodeString()
+		if kErr != nil {
+			return nil, kErr
+		}
+		v, vErr := d.DecodeInterface()
+		if vErr != nil {
+			return nil, vErr
+		}
+		m[k] = v
+	}
+	return m, nil
 }
 
-func checkPngData(r io.ReadSeeker) (size int64, err error) {
-	pngStartChunk := []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
-
-	size = 0
-	// sr := io.NewSectionReader(r)
-	reader := bufio.NewReader(r)
+func unmarshalMsgMap(data []byte) (m map[string]interface{}, err error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetDecodeMapFunc(decodeMsgMap)
 
-	startLen := len(pngStartChunk)
-	bufStart := make([]byte, startLen)
-
-	n, sErr := reader.Read(bufStart)
-	if sErr != nil {
-		err = sErr
-		return
-	}
-	if n != startLen {
-		err = errors.New("Too small for png")
+	v, vErr := dec.DecodeInterface()
+	if vErr != nil {
+		err = vErr
 		return
 	}
-	for i := 0; i < n; i++ {
-		if pngStartChunk[i] != bufStart[i] {
-			err = errors.New("Png start not found")
-			return
-		}
-	}
-
-	var rn, pos int
-	var rErr error
 
-	for {
-		readBuf := make([]byte, 4)
-		rn, rErr = reader.Read(bufStart)
-		if rErr != nil {
-			err = rErr
-			return
-		}
-		if rn != 4 {
-			err = io.EOF
-			return
-		}
+	m, err = bbio.Cast.Value("", v).Map()
+	return
+}
 
-		first := binary.BigEndian.Uint32(readBuf)
-		rn, rErr = reader.Read(bufStart)
-		if rErr != nil {
-			err = rErr
-			return
-		}
+// rawRange returns the original bytes between start and end, nil when
+// the range is outside of the reader
+func rawRange(reader *bbio.Reader, start int64, end int64) []byte {
+	buf := reader.Buffer()
+	if start < 0 || end < start || end > int64(len(buf)) {
+		return nil
+	}
+	return buf[start:end]
+}
 
-		second := binary.LittleEndian.Uint32(readBuf)
-		if second != 1145980233 {
-			break
-		}
+func compareBlockData(name string, want []byte, got []byte) error {
+	if !bytes.Equal(want, got) {
+		return fmt.Errorf("Block '%s' differs after write (%d bytes, want %d)", name, len(got), len(want))
+	}
+	return nil
+}
 
-		offset := int(first + 4)
-		if offset > reader.Size() {
-			return
-		}
+func createPng(width int, height int, sex int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(thumbColor(int32(sex))), image.Point{}, draw.Src)
+	return encodeThumb(img)
+}
 
-		_, snErr := r.Seek(int64(offset), io.SeekCurrent)
-		if snErr != nil {
-			return
+// readCardMark reads the marker string of a chara card, skip bytes after the png
+func readCardMark(reader *bbio.Reader, pngSize int64, skip int64) (mark string) {
+	defer func() {
+		if recover() != nil {
+			mark = ""
 		}
+	}()
 
-		pos += offset
+	_, seekErr := reader.Seek(pngSize+skip, io.SeekStart)
+	if seekErr != nil {
+		return
 	}
-
-	size = int64(pos)
+	mark, _ = reader.ReadString()
 	return
 }
+
+// getPngSize is the end of the png at the start of reader, 0 without a
+// valid png
+func getPngSize(reader *bbio.Reader) int64 {
+	size, err := checkPngData(reader.Buffer())
+	if err != nil {
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/sulfur/bbio"
+)
+
+var kkClothesMark = "【KoiKatuClothes】"
+var kkClothesVersion = "0.0.0"
+var aisClothesMark = "【AIS_Clothes】"
+var aisClothesVersion = "0.0.0"
+
+// marker and version of the plugin data trailer ExtendedSave appends to
+// coordinate cards
+var extSaveMark = "KKEx"
+var extSaveVersion int32 = 3
+
+// KKEx plugins of AIS / HS2 charas that save outfit and accessory data,
+// carried over to clothes cards. Body and face plugins are left out
+var aisCoordExtPlugins = []string{
+	"KCOX",
+	"com.joan6694.illusionplugins.moreaccessories",
+	"com.deathweasel.bepinex.materialeditor",
+	"com.deathweasel.bepinex.hairaccessorycustomizer",
+	"com.deathweasel.bepinex.dynamicboneeditor",
+	"com.deathweasel.bepinex.clothingunlocker",
+}
+
+// KKExData strcture, the plugin map of a KKEx block, entries kept as raw
+// msgpack
+type KKExData struct {
+	msgRaw
+}
+
+// filterKKEx keeps the entries of plugins in a KKEx block, in their order.
+// ext is nil when none of them saved data
+func filterKKEx(data []byte, plugins []string) (ext []byte, err error) {
+	var all KKExData
+	err = unmarshalModel(data, &all)
+	if err != nil {
+		return
+	}
+
+	keep := make(map[string]bool)
+	for _, v := range plugins {
+		keep[v] = true
+	}
+
+	filtered := KKExData{msgRaw{decoded: true, code: all.code}}
+	for i, key := range all.keys {
+		if keep[key] {
+			filtered.keys = append(filtered.keys, key)
+			filtered.rawKeys = append(filtered.rawKeys, all.rawKeys[i])
+			filtered.values = append(filtered.values, all.values[i])
+		}
+	}
+	if len(filtered.keys) == 0 {
+		return
+	}
+
+	ext, err = marshalModel(&filtered)
+	return
+}
+
+// coordinate slot names of a Koikatsu chara
+var kkCoordinateNames = []string{"School Uniform", "Going Home", "Gym Clothes", "Swimsuit", "Club Activities", "Casual", "Sleepwear"}
+
+// KKCoordinateCard strcture, one outfit slot of a KK chara
+type KKCoordinateCard struct {
+	name string
+	// sex of the chara the outfit came from, thumbnail colour only
+	sex  int32
+	data []byte
+}
+
+func kkCoordinateName(slot int, count int) string {
+	if count == len(kkCoordinateNames) {
+		return kkCoordinateNames[slot]
+	}
+	return fmt.Sprintf("Outfit %d", slot+1)
+}
+
+// CoordinateCards implements for KKChara, one card per coordinate slot with
+// the slot bytes as they are in the chara
+func (sf *KKChara) CoordinateCards(card KKCharaCard) (lst []KKCoordinateCard, err error) {
+	lstData, sErr := splitKKCoordinates(card.data["Coordinate"])
+	if sErr != nil {
+		err = fmt.Errorf("Coordinate block: %v", sErr)
+		return
+	}
+
+	name := card.fullname()
+	for i, data := range lstData {
+		coordName := kkCoordinateName(i, len(lstData))
+		if name != "" {
+			coordName = name + " - " + coordName
+		}
+		lst = append(lst, KKCoordinateCard{name: coordName, sex: card.sex, data: data})
+	}
+	return
+}
+
+// ReadCoordinate implements for KKChara
+func (sf *KKChara) ReadCoordinate(reader *bbio.Reader, pngSize int64) (coord KKCoordinateCard, err error) {
+	defer recoverParse(&err)
+
+	_, seekErr := reader.Seek(pngSize, io.SeekStart)
+	if seekErr != nil {
+		err = seekErr
+		return
+	}
+
+	_, pnErr := reader.ReadInt32()
+	if pnErr != nil {
+		err = pnErr
+		return
+	}
+
+	mark, mErr := reader.ReadString()
+	if mErr != nil {
+		err = mErr
+		return
+	}
+	if mark != kkClothesMark {
+		err = errors.New("KK coordinate mark not found")
+		return
+	}
+
+	_, vErr := reader.ReadString()
+	if vErr != nil {
+		err = vErr
+		return
+	}
+
+	coord.name, err = reader.ReadString()
+	if err != nil {
+		return
+	}
+
+	size, sErr := reader.ReadInt32()
+	if sErr != nil {
+		err = sErr
+		return
+	}
+	coord.data, err = readBlock(reader, int64(size))
+	return
+}
+
+// WriteCoordinate implements for KKChara, the layout of the game coordinate
+// cards
+func (sf *KKChara) WriteCoordinate(coord KKCoordinateCard, w io.Writer) (re bool, err error) {
+	re = false
+	writer := bbio.NewWriterBuffer()
+
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, nil, ThumbInfo{game: gameKK, sex: coord.sex, name: coord.name})
+	if pngErr != nil {
+		err = pngErr
+		return
+	}
+
+	_, pwErr := writer.Write(pngBytes)
+	if pwErr != nil {
+		err = pwErr
+		return
+	}
+
+	pnErr := writer.WriteInt(100)
+	if pnErr != nil {
+		err = pnErr
+		return
+	}
+
+	_, mErr := writer.WriteString(kkClothesMark)
+	if mErr != nil {
+		err = mErr
+		return
+	}
+
+	_, vErr := writer.WriteString(kkClothesVersion)
+	if vErr != nil {
+		err = vErr
+		return
+	}
+
+	_, nErr := writer.WriteString(coord.name)
+	if nErr != nil {
+		err = nErr
+		return
+	}
+
+	sErr := writer.WriteInt(int32(len(coord.data)))
+	if sErr != nil {
+		err = sErr
+		return
+	}
+
+	_, dErr := writer.Write(coord.data)
+	if dErr != nil {
+		err = dErr
+		return
+	}
+
+	_, wtErr := writer.WriteTo(w)
+	if wtErr != nil {
+		err = wtErr
+		return
+	}
+
+	re = true
+	return
+}
+
+// WriteCoordinateFile implements for KKChara
+func (sf *KKChara) WriteCoordinateFile(coord KKCoordinateCard, filePath string) (re bool, err error) {
+	re = false
+	f, cErr := os.Create(filePath)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	defer f.Close()
+
+	return sf.WriteCoordinate(coord, bufio.NewWriter(f))
+}
+
+// VerifyCoordinateFile implements for KKChara, re-reads a written card and
+// checks the outfit bytes and that they still parse
+func (sf *KKChara) VerifyCoordinateFile(coord KKCoordinateCard, filePath string) (err error) {
+	fileBytes, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	reader := bbio.NewReaderBytes(fileBytes)
+	written, wErr := sf.ReadCoordinate(reader, getPngSize(reader))
+	if wErr != nil {
+		err = wErr
+		return
+	}
+
+	if written.name != coord.name {
+		err = fmt.Errorf("Coordinate name differs after write (%s, want %s)", written.name, coord.name)
+		return
+	}
+	if !bytes.Equal(written.data, coord.data) {
+		err = errors.New("Coordinate data differs after write")
+		return
+	}
+
+	_, err = parseKKCoordinate(written.data)
+	return
+}
+
+// ExtractCoordinates implements for KKChara, writes every coordinate slot of
+// every chara as a coordinate card
+func (sf *KKChara) ExtractCoordinates(currDir string, opts ExtractOptions, report *ExtractReport) (err error) {
+	sf.thumb = opts.thumb
+	sf.meta = opts.cardMeta
+
+	if opts.skipGame(gameKK) {
+		return
+	}
+
+	for k, v := range sf.card.charaCards {
+		if opts.skipSex(v.sex) {
+			continue
+		}
+
+		lst, cErr := sf.CoordinateCards(v)
+		if cErr != nil {
+			printError(fmt.Errorf("%s: %v", k, cErr))
+			continue
+		}
+
+		for i, coord := range lst {
+			report.found(gameKK)
+
+			var c int
+			base := fmt.Sprintf("%s_coordinate_%d", k, i+1)
+			saveFilePath := path.Join(currDir, base+".png")
+			for {
+				_, fErr := os.Stat(saveFilePath)
+				if os.IsNotExist(fErr) {
+					break
+				}
+				c++
+				saveFilePath = path.Join(currDir, fmt.Sprintf("%s-%d.png", base, c))
+			}
+
+			_, saveErr := sf.WriteCoordinateFile(coord, saveFilePath)
+			if saveErr != nil {
+				printError(saveErr)
+				continue
+			}
+			report.wrote(gameKK)
+
+			if opts.verify {
+				vErr := sf.VerifyCoordinateFile(coord, saveFilePath)
+				if vErr != nil {
+					printError(fmt.Errorf("%s: %v", saveFilePath, vErr))
+					report.verifyFailed(gameKK)
+				}
+			}
+		}
+	}
+	return
+}
+
+// AISCoordinateCard strcture, the outfit of an AIS / HS2 chara
+type AISCoordinateCard struct {
+	name     string
+	gameType string
+	sex      int32
+	version  string
+	language int32
+	data     []byte
+	// KKEx plugin data, nil without
+	ext []byte
+}
+
+// CoordinateCard implements for AISChara, the Coordinate block as it is in
+// the chara. The KKEx block of the chara holds body and face plugin data as
+// well, so only the outfit and accessory plugins are copied unless coordExt
+// asks for the whole block
+func (sf *AISChara) CoordinateCard(card AISCharaCard) (coord AISCoordinateCard, err error) {
+	data, ok := card.data["Coordinate"]
+	if !ok {
+		err = errors.New("Coordinate block not found")
+		return
+	}
+
+	_, pErr := parseAISCoordinate(data)
+	if pErr != nil {
+		err = fmt.Errorf("Coordinate block: %v", pErr)
+		return
+	}
+
+	version := card.findInfo("Coordinate").version
+	if version == "" {
+		version = aisClothesVersion
+	}
+
+	coord = AISCoordinateCard{
+		name:     card.fullname,
+		gameType: card.gameType,
+		sex:      card.sex,
+		version:  version,
+		language: card.language,
+		data:     data,
+	}
+
+	ext := card.data["KKEx"]
+	if sf.coordExt || ext == nil {
+		coord.ext = ext
+		return
+	}
+
+	var eErr error
+	coord.ext, eErr = filterKKEx(ext, aisCoordExtPlugins)
+	if eErr != nil {
+		printWarning(fmt.Errorf("KKEx block of '%s' not copied: %v", card.fullname, eErr))
+	}
+	return
+}
+
+// ReadCoordinate implements for AISChara
+func (sf *AISChara) ReadCoordinate(reader *bbio.Reader, pngSize int64) (coord AISCoordinateCard, err error) {
+	defer recoverParse(&err)
+
+	_, seekErr := reader.Seek(pngSize, io.SeekStart)
+	if seekErr != nil {
+		err = seekErr
+		return
+	}
+
+	_, pnErr := reader.ReadInt32()
+	if pnErr != nil {
+		err = pnErr
+		return
+	}
+
+	mark, mErr := reader.ReadString()
+	if mErr != nil {
+		err = mErr
+		return
+	}
+	if mark != aisClothesMark {
+		err = errors.New("AIS coordinate mark not found")
+		return
+	}
+
+	coord.version, err = reader.ReadString()
+	if err != nil {
+		return
+	}
+
+	coord.language, err = reader.ReadInt32()
+	if err != nil {
+		return
+	}
+
+	coord.name, err = reader.ReadString()
+	if err != nil {
+		return
+	}
+
+	size, sErr := reader.ReadInt32()
+	if sErr != nil {
+		err = sErr
+		return
+	}
+	coord.data, err = readBlock(reader, int64(size))
+	if err != nil || reader.Len() == 0 {
+		return
+	}
+
+	extMark, emErr := reader.ReadString()
+	if emErr != nil || extMark != extSaveMark {
+		return
+	}
+
+	_, evErr := reader.ReadInt32()
+	if evErr != nil {
+		err = evErr
+		return
+	}
+
+	extSize, esErr := reader.ReadInt32()
+	if esErr != nil {
+		err = esErr
+		return
+	}
+	coord.ext, err = readBlock(reader, int64(extSize))
+	return
+}
+
+// WriteCoordinate implements for AISChara, the layout of the game clothes
+// cards followed by the ExtendedSave trailer
+func (sf *AISChara) WriteCoordinate(coord AISCoordinateCard, w io.Writer) (re bool, err error) {
+	re = false
+	writer := bbio.NewWriterBuffer()
+
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, nil, ThumbInfo{game: coord.gameType, sex: coord.sex, name: coord.name})
+	if pngErr != nil {
+		err = pngErr
+		return
+	}
+
+	_, pwErr := writer.Write(pngBytes)
+	if pwErr != nil {
+		err = pwErr
+		return
+	}
+
+	pnErr := writer.WriteInt(100)
+	if pnErr != nil {
+		err = pnErr
+		return
+	}
+
+	_, mErr := writer.WriteString(aisClothesMark)
+	if mErr != nil {
+		err = mErr
+		return
+	}
+
+	_, vErr := writer.WriteString(coord.version)
+	if vErr != nil {
+		err = vErr
+		return
+	}
+
+	lErr := writer.WriteInt(coord.language)
+	if lErr != nil {
+		err = lErr
+		return
+	}
+
+	_, nErr := writer.WriteString(coord.name)
+	if nErr != nil {
+		err = nErr
+		return
+	}
+
+	sErr := writer.WriteInt(int32(len(coord.data)))
+	if sErr != nil {
+		err = sErr
+		return
+	}
+
+	_, dErr := writer.Write(coord.data)
+	if dErr != nil {
+		err = dErr
+		return
+	}
+
+	if coord.ext != nil {
+		_, emErr := writer.WriteString(extSaveMark)
+		if emErr != nil {
+			err = emErr
+			return
+		}
+
+		evErr := writer.WriteInt(extSaveVersion)
+		if evErr != nil {
+			err = evErr
+			return
+		}
+
+		esErr := writer.WriteInt(int32(len(coord.ext)))
+		if esErr != nil {
+			err = esErr
+			return
+		}
+
+		_, edErr := writer.Write(coord.ext)
+		if edErr != nil {
+			err = edErr
+			return
+		}
+	}
+
+	_, wtErr := writer.WriteTo(w)
+	if wtErr != nil {
+		err = wtErr
+		return
+	}
+
+	re = true
+	return
+}
+
+// WriteCoordinateFile implements for AISChara
+func (sf *AISChara) WriteCoordinateFile(coord AISCoordinateCard, filePath string) (re bool, err error) {
+	re = false
+	f, cErr := os.Create(filePath)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	defer f.Close()
+
+	return sf.WriteCoordinate(coord, bufio.NewWriter(f))
+}
+
+// VerifyCoordinateFile implements for AISChara, re-reads a written card and
+// checks the outfit and plugin bytes
+func (sf *AISChara) VerifyCoordinateFile(coord AISCoordinateCard, filePath string) (err error) {
+	fileBytes, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	reader := bbio.NewReaderBytes(fileBytes)
+	written, wErr := sf.ReadCoordinate(reader, getPngSize(reader))
+	if wErr != nil {
+		err = wErr
+		return
+	}
+
+	if written.name != coord.name || written.version != coord.version || written.language != coord.language {
+		err = fmt.Errorf("Coordinate header differs after write (%s %s, want %s %s)", written.name, written.version, coord.name, coord.version)
+		return
+	}
+	if !bytes.Equal(written.data, coord.data) {
+		err = errors.New("Coordinate data differs after write")
+		return
+	}
+	if !bytes.Equal(written.ext, coord.ext) {
+		err = errors.New("Coordinate plugin data differs after write")
+		return
+	}
+
+	_, err = parseAISCoordinate(written.data)
+	return
+}
+
+// ExtractCoordinates implements for AISChara, writes the outfit of every
+// chara as a clothes card
+func (sf *AISChara) ExtractCoordinates(currDir string, opts ExtractOptions, report *ExtractReport) (err error) {
+	sf.thumb = opts.thumb
+	sf.meta = opts.cardMeta
+	sf.coordExt = opts.coordExt
+
+	for k, v := range sf.card.charaCards {
+		if opts.skipGame(v.gameType) {
+			continue
+		}
+
+		if opts.skipSex(v.sex) {
+			continue
+		}
+
+		coord, cErr := sf.CoordinateCard(v)
+		if cErr != nil {
+			printError(fmt.Errorf("%s: %v", k, cErr))
+			continue
+		}
+		report.found(v.gameType)
+
+		var c int
+		base := k + "_coordinate"
+		saveFilePath := path.Join(currDir, base+".png")
+		for {
+			_, fErr := os.Stat(saveFilePath)
+			if os.IsNotExist(fErr) {
+				break
+			}
+			c++
+			saveFilePath = path.Join(currDir, fmt.Sprintf("%s-%d.png", base, c))
+		}
+
+		_, saveErr := sf.WriteCoordinateFile(coord, saveFilePath)
+		if saveErr != nil {
+			printError(saveErr)
+			continue
+		}
+		report.wrote(v.gameType)
+
+		if opts.verify {
+			vErr := sf.VerifyCoordinateFile(coord, saveFilePath)
+			if vErr != nil {
+				printError(fmt.Errorf("%s: %v", saveFilePath, vErr))
+				report.verifyFailed(v.gameType)
+			}
+		}
+	}
+	return
+}
+
+// extractCoordinates writes the coordinate cards of every KK, AIS and HS2
+// chara in a card. Without a thumbnail mode the cards get a label with the
+// outfit name
+func extractCoordinates(currDir string, filePath string, opts ExtractOptions, full bool) (report ExtractReport, err error) {
+	h, lErr := loadCard(filePath, full)
+	if lErr != nil {
+		err = lErr
+		return
+	}
+	if h.kk == nil && h.ais == nil {
+		return
+	}
+
+	opts.thumb, err = newThumbnailer(opts, filepath.Base(filePath), h.shot)
+	if err != nil {
+		return
+	}
+	if opts.thumb == nil {
+		opts.thumb = LabelThumb{scene: filepath.Base(filePath)}
+	}
+
+	if opts.meta {
+		opts.cardMeta, err = newCardMeta(filePath)
+		if err != nil {
+			return
+		}
+	}
+
+	if h.ais != nil {
+		err = h.ais.ExtractCoordinates(currDir, opts, &report)
+		if err != nil {
+			return
+		}
+	}
+
+	if h.kk != nil {
+		err = h.kk.ExtractCoordinates(currDir, opts, &report)
+	}
+	return
+}
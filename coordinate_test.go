@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sulfur/bbio"
+)
+
+func TestKKCoordinateCards(t *testing.T) {
+	card := testKKCard(t)
+	h := NewKKChara()
+	lst, err := h.CoordinateCards(card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lst) != 7 {
+		t.Fatalf("split into %d coordinates, want 7", len(lst))
+	}
+
+	dir := t.TempDir()
+	for i, coord := range lst {
+		want := "Sato Yui - " + kkCoordinateNames[i]
+		if coord.name != want || coord.sex != 1 || !bytes.Equal(coord.data, testKKCoordinate(t, i)) {
+			t.Errorf("slot %d: %q sex %d", i, coord.name, coord.sex)
+		}
+
+		filePath := filepath.Join(dir, kkCoordinateNames[i]+".png")
+		if _, wErr := h.WriteCoordinateFile(coord, filePath); wErr != nil {
+			t.Fatal(wErr)
+		}
+		if vErr := h.VerifyCoordinateFile(coord, filePath); vErr != nil {
+			t.Fatalf("slot %d: %v", i, vErr)
+		}
+
+		// game layout: product no, mark, version, name, then the sized outfit
+		b, rErr := ioutil.ReadFile(filePath)
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		reader := bbio.NewReaderBytes(b)
+		pngSize := getPngSize(reader)
+		if _, sErr := reader.Seek(pngSize, io.SeekStart); sErr != nil {
+			t.Fatal(sErr)
+		}
+		productNo, pErr := reader.ReadInt32()
+		mark, mErr := reader.ReadString()
+		version, vErr := reader.ReadString()
+		name, nErr := reader.ReadString()
+		size, zErr := reader.ReadInt32()
+		if pErr != nil || mErr != nil || vErr != nil || nErr != nil || zErr != nil {
+			t.Fatalf("slot %d: %v %v %v %v %v", i, pErr, mErr, vErr, nErr, zErr)
+		}
+		if productNo != 100 || mark != "【KoiKatuClothes】" || version != "0.0.0" || name != want || int(size) != len(coord.data) {
+			t.Errorf("slot %d: product %d mark %s version %s name %q size %d", i, productNo, mark, version, name, size)
+		}
+
+		written, cErr := h.ReadCoordinate(reader, pngSize)
+		if cErr != nil {
+			t.Fatal(cErr)
+		}
+		parsed, pcErr := parseKKCoordinate(written.data)
+		if pcErr != nil {
+			t.Fatal(pcErr)
+		}
+		if len(parsed.Clothes.Parts) != 1 || parsed.Clothes.Parts[0].ID != int32(i) {
+			t.Errorf("slot %d: read back the wrong outfit", i)
+		}
+	}
+}
+
+func TestAISCoordinateExt(t *testing.T) {
+	body := []byte{1}
+	overlay := []byte{2, 2}
+	accessories := []byte{3, 3, 3}
+	mixed := testMsgMap(t, "com.example.body", body, "KCOX", overlay, "com.joan6694.illusionplugins.moreaccessories", accessories)
+
+	tests := []struct {
+		name     string
+		kkex     []byte
+		coordExt bool
+		want     []byte
+	}{
+		{"outfit plugins", mixed, false, testMsgMap(t, "KCOX", overlay, "com.joan6694.illusionplugins.moreaccessories", accessories)},
+		{"coordExt", mixed, true, mixed},
+		{"body plugin only", testMsgMap(t, "com.example.body", body), false, nil},
+		{"no KKEx", nil, false, nil},
+		{"broken KKEx", []byte{0xc1}, false, nil},
+	}
+	for _, tt := range tests {
+		card := testAISCard(t)
+		delete(card.data, "KKEx")
+		if tt.kkex != nil {
+			card.data["KKEx"] = tt.kkex
+		}
+
+		h := NewAISChara()
+		h.coordExt = tt.coordExt
+		var coord AISCoordinateCard
+		var err error
+		out := testStdout(t, func() { coord, err = h.CoordinateCard(card) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.name == "broken KKEx" && !strings.Contains(out, "KKEx block of 'Ai' not copied") {
+			t.Errorf("%s: warning %q", tt.name, out)
+		}
+
+		var b bytes.Buffer
+		if _, wErr := h.WriteCoordinate(coord, &b); wErr != nil {
+			t.Fatal(wErr)
+		}
+		reader := bbio.NewReaderBytes(b.Bytes())
+		written, rErr := h.ReadCoordinate(reader, getPngSize(reader))
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		if !bytes.Equal(written.data, card.data["Coordinate"]) {
+			t.Errorf("%s: outfit changed", tt.name)
+		}
+
+		// the clothes card ends with the outfit without plugin data
+		if tt.want == nil {
+			if written.ext != nil || !bytes.HasSuffix(b.Bytes(), card.data["Coordinate"]) {
+				t.Errorf("%s: KKEx copied", tt.name)
+			}
+			continue
+		}
+
+		// ExtendedSave trailer: mark, version, length then the plugin data
+		trailer := bbio.NewReaderBytes(b.Bytes())
+		tail := int64(len(extSaveMark) + 1 + 4 + 4 + len(tt.want))
+		if _, sErr := trailer.Seek(int64(b.Len())-tail, io.SeekStart); sErr != nil {
+			t.Fatal(sErr)
+		}
+		mark, mErr := trailer.ReadString()
+		version, vErr := trailer.ReadInt32()
+		size, zErr := trailer.ReadInt32()
+		if mErr != nil || vErr != nil || zErr != nil {
+			t.Fatalf("%s: trailer: %v %v %v", tt.name, mErr, vErr, zErr)
+		}
+		if mark != extSaveMark || version != extSaveVersion || version != 3 || int(size) != len(tt.want) {
+			t.Errorf("%s: trailer %s version %d size %d", tt.name, mark, version, size)
+		}
+		if data := b.Bytes()[int64(b.Len())-int64(size):]; !bytes.Equal(data, tt.want) || !bytes.Equal(written.ext, tt.want) {
+			t.Errorf("%s: plugin data %v, read back %v, want %v", tt.name, data, written.ext, tt.want)
+		}
+		outfitEnd := int64(b.Len()) - tail
+		if !bytes.HasSuffix(b.Bytes()[:outfitEnd], card.data["Coordinate"]) {
+			t.Errorf("%s: trailer does not follow the outfit", tt.name)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CharaDump strcture, the JSON form of one chara
+type CharaDump struct {
+	Game   string          `json:"game"`
+	Name   string          `json:"name"`
+	Sex    int32           `json:"sex"`
+	Header json.RawMessage `json:"header"`
+	Blocks []BlockDump     `json:"blocks"`
+}
+
+// BlockDump strcture, one block of a chara with its lstInfo entry
+type BlockDump struct {
+	Name string `json:"name"`
+	// string for KK / AIS, number for HS and PH
+	Version interface{} `json:"version"`
+	Pos     int64       `json:"pos"`
+	Size    int64       `json:"size"`
+	msgLayout
+}
+
+// KKDumpHeader strcture
+type KKDumpHeader struct {
+	LoadProductNo int32  `json:"loadProductNo"`
+	Marker        string `json:"marker"`
+	LoadVersion   string `json:"loadVersion"`
+	Face          []byte `json:"face"`
+}
+
+// AISDumpHeader strcture
+type AISDumpHeader struct {
+	LoadProductNo int32  `json:"loadProductNo"`
+	Marker        string `json:"marker"`
+	LoadVersion   string `json:"loadVersion"`
+	Language      int32  `json:"language"`
+	UserID        string `json:"userID"`
+	DataID        string `json:"dataID"`
+}
+
+// HSDumpHeader strcture
+type HSDumpHeader struct {
+	Marker      string `json:"marker"`
+	LoadVersion int32  `json:"loadVersion"`
+	Signature   string `json:"signature"`
+}
+
+// phDumpBlock is the one block of a dumped PlayHome chara
+const phDumpBlock = "CustomParameter"
+
+// PHDumpHeader strcture
+type PHDumpHeader struct {
+	Marker string `json:"marker"`
+}
+
+func newBlockDump(name string, version interface{}, pos int64, data []byte) BlockDump {
+	layout, _ := decodeLayout(data, false, 0)
+	return BlockDump{
+		Name:      name,
+		Version:   version,
+		Pos:       pos,
+		Size:      int64(len(data)),
+		msgLayout: layout,
+	}
+}
+
+// dumpBlockRef strcture, the lstInfo entry of a dumped block
+type dumpBlockRef struct {
+	name    string
+	version interface{}
+	pos     int64
+}
+
+// newCharaDump dumps the header and the blocks of one chara in lstInfo order
+func newCharaDump(game string, name string, sex int32, header interface{}, refs []dumpBlockRef, data map[string][]byte) (dump CharaDump, err error) {
+	hb, hErr := json.Marshal(header)
+	if hErr != nil {
+		err = hErr
+		return
+	}
+	dump = CharaDump{Game: game, Name: name, Sex: sex, Header: hb}
+	for _, ref := range refs {
+		dump.Blocks = append(dump.Blocks, newBlockDump(ref.name, ref.version, ref.pos, data[ref.name]))
+	}
+	return
+}
+
+// DumpChara implements for KKChara
+func (sf *KKChara) DumpChara(card KKCharaCard) (dump CharaDump, err error) {
+	header := KKDumpHeader{
+		LoadProductNo: card.loadProductNo,
+		Marker:        card.marker,
+		LoadVersion:   card.loadVersion,
+		Face:          card.faceData,
+	}
+	refs := make([]dumpBlockRef, 0, len(card.infoHeader.lstInfo))
+	for _, info := range card.infoHeader.lstInfo {
+		refs = append(refs, dumpBlockRef{name: info.name, version: info.version, pos: info.pos})
+	}
+	return newCharaDump(gameKK, card.fullname(), card.sex, header, refs, card.data)
+}
+
+// DumpCharas implements for KKChara
+func (sf *KKChara) DumpCharas(opts ExtractOptions) (lst []CharaDump, err error) {
+	keys := make([]string, 0, len(sf.card.charaCards))
+	for k := range sf.card.charaCards {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := sf.card.charaCards[k]
+		if opts.skipGame(gameKK) || opts.skipSex(v.sex) {
+			continue
+		}
+
+		dump, dErr := sf.DumpChara(v)
+		if dErr != nil {
+			err = dErr
+			return
+		}
+		lst = append(lst, dump)
+	}
+	return
+}
+
+// DumpChara implements for AISChara
+func (sf *AISChara) DumpChara(card AISCharaCard) (dump CharaDump, err error) {
+	header := AISDumpHeader{
+		LoadProductNo: card.loadProductNo,
+		Marker:        card.marker,
+		LoadVersion:   card.loadVersion,
+		Language:      card.language,
+		UserID:        card.userID,
+		DataID:        card.dataID,
+	}
+	refs := make([]dumpBlockRef, 0, len(card.infoHeader.lstInfo))
+	for _, info := range card.infoHeader.lstInfo {
+		refs = append(refs, dumpBlockRef{name: info.name, version: info.version, pos: info.pos})
+	}
+	return newCharaDump(card.gameType, card.fullname, card.sex, header, refs, card.data)
+}
+
+// DumpCharas implements for AISChara
+func (sf *AISChara) DumpCharas(opts ExtractOptions) (lst []CharaDump, err error) {
+	keys := make([]string, 0, len(sf.card.charaCards))
+	for k := range sf.card.charaCards {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := sf.card.charaCards[k]
+		if opts.skipGame(v.gameType) || opts.skipSex(v.sex) {
+			continue
+		}
+
+		dump, dErr := sf.DumpChara(v)
+		if dErr != nil {
+			err = dErr
+			return
+		}
+		lst = append(lst, dump)
+	}
+	return
+}
+
+// DumpChara implements for HSChara, HS blocks are not msgpack and stay binary
+func (sf *HSChara) DumpChara(card HSCharaCard) (dump CharaDump, err error) {
+	status, _ := card.signatureStatus()
+	header := HSDumpHeader{
+		Marker:      card.marker,
+		LoadVersion: card.loadVersion,
+		Signature:   status,
+	}
+	refs := make([]dumpBlockRef, 0, len(card.infoHeader.lstInfo))
+	for _, info := range card.infoHeader.lstInfo {
+		refs = append(refs, dumpBlockRef{name: info.Name, version: info.Version, pos: info.Pos})
+	}
+	return newCharaDump(gameHS, card.name, card.sex, header, refs, card.data)
+}
+
+// DumpCharas implements for HSChara
+func (sf *HSChara) DumpCharas(opts ExtractOptions) (lst []CharaDump, err error) {
+	keys := make([]string, 0, len(sf.card.charaCards))
+	for k := range sf.card.charaCards {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := sf.card.charaCards[k]
+		if opts.skipGame(gameHS) || opts.skipSex(v.sex) {
+			continue
+		}
+
+		dump, dErr := sf.DumpChara(v)
+		if dErr != nil {
+			err = dErr
+			return
+		}
+		lst = append(lst, dump)
+	}
+	return
+}
+
+// DumpChara implements for PHChara, the CustomParameter is one opaque block
+func (sf *PHChara) DumpChara(card PHCharaCard) (dump CharaDump, err error) {
+	sexInfo, sexErr := phSexByCustom(card.sex)
+	if sexErr != nil {
+		err = sexErr
+		return
+	}
+
+	refs := []dumpBlockRef{{name: phDumpBlock, version: card.version}}
+	return newCharaDump(gamePH, card.name, sexInfo.sex, PHDumpHeader{Marker: sexInfo.marker}, refs, map[string][]byte{phDumpBlock: card.rawData})
+}
+
+// DumpCharas implements for PHChara
+func (sf *PHChara) DumpCharas(opts ExtractOptions) (lst []CharaDump, err error) {
+	keys := make([]string, 0, len(sf.card.charaCards))
+	for k := range sf.card.charaCards {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := sf.card.charaCards[k]
+		sexInfo, sexErr := phSexByCustom(v.sex)
+		if sexErr != nil {
+			printError(sexErr)
+			continue
+		}
+		if opts.skipGame(gamePH) || opts.skipSex(sexInfo.sex) {
+			continue
+		}
+
+		dump, dErr := sf.DumpChara(v)
+		if dErr != nil {
+			err = dErr
+			return
+		}
+		lst = append(lst, dump)
+	}
+	return
+}
+
+// DumpCharas implements for CardHandlers
+func (h *CardHandlers) DumpCharas(opts ExtractOptions) (lst []CharaDump, err error) {
+	var part []CharaDump
+
+	if h.ph != nil {
+		part, err = h.ph.DumpCharas(opts)
+		if err != nil {
+			return
+		}
+		lst = append(lst, part...)
+	}
+
+	if h.ais != nil {
+		part, err = h.ais.DumpCharas(opts)
+		if err != nil {
+			return
+		}
+		lst = append(lst, part...)
+	}
+
+	if h.hs != nil {
+		part, err = h.hs.DumpCharas(opts)
+		if err != nil {
+			return
+		}
+		lst = append(lst, part...)
+	}
+
+	if h.kk != nil {
+		part, err = h.kk.DumpCharas(opts)
+		if err != nil {
+			return
+		}
+		lst = append(lst, part...)
+	}
+	return
+}
+
+func printDump(lst []CharaDump) {
+	for _, c := range lst {
+		fmt.Printf("%s %s (sex %d)\n", gameNames[c.Game], c.Name, c.Sex)
+		for _, b := range c.Blocks {
+			fmt.Printf("\t %-16s %-8v %8d bytes  %s\n", b.Name, b.Version, b.Size, b.Layout)
+		}
+	}
+}
+
+// dumpScene prints the blocks of every chara in a card, or writes them as
+// JSON next to the working directory with opts.json
+func dumpScene(currDir string, filePath string, opts ExtractOptions, full bool) (count int, err error) {
+	h, lErr := loadCard(filePath, full)
+	if lErr != nil {
+		err = lErr
+		return
+	}
+
+	lst, dErr := h.DumpCharas(opts)
+	if dErr != nil {
+		err = dErr
+		return
+	}
+	count = len(lst)
+
+	if !opts.json {
+		printDump(lst)
+		return
+	}
+
+	if lst == nil {
+		lst = []CharaDump{}
+	}
+	out, mErr := json.MarshalIndent(lst, "", "  ")
+	if mErr != nil {
+		err = mErr
+		return
+	}
+
+	base := filepath.Base(filePath)
+	savePath := path.Join(currDir, strings.TrimSuffix(base, filepath.Ext(base))+".json")
+	err = ioutil.WriteFile(savePath, append(out, '\n'), 0644)
+	if err != nil {
+		return
+	}
+	fmt.Println("\t", "Dump written to", savePath)
+	return
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testCardBlocks lists the blocks of every chara a handler read, in lstInfo
+// order
+func testCardBlocks(h CardHandlers) (names []string, blocks [][]byte) {
+	add := func(name string, data []byte) {
+		names = append(names, name)
+		blocks = append(blocks, data)
+	}
+	if h.kk != nil {
+		for _, card := range h.kk.card.charaCards {
+			add("face", card.faceData)
+			for _, info := range card.infoHeader.lstInfo {
+				add(info.name, card.data[info.name])
+			}
+		}
+	}
+	if h.ais != nil {
+		for _, card := range h.ais.card.charaCards {
+			for _, info := range card.infoHeader.lstInfo {
+				add(info.name, card.data[info.name])
+			}
+		}
+	}
+	if h.hs != nil {
+		for _, card := range h.hs.card.charaCards {
+			for _, info := range card.infoHeader.lstInfo {
+				add(info.Name, card.data[info.Name])
+			}
+		}
+	}
+	if h.ph != nil {
+		for _, card := range h.ph.card.charaCards {
+			add(phDumpBlock, card.rawData)
+		}
+	}
+	return
+}
+
+// testDumpCard dumps a written card through its JSON form and loads it back
+func testDumpCard(t *testing.T, card []byte) (src CardHandlers, dst CardHandlers) {
+	filePath := filepath.Join(t.TempDir(), "card.png")
+	if err := ioutil.WriteFile(filePath, card, 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := loadCard(filePath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lst, dErr := src.DumpCharas(ExtractOptions{})
+	if dErr != nil {
+		t.Fatal(dErr)
+	}
+	if len(lst) != 1 {
+		t.Fatalf("dumped %d charas", len(lst))
+	}
+	b, mErr := json.Marshal(lst)
+	if mErr != nil {
+		t.Fatal(mErr)
+	}
+	var loaded []CharaDump
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range loaded {
+		if err := dst.loadDump(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+func TestDumpLoadBlocks(t *testing.T) {
+	for game, card := range testWriteCards(t) {
+		src, dst := testDumpCard(t, card)
+
+		names, blocks := testCardBlocks(src)
+		gotNames, gotBlocks := testCardBlocks(dst)
+		if len(names) < 2 && game != gamePH {
+			t.Fatalf("%s: read only %v", game, names)
+		}
+		if !reflect.DeepEqual(gotNames, names) {
+			t.Errorf("%s: rebuilt blocks %v, want %v", game, gotNames, names)
+			continue
+		}
+		for i := range blocks {
+			if !bytes.Equal(gotBlocks[i], blocks[i]) {
+				t.Errorf("%s: block %s changed", game, names[i])
+			}
+		}
+	}
+}
+
+func TestDumpLayouts(t *testing.T) {
+	data := testMsgMap(t, "a", int32(1))
+	sized := testSizedBlocks(data, data)
+	tests := []struct {
+		name   string
+		data   []byte
+		layout string
+	}{
+		{"msgpack", data, layoutMsgpack},
+		{"sized", append(sized, 7), layoutSized},
+		{"binary", []byte{1, 2, 3}, layoutBinary},
+	}
+	for _, tt := range tests {
+		block := newBlockDump(tt.name, "0.0.0", 0, tt.data)
+		if block.Layout != tt.layout || block.Size != int64(len(tt.data)) {
+			t.Errorf("%s: layout %s size %d", tt.name, block.Layout, block.Size)
+		}
+		got, err := block.bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: bytes % x, want % x", tt.name, got, tt.data)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sulfur/bbio"
+)
+
+// CharaEdit strcture, one --set field=value
+type CharaEdit struct {
+	field string
+	value string
+}
+
+var kkEditFields = []string{"firstname", "lastname", "nickname", "fullname", "personality"}
+var aisEditFields = []string{"fullname", "personality"}
+
+func parseCharaEdit(str string) (edit CharaEdit, err error) {
+	idx := strings.Index(str, "=")
+	if idx <= 0 {
+		err = fmt.Errorf("Invalid --set '%s', expected field=value", str)
+		return
+	}
+	edit.field = strings.ToLower(str[:idx])
+	edit.value = str[idx+1:]
+	return
+}
+
+func (edit *CharaEdit) int32() (v int32, err error) {
+	i, pErr := strconv.ParseInt(edit.value, 10, 32)
+	if pErr != nil {
+		err = fmt.Errorf("%s expects a number, got '%s'", edit.field, edit.value)
+		return
+	}
+	v = int32(i)
+	return
+}
+
+func unknownEditField(field string, fields []string) error {
+	return fmt.Errorf("Unknown field '%s', expected one of %s", field, strings.Join(fields, ", "))
+}
+
+// EditChara implements for KKChara, fullname is "lastname firstname"
+func (sf *KKChara) EditChara(card *KKCharaCard, edits []CharaEdit) (err error) {
+	para, pErr := card.Parameter()
+	if pErr != nil {
+		err = pErr
+		return
+	}
+
+	for _, edit := range edits {
+		switch edit.field {
+		case "firstname":
+			para.Firstname = edit.value
+		case "lastname":
+			para.Lastname = edit.value
+		case "nickname":
+			para.Nickname = edit.value
+		case "fullname":
+			names := strings.SplitN(edit.value, " ", 2)
+			if len(names) != 2 {
+				err = errors.New("fullname expects \"lastname firstname\"")
+				return
+			}
+			para.Lastname = names[0]
+			para.Firstname = names[1]
+		case "personality":
+			para.Personality, err = edit.int32()
+			if err != nil {
+				return
+			}
+		default:
+			err = unknownEditField(edit.field, kkEditFields)
+			return
+		}
+	}
+
+	err = card.SetParameter(&para)
+	if err != nil {
+		return
+	}
+	err = card.loadPreviewInfo()
+	return
+}
+
+// EditChara implements for AISChara
+func (sf *AISChara) EditChara(card *AISCharaCard, edits []CharaEdit) (err error) {
+	para, pErr := card.Parameter()
+	if pErr != nil {
+		err = pErr
+		return
+	}
+
+	for _, edit := range edits {
+		switch edit.field {
+		case "fullname":
+			para.Fullname = edit.value
+		case "personality":
+			para.Personality, err = edit.int32()
+			if err != nil {
+				return
+			}
+		default:
+			err = unknownEditField(edit.field, aisEditFields)
+			return
+		}
+	}
+
+	err = card.SetParameter(&para)
+	if err != nil {
+		return
+	}
+	err = card.loadPreviewInfo()
+	return
+}
+
+// replaceCharaFile writes through write to a temporary file next to filePath,
+// runs verify on it and only then moves it over the original
+func replaceCharaFile(filePath string, write func(string) error, verify func(string) error) (err error) {
+	tmpPath := filePath + ".tmp"
+	defer os.Remove(tmpPath)
+
+	err = write(tmpPath)
+	if err != nil {
+		return
+	}
+
+	if verify != nil {
+		err = verify(tmpPath)
+		if err != nil {
+			return
+		}
+	}
+	err = os.Rename(tmpPath, filePath)
+	return
+}
+
+// editCard applies opts.edits to a standalone chara card in place
+func editCard(filePath string, opts ExtractOptions) (err error) {
+	if len(opts.edits) == 0 {
+		err = errors.New("Nothing to edit, use --set field=value")
+		return
+	}
+
+	fileBytes, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	reader := bbio.NewReaderBytes(fileBytes)
+	pngSize := getPngSize(reader)
+
+	var h CardHandlers
+	re, cErr := h.readCard(reader, pngSize, true)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	if !re {
+		err = errors.New("Not a chara card, scene cards can not be edited")
+		return
+	}
+
+	switch {
+	case h.kk != nil:
+		for _, v := range h.kk.card.charaCards {
+			card := v
+			err = h.kk.EditChara(&card, opts.edits)
+			if err != nil {
+				return
+			}
+
+			var verify func(string) error
+			if opts.verify {
+				verify = func(p string) error { return h.kk.VerifyCharaFile(card, p) }
+			}
+			err = replaceCharaFile(filePath, func(p string) error {
+				_, wErr := h.kk.WriteCharaFile(card, p, ExtractOptions{})
+				return wErr
+			}, verify)
+		}
+
+	case h.ais != nil:
+		for _, v := range h.ais.card.charaCards {
+			card := v
+			err = h.ais.EditChara(&card, opts.edits)
+			if err != nil {
+				return
+			}
+
+			var verify func(string) error
+			if opts.verify {
+				verify = func(p string) error { return h.ais.VerifyCharaFile(card, p) }
+			}
+			err = replaceCharaFile(filePath, func(p string) error {
+				_, wErr := h.ais.WriteCharaFile(card, p, ExtractOptions{})
+				return wErr
+			}, verify)
+		}
+
+	default:
+		err = errors.New("Only KK and AIS / HS2 chara cards can be edited")
+	}
+	return
+}
+
+// isSceneCard is true for every studio scene mark
+func isSceneCard(reader *bbio.Reader) bool {
+	return IsKStudioSceneCard(reader) || IsNeoV2SceneCard(reader) || IsNeoSceneCard(reader) ||
+		IsHoneyStudioSceneCard(reader) || IsPHStudioSceneCard(reader)
+}
+
+// replaceCardPng swaps the png at the start of a card for pngBytes, the
+// bytes after the old png are kept as is. check also runs on the written
+// file with opts.verify
+func replaceCardPng(filePath string, fileBytes []byte, pngSize int64, pngBytes []byte, opts ExtractOptions, check func(string) error) (err error) {
+	payload := fileBytes[pngSize:]
+
+	var verify func(string) error
+	if opts.verify {
+		verify = func(p string) error {
+			b, rErr := ioutil.ReadFile(p)
+			if rErr != nil {
+				return rErr
+			}
+			size := getPngSize(bbio.NewReaderBytes(b))
+			if size != int64(len(pngBytes)) || !bytes.Equal(b[size:], payload) {
+				return errors.New("Card data differs after write")
+			}
+			if check != nil {
+				return check(p)
+			}
+			return nil
+		}
+	}
+
+	err = replaceCharaFile(filePath, func(p string) error {
+		return ioutil.WriteFile(p, append(append([]byte{}, pngBytes...), payload...), 0644)
+	}, verify)
+	return
+}
+
+// thumbnailScene replaces the screenshot of a scene card, keeping the size
+// of the old one
+func thumbnailScene(filePath string, fileBytes []byte, pngSize int64, img image.Image, opts ExtractOptions) (err error) {
+	size := sceneShotSize
+	cfg, cErr := png.DecodeConfig(bytes.NewReader(fileBytes[:pngSize]))
+	if cErr == nil && cfg.Width > 0 && cfg.Height > 0 {
+		size = image.Point{cfg.Width, cfg.Height}
+	}
+
+	shot, sErr := encodeThumb(cropThumb(img, size))
+	if sErr != nil {
+		err = sErr
+		return
+	}
+	err = replaceCardPng(filePath, fileBytes, pngSize, shot, opts, nil)
+	return
+}
+
+// thumbnailCard replaces the png of a standalone chara card with
+// opts.thumbImage cropped to card size, the chara bytes are copied as is.
+// Scene cards get a new screenshot instead
+func thumbnailCard(filePath string, opts ExtractOptions) (err error) {
+	if opts.thumbImage == "" {
+		err = errors.New("Missing image, use thumbnail file image")
+		return
+	}
+
+	img, iErr := loadThumbImage(opts.thumbImage)
+	if iErr != nil {
+		err = iErr
+		return
+	}
+	thumb := ImageThumb{img: img}
+
+	fileBytes, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	reader := bbio.NewReaderBytes(fileBytes)
+	pngSize := getPngSize(reader)
+
+	var h CardHandlers
+	re, cErr := h.readCard(reader, pngSize, true)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	if !re {
+		if pngSize == 0 || !isSceneCard(reader) {
+			err = errors.New("Not a chara or scene card")
+			return
+		}
+		err = thumbnailScene(filePath, fileBytes, pngSize, img, opts)
+		return
+	}
+
+	switch {
+	// KK and AIS keep everything after the png, plugin data appended after
+	// the chara block included
+	case h.kk != nil:
+		for _, v := range h.kk.card.charaCards {
+			card := v
+			pngBytes, tErr := renderThumb(thumb, nil, card.pngData, ThumbInfo{game: gameKK, sex: card.sex, name: card.fullname(), face: card.faceData})
+			if tErr != nil {
+				err = tErr
+				return
+			}
+			err = replaceCardPng(filePath, fileBytes, pngSize, pngBytes, opts, func(p string) error {
+				return h.kk.VerifyCharaFile(card, p)
+			})
+		}
+
+	case h.ais != nil:
+		for _, v := range h.ais.card.charaCards {
+			card := v
+			pngBytes, tErr := renderThumb(thumb, nil, card.pngData, ThumbInfo{game: card.gameType, sex: card.sex, name: card.fullname})
+			if tErr != nil {
+				err = tErr
+				return
+			}
+			err = replaceCardPng(filePath, fileBytes, pngSize, pngBytes, opts, func(p string) error {
+				return h.ais.VerifyCharaFile(card, p)
+			})
+		}
+
+	case h.hs != nil:
+		// the trailer offsets and HMAC are written again for the new png
+		h.hs.thumb = thumb
+		for _, v := range h.hs.card.charaCards {
+			card := v
+			var verify func(string) error
+			if opts.verify {
+				verify = func(p string) error { return h.hs.VerifyCharaFile(card, p) }
+			}
+			err = replaceCharaFile(filePath, func(p string) error {
+				_, wErr := h.hs.WriteCharaFile(card, p, ExtractOptions{raw: true})
+				return wErr
+			}, verify)
+		}
+
+	case h.ph != nil:
+		h.ph.thumb = thumb
+		for _, v := range h.ph.card.charaCards {
+			card := v
+			err = replaceCharaFile(filePath, func(p string) error {
+				_, wErr := h.ph.WriteCharaFile(card, p, ExtractOptions{raw: true})
+				return wErr
+			}, nil)
+		}
+
+	}
+	return
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCardFile writes a card to a temporary file
+func testCardFile(t testing.TB, dir string, card []byte) string {
+	filePath := filepath.Join(dir, "card.png")
+	if err := ioutil.WriteFile(filePath, card, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+// testEdits parses --set values
+func testEdits(t testing.TB, sets ...string) (edits []CharaEdit) {
+	for _, s := range sets {
+		edit, err := parseCharaEdit(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edits = append(edits, edit)
+	}
+	return
+}
+
+// testOtherBlocks drops the Parameter block from the blocks of a card
+func testOtherBlocks(h CardHandlers) (names []string, blocks [][]byte) {
+	allNames, allBlocks := testCardBlocks(h)
+	for i, name := range allNames {
+		if name != "Parameter" {
+			names = append(names, name)
+			blocks = append(blocks, allBlocks[i])
+		}
+	}
+	return
+}
+
+func testEditRoundTrip(t *testing.T, card []byte, sets []string, check func(h CardHandlers)) {
+	filePath := testCardFile(t, t.TempDir(), card)
+	src, err := loadCard(filePath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = editCard(filePath, ExtractOptions{edits: testEdits(t, sets...), verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited, lErr := loadCard(filePath, true)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	check(edited)
+
+	names, blocks := testOtherBlocks(src)
+	gotNames, gotBlocks := testOtherBlocks(edited)
+	if !reflect.DeepEqual(gotNames, names) {
+		t.Fatalf("blocks %v, want %v", gotNames, names)
+	}
+	for i := range blocks {
+		if !bytes.Equal(gotBlocks[i], blocks[i]) {
+			t.Errorf("block %s changed", names[i])
+		}
+	}
+}
+
+func TestEditKK(t *testing.T) {
+	card := testWriteCards(t)[gameKK]
+	testEditRoundTrip(t, card, []string{"fullname=佐藤 花子", "Personality=12"}, func(h CardHandlers) {
+		if h.kk == nil || len(h.kk.card.charaCards) != 1 {
+			t.Fatal("edited card is not a KK chara")
+		}
+		for _, c := range h.kk.card.charaCards {
+			para, err := c.Parameter()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if para.Lastname != "佐藤" || para.Firstname != "花子" || para.Personality != 12 {
+				t.Errorf("read back %s %s personality %d", para.Lastname, para.Firstname, para.Personality)
+			}
+			if c.fullname() != "佐藤 花子" {
+				t.Errorf("preview name %q", c.fullname())
+			}
+		}
+	})
+}
+
+func TestEditAIS(t *testing.T) {
+	card := testWriteCards(t)[gameAIS]
+	testEditRoundTrip(t, card, []string{"fullname=さくら", "personality=3"}, func(h CardHandlers) {
+		if h.ais == nil || len(h.ais.card.charaCards) != 1 {
+			t.Fatal("edited card is not an AIS chara")
+		}
+		for _, c := range h.ais.card.charaCards {
+			para, err := c.Parameter()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if para.Fullname != "さくら" || para.Personality != 3 {
+				t.Errorf("read back %s personality %d", para.Fullname, para.Personality)
+			}
+			if c.fullname != "さくら" {
+				t.Errorf("preview name %q", c.fullname)
+			}
+		}
+	})
+}
+
+func TestEditErrors(t *testing.T) {
+	cards := testWriteCards(t)
+	tests := []struct {
+		name string
+		game string
+		sets []string
+		want string
+	}{
+		{"nothing to edit", gameKK, nil, "Nothing to edit"},
+		{"KK unknown field", gameKK, []string{"height=3"}, "Unknown field 'height'"},
+		{"AIS unknown field", gameAIS, []string{"nickname=Hana"}, "Unknown field 'nickname', expected one of fullname, personality"},
+		{"KK personality", gameKK, []string{"personality=shy"}, "personality expects a number, got 'shy'"},
+		{"AIS personality overflow", gameAIS, []string{"personality=3000000000"}, "personality expects a number"},
+		{"KK fullname", gameKK, []string{"fullname=Hanako"}, "lastname firstname"},
+		{"HS card", gameHS, []string{"fullname=Hana"}, "Only KK and AIS / HS2"},
+	}
+	for _, tt := range tests {
+		filePath := testCardFile(t, t.TempDir(), cards[tt.game])
+		err := editCard(filePath, ExtractOptions{edits: testEdits(t, tt.sets...)})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+
+		// a failed edit leaves the card alone
+		b, rErr := ioutil.ReadFile(filePath)
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		if !bytes.Equal(b, cards[tt.game]) {
+			t.Errorf("%s: card changed", tt.name)
+		}
+	}
+
+	for _, s := range []string{"fullname", "=Hana", ""} {
+		if _, err := parseCharaEdit(s); err == nil {
+			t.Errorf("parseCharaEdit(%q) accepted", s)
+		}
+	}
+}
@@ -2,15 +2,46 @@ package main
 
 import (
 	"errors"
+	"io/ioutil"
+	"path/filepath"
 
 	"github.com/sulfur/bbio"
 )
 
-func extractScene(currDir string, filePath string, flag int, full bool) (total int, write int, err error) {
-	reader := bbio.NewReaderFile(filePath)
-	var re, isHs, isKs bool
+// CardHandlers strcture, the handlers that found charas in one file
+type CardHandlers struct {
+	ais *AISChara
+	hs  *HSChara
+	kk  *KKChara
+	ph  *PHChara
+	// screenshot png at the start of the file
+	shot []byte
+}
 
-	pngSize := getPngSize(reader)
+// readCard handles a standalone chara card, re is false for anything else
+func (h *CardHandlers) readCard(reader *bbio.Reader, pngSize int64, full bool) (re bool, err error) {
+	switch {
+	case IsKKCharaCard(reader, pngSize):
+		h.kk = NewKKChara()
+		re, err = h.kk.ReadCard(reader, pngSize)
+
+	case IsAISCharaCard(reader, pngSize):
+		h.ais = NewAISChara()
+		re, err = h.ais.ReadCard(reader, pngSize)
+
+	case full && IsHSCharaCard(reader, pngSize):
+		h.hs = NewHSChara()
+		re, err = h.hs.ReadCard(reader, pngSize)
+
+	case full && IsPHCharaCard(reader, pngSize):
+		h.ph = NewPHChara()
+		re, err = h.ph.ReadCard(reader, pngSize)
+	}
+	return
+}
+
+func (h *CardHandlers) readScene(reader *bbio.Reader, pngSize int64, full bool) (err error) {
+	var re, isHs, isKs bool
 
 	if full {
 		isPh := IsPHStudioSceneCard(reader)
@@ -23,8 +54,7 @@ func extractScene(currDir string, filePath string, flag int, full bool) (total i
 				printError(errors.New("PHStudioSceneCard read failed"))
 				return
 			}
-
-			total, write, err = phChara.ExtractChara(currDir, flag)
+			h.ph = phChara
 			return
 		}
 
@@ -38,43 +68,107 @@ func extractScene(currDir string, filePath string, flag int, full bool) (total i
 	if isKs || isHs || isNeo || isNeoV2 {
 		aisChara := NewAISChara()
 		re, err = aisChara.ReadScene(reader, pngSize)
+		if err != nil {
+			return
+		}
 		if re {
-			aisTotal, aisWrite, aisErr := aisChara.ExtractChara(currDir, flag)
-			if aisErr != nil {
-				err = aisErr
-				return
-			}
-
-			total += aisTotal
-			write += aisWrite
+			h.ais = aisChara
 		}
 
 		hsChara := NewHSChara()
 		re, err = hsChara.ReadScene(reader, pngSize)
+		if err != nil {
+			return
+		}
 		if re {
-			hsTotal, hsWrite, hsErr := hsChara.ExtractChara(currDir, flag)
-			if hsErr != nil {
-				err = hsErr
-				return
-			}
-
-			total += hsTotal
-			write += hsWrite
+			h.hs = hsChara
 		}
 
 		kkChara := NewKKChara()
 		re, err = kkChara.ReadScene(reader, pngSize)
+		if err != nil {
+			return
+		}
 		if re {
-			kkTotal, kkWrite, kkErr := kkChara.ExtractChara(currDir, flag)
-			if kkErr != nil {
-				err = kkErr
-				return
-			}
+			h.kk = kkChara
+		}
+	}
+
+	return
+}
 
-			total += kkTotal
-			write += kkWrite
+// loadCard reads a scene or standalone chara card file
+func loadCard(filePath string, full bool) (h CardHandlers, err error) {
+	fileBytes, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	reader := bbio.NewReaderBytes(fileBytes)
+	pngSize := getPngSize(reader)
+	if pngSize > 0 && pngSize <= int64(len(fileBytes)) {
+		h.shot = fileBytes[:pngSize]
+	}
+
+	re, cErr := h.readCard(reader, pngSize, full)
+	if re || cErr != nil {
+		err = cErr
+		return
+	}
+
+	err = h.readScene(reader, pngSize, full)
+	return
+}
+
+// ExtractChara implements for CardHandlers
+func (h *CardHandlers) ExtractChara(currDir string, opts ExtractOptions, report *ExtractReport) (err error) {
+	if h.ph != nil {
+		err = h.ph.ExtractChara(currDir, opts, report)
+		if err != nil {
+			return
+		}
+	}
+
+	if h.ais != nil {
+		err = h.ais.ExtractChara(currDir, opts, report)
+		if err != nil {
+			return
+		}
+	}
+
+	if h.hs != nil {
+		err = h.hs.ExtractChara(currDir, opts, report)
+		if err != nil {
+			return
+		}
+	}
+
+	if h.kk != nil {
+		err = h.kk.ExtractChara(currDir, opts, report)
+	}
+	return
+}
+
+func extractScene(currDir string, filePath string, opts ExtractOptions, full bool) (report ExtractReport, err error) {
+	h, lErr := loadCard(filePath, full)
+	if lErr != nil {
+		err = lErr
+		return
+	}
+
+	opts.thumb, err = newThumbnailer(opts, filepath.Base(filePath), h.shot)
+	if err != nil {
+		return
+	}
+
+	if opts.meta {
+		opts.cardMeta, err = newCardMeta(filePath)
+		if err != nil {
+			return
 		}
 	}
 
+	err = h.ExtractChara(currDir, opts, &report)
 	return
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sulfur/bbio"
+)
+
+// fuzzSeeds adds the written card of game, and the same card behind a
+// second png like a scene holds it
+func fuzzSeeds(f *testing.F, game string) {
+	card := testWriteCards(f)[game]
+	f.Add(card)
+
+	shot, err := createPng(8, 8, 0)
+	if err != nil {
+		f.Fatal(err)
+	}
+	size := getPngSize(bbio.NewReaderBytes(card))
+	f.Add(append(append([]byte{}, shot...), card[size:]...))
+	f.Add(card[:size+16])
+}
+
+// fuzzRead runs a ReadCard and a ReadScene over b with panics let through
+func fuzzRead(b []byte, readCard func(*bbio.Reader, int64), readScene func(*bbio.Reader, int64)) {
+	reader := bbio.NewReaderBytes(b)
+	pngSize := getPngSize(reader)
+	readCard(reader, pngSize)
+
+	reader = bbio.NewReaderBytes(b)
+	readScene(reader, pngSize)
+}
+
+func FuzzKKRead(f *testing.F) {
+	parsePanics = true
+	fuzzSeeds(f, gameKK)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		fuzzRead(b,
+			func(r *bbio.Reader, size int64) { NewKKChara().ReadCard(r, size) },
+			func(r *bbio.Reader, size int64) { NewKKChara().ReadScene(r, size) })
+	})
+}
+
+func FuzzAISRead(f *testing.F) {
+	parsePanics = true
+	fuzzSeeds(f, gameAIS)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		fuzzRead(b,
+			func(r *bbio.Reader, size int64) { NewAISChara().ReadCard(r, size) },
+			func(r *bbio.Reader, size int64) { NewAISChara().ReadScene(r, size) })
+	})
+}
+
+func FuzzHSRead(f *testing.F) {
+	parsePanics = true
+	fuzzSeeds(f, gameHS)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		fuzzRead(b,
+			func(r *bbio.Reader, size int64) { NewHSChara().ReadCard(r, size) },
+			func(r *bbio.Reader, size int64) { NewHSChara().ReadScene(r, size) })
+	})
+}
+
+func FuzzPHRead(f *testing.F) {
+	parsePanics = true
+	fuzzSeeds(f, gamePH)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		fuzzRead(b,
+			func(r *bbio.Reader, size int64) { NewPHChara().ReadCard(r, size) },
+			func(r *bbio.Reader, size int64) { NewPHChara().ReadScene(r, size) })
+	})
+}
+
+func FuzzPngChunks(f *testing.F) {
+	for _, card := range testWriteCards(f) {
+		f.Add(card)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		chunks, size, err := readPngChunks(b)
+		if err != nil {
+			return
+		}
+		if size > int64(len(b)) || chunks[len(chunks)-1].name != "IEND" {
+			t.Fatalf("png size %d of %d bytes, last chunk %s", size, len(b), chunks[len(chunks)-1].name)
+		}
+
+		checked, cErr := checkPngData(b)
+		if cErr != nil || checked != size {
+			t.Fatalf("checkPngData %d, %v, want %d", checked, cErr, size)
+		}
+	})
+}
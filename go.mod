@@ -1,12 +1,20 @@
 module github.com/sulfur/studioextract
 
-go 1.14
+go 1.18
 
 require (
+	github.com/hajimehoshi/bitmapfont/v3 v3.2.0
 	github.com/sulfur/bbio v0.0.0
 	github.com/tadvi/winc v0.0.0-20190405175627-5454f291903d
 	github.com/vmihailenco/msgpack v4.0.4+incompatible
 	github.com/vmihailenco/msgpack/v5 v5.0.0-beta.1
+	golang.org/x/image v0.20.0
+)
+
+require (
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/vmihailenco/tagparser v0.1.1 // indirect
+	golang.org/x/text v0.18.0 // indirect
 )
 
 replace github.com/sulfur/bbio => ./bbio
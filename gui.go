@@ -75,12 +75,13 @@ func wndOnDropFiles(arg *winc.Event) {
 		for _, file := range dropData.Files {
 			_, fErr := os.Stat(file)
 			if !os.IsNotExist(fErr) && path.Ext(file) == ".png" {
-				total, write, err := extractScene(guiCurrDir, file, guiExtFlag, true)
+				opts := ExtractOptions{flag: guiExtFlag}
+				report, err := extractScene(guiCurrDir, file, opts, true)
 				if err != nil {
 					fmt.Println(err)
 					continue
 				}
-				fmt.Println("extractScene >>", total, write)
+				fmt.Println("extractScene >>", report.Total(), report.Write())
 			}
 		}
 	}
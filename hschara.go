@@ -2,11 +2,13 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
@@ -21,6 +23,44 @@ func createSha256(data []byte, secret string) []byte {
 	return h.Sum(nil)
 }
 
+// HS signature modes
+const (
+	hsSigRegenerate = "regenerate"
+	hsSigPreserve   = "preserve"
+)
+
+// HS signature states
+const (
+	hsSigValid     = "valid"
+	hsSigMismatch  = "mismatch"
+	hsSigEmbedded  = "unverifiable, original thumbnail not in scene"
+	hsSigUnsigned  = "unsigned"
+	hsSigMalformed = "malformed"
+)
+
+// HSSignature strcture, the trailer after the chara data. Version 2 cards
+// start it with an HMAC-SHA256 of the card png keyed with the marker,
+// all versions end it with the file offsets of the marker and of the
+// block data.
+type HSSignature struct {
+	hmac      []byte
+	startPos  int64
+	headerPos int64
+}
+
+func parseHSSignature(sig []byte) (s HSSignature, err error) {
+	if len(sig) != 16 && len(sig) != 48 {
+		err = fmt.Errorf("Bad signature size %d", len(sig))
+		return
+	}
+
+	off := len(sig) - 16
+	s.hmac = sig[:off]
+	s.startPos = bbio.BitConverter.ToInt64(sig[off : off+8])
+	s.headerPos = bbio.BitConverter.ToInt64(sig[off+8:])
+	return
+}
+
 func readString(data []byte, offset int) (str string, n int, err error) {
 	str = ""
 	var count, shift, off, b int
@@ -33,6 +73,11 @@ func readString(data []byte, offset int) (str string, n int, err error) {
 			return
 		}
 
+		if off >= len(data) {
+			err = io.ErrUnexpectedEOF
+			return
+		}
+
 		rb := data[off]
 		n++
 		off++
@@ -46,21 +91,22 @@ func readString(data []byte, offset int) (str string, n int, err error) {
 		}
 	}
 
-	strb := make([]byte, count)
-	sn := copy(strb, data[off:])
-	if sn == count {
-		str = string(strb)
+	if count < 0 || count > len(data)-off {
+		err = io.ErrUnexpectedEOF
+		return
 	}
-	n += sn
+
+	str = string(data[off : off+count])
+	n += count
 	return
 }
 
 // HSHeaderInfo strcture
 type HSHeaderInfo struct {
-	name    string
-	version int32
-	pos     int64
-	size    int64
+	Name    string `bbio:"fixed=128"`
+	Version int32
+	Pos     int64
+	Size    int64
 }
 
 // HSCharaCard strcture
@@ -75,13 +121,21 @@ type HSCharaCard struct {
 	infoHeader     struct {
 		lstInfo []HSHeaderInfo
 	}
-	dataSize int64
-	data     map[string][]byte
+	dataSize   int64
+	dataOffset int64
+	data       map[string][]byte
+	endOffset  int64
+	rawData    []byte
+	sig        HSSignature
+	sigErr     error
+	hmacMatch  bool
+	// original thumbnail of a standalone card
+	pngData []byte
 }
 
 func (sf *HSCharaCard) findInfo(name string) (info HSHeaderInfo) {
 	for _, v := range sf.infoHeader.lstInfo {
-		if v.name == name {
+		if v.Name == name {
 			info = v
 			return
 		}
@@ -89,21 +143,43 @@ func (sf *HSCharaCard) findInfo(name string) (info HSHeaderInfo) {
 	return
 }
 
+// signatureStatus reports whether the original trailer verifies, and
+// whether its offsets agree with the chara layout
+func (sf *HSCharaCard) signatureStatus() (status string, offsetsOK bool) {
+	if sf.sigErr != nil {
+		status = hsSigMalformed
+		return
+	}
+
+	offsetsOK = sf.sig.headerPos-sf.sig.startPos == sf.dataOffset-sf.startOffset
+	switch {
+	case len(sf.sig.hmac) == 0:
+		status = hsSigUnsigned
+	case sf.hmacMatch:
+		status = hsSigValid
+	case sf.startOffset == sf.pngSize:
+		status = hsSigMismatch
+	default:
+		status = hsSigEmbedded
+	}
+	return
+}
+
 func (sf *HSCharaCard) loadPreviewInfo() (err error) {
 	sf.name = ""
 
 	tagPreview := "プレビュー情報"
 	info := sf.findInfo(tagPreview)
-	if info.name == tagPreview {
-		prevData := sf.data[info.name]
+	if info.Name == tagPreview {
+		prevData := sf.data[info.Name]
 
 		var off int
-		if info.version >= 4 {
+		if info.Version >= 4 {
 			off += 4 // productNo
 		}
 		off += 4 // sex
 
-		if info.version >= 2 {
+		if info.Version >= 2 {
 			off += 8 // personality + nameLength
 
 			str, _, err := readString(prevData, off)
@@ -123,7 +199,10 @@ type HSSceneCard struct {
 
 // HSChara strcture
 type HSChara struct {
-	card *HSSceneCard
+	card    *HSSceneCard
+	sigMode string
+	thumb   Thumbnailer
+	meta    *CardMeta
 }
 
 var honeyStudioMark = "【honey】"
@@ -134,7 +213,7 @@ var hsCharaFemaleMark = "【HoneySelectCharaFemale】"
 // NewHSChara implements for HSChara
 func NewHSChara() *HSChara {
 	c := &HSSceneCard{}
-	return &HSChara{card: c}
+	return &HSChara{card: c, sigMode: hsSigRegenerate}
 }
 
 // IsHoneyStudioSceneCard implements for Honey Studio scene
@@ -147,6 +226,12 @@ func IsNeoSceneCard(reader *bbio.Reader) bool {
 	return (reader.Index([]byte(neoMark)) > 0)
 }
 
+// IsHSCharaCard implements for standalone HS chara card
+func IsHSCharaCard(reader *bbio.Reader, pngSize int64) bool {
+	mark := readCardMark(reader, pngSize, 0)
+	return mark == hsCharaMaleMark || mark == hsCharaFemaleMark
+}
+
 // GenerateFileName implements for HSChara
 func (sf *HSChara) GenerateFileName(sex int32) string {
 	time.Sleep(2 * time.Millisecond)
@@ -167,6 +252,8 @@ func (sf *HSChara) GenerateFileName(sex int32) string {
 
 // ReadChara implements for HSChara
 func (sf *HSChara) ReadChara(reader *bbio.Reader, offset int64) (card HSCharaCard, err error) {
+	defer recoverParse(&err)
+
 	startOffset, seekErr := reader.Seek(offset, io.SeekStart)
 	if seekErr != nil {
 		err = seekErr
@@ -209,62 +296,50 @@ func (sf *HSChara) ReadChara(reader *bbio.Reader, offset int64) (card HSCharaCar
 	}
 	card.infoHeaderSize = headersz
 
+	// tag, version, pos, size
+	hszErr := checkBlockSize(reader, int64(headersz)*(128+4+8+8))
+	if hszErr != nil {
+		err = hszErr
+		return
+	}
+
 	card.infoHeader.lstInfo = make([]HSHeaderInfo, headersz)
 	for i := 0; i < int(headersz); i++ {
-		tag, tagErr := reader.ReadStringFixed(128, true)
-		if tagErr != nil {
-			err = tagErr
+		infoErr := reader.Unmarshal(&card.infoHeader.lstInfo[i])
+		if infoErr != nil {
+			err = infoErr
 			return
 		}
-		card.infoHeader.lstInfo[i].name = tag
-
-		hver, hverErr := reader.ReadInt32()
-		if hverErr != nil {
-			err = hverErr
-			return
-		}
-		card.infoHeader.lstInfo[i].version = hver
-
-		hpos, hposErr := reader.ReadInt64()
-		if hposErr != nil {
-			err = hposErr
-			return
-		}
-		card.infoHeader.lstInfo[i].pos = hpos
-
-		hsz, hszErr := reader.ReadInt64()
-		if hszErr != nil {
-			err = hszErr
-			return
-		}
-		card.infoHeader.lstInfo[i].size = hsz
 	}
 
 	dataOffset := reader.Position()
+	card.dataOffset = dataOffset
 	card.data = make(map[string][]byte)
 	infoCount := len(card.infoHeader.lstInfo)
 
 	var rbsz int
 	for i := 0; i < infoCount; i++ {
 		info := card.infoHeader.lstInfo[i]
-		sbOffset := dataOffset + info.pos
+		sbOffset := dataOffset + info.Pos
 
 		_, sbErr := reader.Seek(sbOffset, io.SeekStart)
 		if sbErr != nil {
 			return card, sbErr
 		}
 
-		bBytes := make([]byte, info.size)
-		rbn, rbErr := reader.Read(bBytes)
+		bBytes, rbErr := readBlock(reader, info.Size)
 		if rbErr != nil {
 			return card, rbErr
 		}
 
-		rbsz += rbn
-		card.data[info.name] = bBytes
+		rbsz += len(bBytes)
+		card.data[info.Name] = bBytes
 	}
 
 	lOffset := dataOffset + int64(rbsz)
+	card.endOffset = lOffset
+	card.rawData = rawRange(reader, card.startOffset, card.endOffset)
+
 	_, lErr := reader.Seek(lOffset, io.SeekStart)
 	if lErr == nil {
 		var sigsz int
@@ -274,12 +349,15 @@ func (sf *HSChara) ReadChara(reader *bbio.Reader, offset int64) (card HSCharaCar
 			sigsz += 32
 		}
 
-		sigBytes := make([]byte, sigsz)
-		_, sigErr := reader.Read(sigBytes)
+		sigBytes, sigErr := reader.ReadBytes(sigsz)
 		if sigErr != nil {
 			err = sigErr
-		} else {
-			card.data["sig"] = sigBytes
+		}
+
+		card.sig, card.sigErr = parseHSSignature(sigBytes)
+		if card.sigErr == nil && len(card.sig.hmac) > 0 {
+			png := rawRange(reader, 0, card.startOffset)
+			card.hmacMatch = hmac.Equal(card.sig.hmac, createSha256(png, card.marker))
 		}
 	}
 
@@ -293,10 +371,13 @@ func (sf *HSChara) ReadChara(reader *bbio.Reader, offset int64) (card HSCharaCar
 }
 
 // ReadScene implements for HSChara
-func (sf *HSChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
+func (sf *HSChara) ReadScene(reader *bbio.Reader, pngSize int64) (re bool, err error) {
+	defer recoverParse(&err)
+
 	_, seekErr := reader.Seek(pngSize, io.SeekStart)
 	if seekErr != nil {
-		return false, seekErr
+		err = seekErr
+		return
 	}
 
 	sf.card.pngSize = pngSize
@@ -304,6 +385,12 @@ func (sf *HSChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
 
 	idxsMale := reader.FindAll([]byte(hsCharaMaleMark))
 	for _, v := range idxsMale {
+		countErr := checkCharaCount(len(sf.card.charaCards))
+		if countErr != nil {
+			err = countErr
+			return
+		}
+
 		chara, cerr := sf.ReadChara(reader, int64(v-1))
 		if cerr != nil {
 			if isDebug {
@@ -313,6 +400,7 @@ func (sf *HSChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
 			}
 
 		} else {
+			chara.pngSize = pngSize
 			charFileName := sf.GenerateFileName(chara.sex)
 			sf.card.charaCards[charFileName] = chara
 		}
@@ -320,6 +408,12 @@ func (sf *HSChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
 
 	idxsFemale := reader.FindAll([]byte(hsCharaFemaleMark))
 	for _, v := range idxsFemale {
+		countErr := checkCharaCount(len(sf.card.charaCards))
+		if countErr != nil {
+			err = countErr
+			return
+		}
+
 		chara, cerr := sf.ReadChara(reader, int64(v-1))
 		if cerr != nil {
 			if isDebug {
@@ -329,12 +423,69 @@ func (sf *HSChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
 			}
 
 		} else {
+			chara.pngSize = pngSize
 			charFileName := sf.GenerateFileName(chara.sex)
 			sf.card.charaCards[charFileName] = chara
 		}
 	}
 
-	return len(sf.card.charaCards) > 0, nil
+	re = len(sf.card.charaCards) > 0
+	return
+}
+
+// writeSignature writes the trailer with the offsets of the written card.
+// Preserve keeps the original HMAC only while the png is the one it was
+// made for, any other png gets a fresh one. It only applies to standalone
+// cards: a scene keeps no chara png, so scene charas always get a fresh
+// HMAC, ExtractChara says so once.
+func (sf *HSChara) writeSignature(writer *bbio.Writer, card HSCharaCard, pngBytes []byte, startPos int64, headerPos int64) (err error) {
+	if card.loadVersion == 2 {
+		sha256Bytes := createSha256(pngBytes, card.marker)
+		if sf.sigMode == hsSigPreserve && card.pngData != nil {
+			if card.sigErr == nil && len(card.sig.hmac) > 0 && bytes.Equal(pngBytes, card.pngData) {
+				sha256Bytes = card.sig.hmac
+			} else {
+				printWarning(fmt.Errorf("%s: png changed, signature regenerated instead of preserved", card.name))
+			}
+		}
+
+		_, shaErr := writer.Write(sha256Bytes)
+		if shaErr != nil {
+			err = shaErr
+			return
+		}
+	}
+
+	ppErr := writer.WriteLong(startPos)
+	if ppErr != nil {
+		err = ppErr
+		return
+	}
+
+	err = writer.WriteLong(headerPos)
+	return
+}
+
+// ReadCard implements for HSChara, reads a standalone chara card
+func (sf *HSChara) ReadCard(reader *bbio.Reader, pngSize int64) (re bool, err error) {
+	defer recoverParse(&err)
+
+	sf.card.pngSize = pngSize
+	sf.card.charaCards = make(map[string]HSCharaCard)
+
+	chara, cErr := sf.ReadChara(reader, pngSize)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	chara.pngSize = pngSize
+	chara.pngData = rawRange(reader, 0, pngSize)
+
+	charFileName := sf.GenerateFileName(chara.sex)
+	sf.card.charaCards[charFileName] = chara
+
+	re = true
+	return
 }
 
 // WriteChara implements for HSChara
@@ -342,7 +493,7 @@ func (sf *HSChara) WriteChara(card HSCharaCard, w io.Writer) (re bool, err error
 	re = false
 	writer := bbio.NewWriter(w)
 
-	pngBytes, pngErr := createPng(252, 352, int(card.sex))
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, card.pngData, ThumbInfo{game: gameHS, sex: card.sex, name: card.name})
 	if pngErr != nil {
 		err = pngErr
 		return
@@ -380,34 +531,15 @@ func (sf *HSChara) WriteChara(card HSCharaCard, w io.Writer) (re bool, err error
 
 	for i := 0; i < infoCount; i++ {
 		info := card.infoHeader.lstInfo[i]
-		tag := info.name
+		tag := info.Name
 		lstData[i] = card.data[tag]
 		size := int64(len(card.data[tag]))
 
-		tagBytes := make([]byte, 128)
-		copy(tagBytes, []byte(tag))
-
-		_, tErr := writer.Write(tagBytes)
-		if tErr != nil {
-			err = tErr
-			return
-		}
-
-		vErr := writer.WriteInt(info.version)
-		if vErr != nil {
-			err = vErr
-			return
-		}
-
-		pErr := writer.WriteLong(pos)
-		if pErr != nil {
-			err = pErr
-			return
-		}
-
-		sErr := writer.WriteLong(size)
-		if sErr != nil {
-			err = sErr
+		info.Pos = pos
+		info.Size = size
+		iErr := writer.Marshal(&info)
+		if iErr != nil {
+			err = iErr
 			return
 		}
 
@@ -423,28 +555,61 @@ func (sf *HSChara) WriteChara(card HSCharaCard, w io.Writer) (re bool, err error
 		}
 	}
 
-	sha256Bytes := createSha256(pngBytes, card.marker)
-	_, shaErr := writer.Write(sha256Bytes)
-	if shaErr != nil {
-		err = shaErr
+	sigErr := sf.writeSignature(writer, card, pngBytes, startPos, headerSize)
+	if sigErr != nil {
+		err = sigErr
 		return
 	}
 
-	ppErr := writer.WriteLong(startPos)
-	if ppErr != nil {
-		err = ppErr
+	fluErr := writer.Flush()
+	if fluErr != nil {
+		err = fluErr
 		return
 	}
 
-	hszErr := writer.WriteLong(headerSize)
-	if hszErr != nil {
-		err = hszErr
+	re = true
+	return
+}
+
+// WriteCharaRaw implements for HSChara, copies the original chara bytes
+func (sf *HSChara) WriteCharaRaw(card HSCharaCard, w io.Writer) (re bool, err error) {
+	re = false
+	if card.rawData == nil {
+		err = errors.New("Raw chara data not available")
 		return
 	}
 
-	fluErr := writer.Flush()
-	if fluErr != nil {
-		err = fluErr
+	writer := bbio.NewWriterBuffer()
+
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, card.pngData, ThumbInfo{game: gameHS, sex: card.sex, name: card.name})
+	if pngErr != nil {
+		err = pngErr
+		return
+	}
+
+	_, pwErr := writer.Write(pngBytes)
+	if pwErr != nil {
+		err = pwErr
+		return
+	}
+	startPos := writer.Position()
+
+	_, rwErr := writer.Write(card.rawData)
+	if rwErr != nil {
+		err = rwErr
+		return
+	}
+
+	// the offsets move with the new png
+	sigErr := sf.writeSignature(writer, card, pngBytes, startPos, startPos+card.dataOffset-card.startOffset)
+	if sigErr != nil {
+		err = sigErr
+		return
+	}
+
+	_, wtErr := writer.WriteTo(w)
+	if wtErr != nil {
+		err = wtErr
 		return
 	}
 
@@ -452,8 +617,45 @@ func (sf *HSChara) WriteChara(card HSCharaCard, w io.Writer) (re bool, err error
 	return
 }
 
+// VerifyCharaFile implements for HSChara, re-reads a written card and
+// compares its blocks with the scene ones
+func (sf *HSChara) VerifyCharaFile(card HSCharaCard, filePath string) (err error) {
+	fileBytes, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	reader := bbio.NewReaderBytes(fileBytes)
+	written, wErr := sf.ReadChara(reader, getPngSize(reader))
+	if wErr != nil {
+		err = wErr
+		return
+	}
+
+	if len(written.infoHeader.lstInfo) != len(card.infoHeader.lstInfo) {
+		err = fmt.Errorf("Block count differs after write (%d, want %d)", len(written.infoHeader.lstInfo), len(card.infoHeader.lstInfo))
+		return
+	}
+
+	for i, info := range card.infoHeader.lstInfo {
+		wInfo := written.infoHeader.lstInfo[i]
+		if wInfo.Name != info.Name || wInfo.Version != info.Version {
+			err = fmt.Errorf("Block header %d differs after write (%s %v, want %s %v)", i, wInfo.Name, wInfo.Version, info.Name, info.Version)
+			return
+		}
+
+		cErr := compareBlockData(info.Name, card.data[info.Name], written.data[info.Name])
+		if cErr != nil {
+			err = cErr
+			return
+		}
+	}
+	return
+}
+
 // WriteCharaFile implements for HSChara
-func (sf *HSChara) WriteCharaFile(card HSCharaCard, filePath string) (re bool, err error) {
+func (sf *HSChara) WriteCharaFile(card HSCharaCard, filePath string, opts ExtractOptions) (re bool, err error) {
 	re = false
 	f, cErr := os.Create(filePath)
 	if cErr != nil {
@@ -463,21 +665,43 @@ func (sf *HSChara) WriteCharaFile(card HSCharaCard, filePath string) (re bool, e
 	defer f.Close()
 
 	writer := bufio.NewWriter(f)
+	if opts.raw {
+		return sf.WriteCharaRaw(card, writer)
+	}
 	return sf.WriteChara(card, writer)
 }
 
 // ExtractChara implements for HSChara
-func (sf *HSChara) ExtractChara(currDir string, flag int) (total int, write int, err error) {
-	for k, v := range sf.card.charaCards {
-		total++
+func (sf *HSChara) ExtractChara(currDir string, opts ExtractOptions, report *ExtractReport) (err error) {
+	if opts.hsSig != "" {
+		sf.sigMode = opts.hsSig
+	}
+	sf.thumb = opts.thumb
+	sf.meta = opts.cardMeta
+
+	if sf.sigMode == hsSigPreserve {
+		for _, v := range sf.card.charaCards {
+			if v.pngData == nil {
+				printWarning(errors.New("--hs-sig preserve only applies to standalone cards, scene charas get a new signature"))
+				break
+			}
+		}
+	}
 
-		// Not male
-		if flag == 1 && v.sex != 0 {
+	for k, v := range sf.card.charaCards {
+		if opts.skipGame(gameHS) {
 			continue
 		}
+		report.found(gameHS)
+
+		status, offsetsOK := v.signatureStatus()
+		if status == hsSigMismatch || status == hsSigMalformed || (status != hsSigUnsigned && !offsetsOK) {
+			printWarning(fmt.Errorf("%s: signature %s, offsets consistent: %v", k, status, offsetsOK))
+		} else if opts.verify {
+			fmt.Println("\t", k, "signature:", status)
+		}
 
-		// Not female
-		if flag == 2 && v.sex != 1 {
+		if opts.skipSex(v.sex) {
 			continue
 		}
 
@@ -494,11 +718,19 @@ func (sf *HSChara) ExtractChara(currDir string, flag int) (total int, write int,
 			saveFilePath = path.Join(currDir, fmt.Sprintf("%s-%d.png", k, c))
 		}
 
-		_, saveErr := sf.WriteCharaFile(v, saveFilePath)
+		_, saveErr := sf.WriteCharaFile(v, saveFilePath, opts)
 		if saveErr != nil {
 			printError(saveErr)
-		} else {
-			write++
+			continue
+		}
+		report.wrote(gameHS)
+
+		if opts.verify {
+			vErr := sf.VerifyCharaFile(v, saveFilePath)
+			if vErr != nil {
+				printError(fmt.Errorf("%s: %v", saveFilePath, vErr))
+				report.verifyFailed(gameHS)
+			}
 		}
 	}
 	return
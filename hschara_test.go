@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sulfur/bbio"
+)
+
+// testHSRead reads the single chara of a written HS card
+func testHSRead(t testing.TB, b []byte) HSCharaCard {
+	h := NewHSChara()
+	reader := bbio.NewReaderBytes(b)
+	if _, err := h.ReadCard(reader, getPngSize(reader)); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.card.charaCards) != 1 {
+		t.Fatalf("read %d charas", len(h.card.charaCards))
+	}
+	for _, card := range h.card.charaCards {
+		return card
+	}
+	return HSCharaCard{}
+}
+
+// testHSForeignSig is a version 2 card whose HMAC was not made by us
+func testHSForeignSig(t testing.TB) (HSCharaCard, []byte) {
+	card := testHSCard(t)
+	shot, err := createPng(8, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card.pngData = shot
+
+	var b bytes.Buffer
+	if _, wErr := NewHSChara().WriteChara(card, &b); wErr != nil {
+		t.Fatal(wErr)
+	}
+	data := b.Bytes()
+	foreign := bytes.Repeat([]byte{0xaa}, 32)
+	copy(data[len(data)-48:], foreign)
+	return testHSRead(t, data), foreign
+}
+
+func TestHSSignaturePreserve(t *testing.T) {
+	card, foreign := testHSForeignSig(t)
+	if status, offsetsOK := card.signatureStatus(); status != hsSigMismatch || !offsetsOK {
+		t.Fatalf("source card signature %s, offsets %v", status, offsetsOK)
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		thumb    Thumbnailer
+		status   string
+		keepHMAC bool
+	}{
+		{"preserve, same png", hsSigPreserve, nil, hsSigMismatch, true},
+		{"preserve, new png", hsSigPreserve, LabelThumb{}, hsSigValid, false},
+		{"regenerate", hsSigRegenerate, nil, hsSigValid, false},
+	}
+
+	for _, tt := range tests {
+		h := NewHSChara()
+		h.sigMode = tt.mode
+		h.thumb = tt.thumb
+
+		// the written card moves the chara, both writers must follow it
+		for _, raw := range []bool{false, true} {
+			var b bytes.Buffer
+			var err error
+			if raw {
+				_, err = h.WriteCharaRaw(card, &b)
+			} else {
+				_, err = h.WriteChara(card, &b)
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			written := testHSRead(t, b.Bytes())
+			status, offsetsOK := written.signatureStatus()
+			if status != tt.status || !offsetsOK {
+				t.Errorf("%s, raw %v: signature %s, offsets %v, want %s", tt.name, raw, status, offsetsOK, tt.status)
+			}
+			if got := bytes.Equal(written.sig.hmac, foreign); got != tt.keepHMAC {
+				t.Errorf("%s, raw %v: original HMAC kept %v, want %v", tt.name, raw, got, tt.keepHMAC)
+			}
+			if written.sig.startPos != written.startOffset {
+				t.Errorf("%s, raw %v: startPos %d, chara at %d", tt.name, raw, written.sig.startPos, written.startOffset)
+			}
+		}
+	}
+}
+
+func TestHSSignaturePreserveScene(t *testing.T) {
+	card, foreign := testHSForeignSig(t)
+	// charas read from a scene have no card png
+	card.pngData = nil
+
+	h := NewHSChara()
+	h.sigMode = hsSigPreserve
+	var b bytes.Buffer
+	if _, err := h.WriteChara(card, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	written := testHSRead(t, b.Bytes())
+	if status, offsetsOK := written.signatureStatus(); status != hsSigValid || !offsetsOK {
+		t.Errorf("signature %s, offsets %v, want %s", status, offsetsOK, hsSigValid)
+	}
+	if bytes.Equal(written.sig.hmac, foreign) {
+		t.Error("scene chara kept the original HMAC")
+	}
+}
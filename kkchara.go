@@ -5,13 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
 	"time"
 
 	"github.com/sulfur/bbio"
-	"github.com/vmihailenco/msgpack/v5"
 )
 
 // KKHeaderInfo strcture
@@ -22,11 +22,35 @@ type KKHeaderInfo struct {
 	size    int64
 }
 
-func (info *KKHeaderInfo) fromMap(m map[string]interface{}) {
-	info.name = fmt.Sprintf("%s", m["name"])
-	info.version = fmt.Sprintf("%s", m["version"])
-	info.pos = bbio.Cast.Int64(m["pos"])
-	info.size = bbio.Cast.Int64(m["size"])
+func (info *KKHeaderInfo) fromMap(m bbio.Value) (err error) {
+	name, nameErr := m.Key("name").String()
+	if nameErr != nil {
+		err = nameErr
+		return
+	}
+	info.name = name
+
+	version, verErr := m.Key("version").String()
+	if verErr != nil {
+		err = verErr
+		return
+	}
+	info.version = version
+
+	pos, posErr := m.Key("pos").Int64()
+	if posErr != nil {
+		err = posErr
+		return
+	}
+	info.pos = pos
+
+	size, sizeErr := m.Key("size").Int64()
+	if sizeErr != nil {
+		err = sizeErr
+		return
+	}
+	info.size = size
+	return
 }
 
 // KKCharaCard strcture
@@ -46,8 +70,12 @@ type KKCharaCard struct {
 	infoHeader     struct {
 		lstInfo []KKHeaderInfo
 	}
-	dataSize int64
-	data     map[string][]byte
+	dataSize  int64
+	data      map[string][]byte
+	endOffset int64
+	rawData   []byte
+	// original thumbnail of a standalone card
+	pngData []byte
 }
 
 func (sf *KKCharaCard) findInfo(name string) (info KKHeaderInfo) {
@@ -62,22 +90,45 @@ func (sf *KKCharaCard) findInfo(name string) (info KKHeaderInfo) {
 
 func (sf *KKCharaCard) loadPreviewInfo() (err error) {
 	paraData := sf.data["Parameter"]
-	para := map[string]interface{}{}
-
-	paraErr := msgpack.Unmarshal(paraData, &para)
+	para, paraErr := unmarshalMsgMap(paraData)
 	if paraErr != nil {
 		err = paraErr
 		return
 	}
 
-	sf.sex = bbio.Cast.Int32(para["sex"])
-	sf.lastname = fmt.Sprintf("%s", para["lastname"])
-	sf.firstname = fmt.Sprintf("%s", para["firstname"])
-	sf.nickname = fmt.Sprintf("%s", para["nickname"])
+	paraVal := bbio.Cast.Value("Parameter", para)
+
+	sex, sexErr := paraVal.Key("sex").Int32()
+	if sexErr != nil {
+		printWarning(sexErr)
+	}
+	sf.sex = sex
+
+	lastname, lnErr := paraVal.Key("lastname").String()
+	if lnErr != nil {
+		printWarning(lnErr)
+	}
+	sf.lastname = lastname
+
+	firstname, fnErr := paraVal.Key("firstname").String()
+	if fnErr != nil {
+		printWarning(fnErr)
+	}
+	sf.firstname = firstname
+
+	nickname, nnErr := paraVal.Key("nickname").String()
+	if nnErr != nil {
+		printWarning(nnErr)
+	}
+	sf.nickname = nickname
 
 	return
 }
 
+func (sf *KKCharaCard) fullname() string {
+	return strings.TrimSpace(sf.lastname + " " + sf.firstname)
+}
+
 // KKSceneCard strcture
 type KKSceneCard struct {
 	pngSize    int64
@@ -91,7 +142,9 @@ var kkCharaSPMark = "【KoiKatuCharaSP】"
 
 // KKChara strcture
 type KKChara struct {
-	card *KKSceneCard
+	card  *KKSceneCard
+	thumb Thumbnailer
+	meta  *CardMeta
 }
 
 // NewKKChara implements for KKChara
@@ -105,6 +158,12 @@ func IsKStudioSceneCard(reader *bbio.Reader) bool {
 	return (reader.Index([]byte(kkStudioMark)) > 0)
 }
 
+// IsKKCharaCard implements for standalone KK chara card
+func IsKKCharaCard(reader *bbio.Reader, pngSize int64) bool {
+	mark := readCardMark(reader, pngSize, 4)
+	return mark == kkCharaMark || mark == kkCharaSMark || mark == kkCharaSPMark
+}
+
 // GenerateFileName implements for KKChara
 func (sf *KKChara) GenerateFileName(sex int32) string {
 	time.Sleep(2 * time.Millisecond)
@@ -125,6 +184,8 @@ func (sf *KKChara) GenerateFileName(sex int32) string {
 
 // ReadChara implements for KKChara
 func (sf *KKChara) ReadChara(reader *bbio.Reader, offset int64) (card KKCharaCard, err error) {
+	defer recoverParse(&err)
+
 	startOffset, seekErr := reader.Seek(offset, io.SeekStart)
 	if seekErr != nil {
 		err = seekErr
@@ -168,8 +229,7 @@ func (sf *KKChara) ReadChara(reader *bbio.Reader, offset int64) (card KKCharaCar
 	}
 	card.faceLength = flen
 
-	fData := make([]byte, flen)
-	_, fdErr := reader.Read(fData)
+	fData, fdErr := readBlock(reader, int64(flen))
 	if fdErr != nil {
 		err = fdErr
 		return
@@ -182,21 +242,26 @@ func (sf *KKChara) ReadChara(reader *bbio.Reader, offset int64) (card KKCharaCar
 		return
 	}
 
-	headerBytes := make([]byte, headersz)
-	_, hrErr := reader.Read(headerBytes)
+	headerBytes, hrErr := readBlock(reader, int64(headersz))
 	if hrErr != nil {
 		err = hrErr
 		return
 	}
 	card.infoHeaderSize = headersz
 
-	blockHead := map[string][]map[string]interface{}{}
-	bhErr := msgpack.Unmarshal(headerBytes, &blockHead)
+	blockHead, bhErr := unmarshalMsgMap(headerBytes)
 	if bhErr != nil {
 		err = bhErr
 		return
 	}
 
+	lstInfo := bbio.Cast.Value("BlockHeader", blockHead).Key("lstInfo")
+	lstInfoArr, lstErr := lstInfo.Slice()
+	if lstErr != nil {
+		err = lstErr
+		return
+	}
+
 	datasz, dataszErr := reader.ReadInt64()
 	if dataszErr != nil {
 		err = dataszErr
@@ -207,11 +272,15 @@ func (sf *KKChara) ReadChara(reader *bbio.Reader, offset int64) (card KKCharaCar
 	dataOffset := reader.Position()
 	card.data = make(map[string][]byte)
 
-	infoCount := len(blockHead["lstInfo"])
+	infoCount := len(lstInfoArr)
 	card.infoHeader.lstInfo = make([]KKHeaderInfo, infoCount)
 
 	for i := 0; i < infoCount; i++ {
-		card.infoHeader.lstInfo[i].fromMap(blockHead["lstInfo"][i])
+		infoErr := card.infoHeader.lstInfo[i].fromMap(lstInfo.Index(i))
+		if infoErr != nil {
+			err = infoErr
+			return
+		}
 		info := card.infoHeader.lstInfo[i]
 
 		sbOffset := dataOffset + info.pos
@@ -221,8 +290,7 @@ func (sf *KKChara) ReadChara(reader *bbio.Reader, offset int64) (card KKCharaCar
 			return
 		}
 
-		bBytes := make([]byte, info.size)
-		_, rbErr := reader.Read(bBytes)
+		bBytes, rbErr := readBlock(reader, info.size)
 		if rbErr != nil {
 			err = rbErr
 			return
@@ -231,6 +299,9 @@ func (sf *KKChara) ReadChara(reader *bbio.Reader, offset int64) (card KKCharaCar
 		card.data[info.name] = bBytes
 	}
 
+	card.endOffset = dataOffset + datasz
+	card.rawData = rawRange(reader, card.startOffset, card.endOffset)
+
 	loadErr := card.loadPreviewInfo()
 	if loadErr != nil {
 		err = loadErr
@@ -241,10 +312,13 @@ func (sf *KKChara) ReadChara(reader *bbio.Reader, offset int64) (card KKCharaCar
 }
 
 // ReadScene implements for KKChara
-func (sf *KKChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
+func (sf *KKChara) ReadScene(reader *bbio.Reader, pngSize int64) (re bool, err error) {
+	defer recoverParse(&err)
+
 	_, seekErr := reader.Seek(pngSize, io.SeekStart)
 	if seekErr != nil {
-		return false, seekErr
+		err = seekErr
+		return
 	}
 
 	sf.card.pngSize = pngSize
@@ -252,6 +326,12 @@ func (sf *KKChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
 
 	idxs := reader.FindAll([]byte(kkCharaMark))
 	for _, v := range idxs {
+		countErr := checkCharaCount(len(sf.card.charaCards))
+		if countErr != nil {
+			err = countErr
+			return
+		}
+
 		chara, cerr := sf.ReadChara(reader, int64(v-5))
 		if cerr != nil {
 			if isDebug {
@@ -268,6 +348,12 @@ func (sf *KKChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
 
 	idxss := reader.FindAll([]byte(kkCharaSMark))
 	for _, v := range idxss {
+		countErr := checkCharaCount(len(sf.card.charaCards))
+		if countErr != nil {
+			err = countErr
+			return
+		}
+
 		chara, cerr := sf.ReadChara(reader, int64(v-5))
 		if cerr != nil {
 			if isDebug {
@@ -284,6 +370,12 @@ func (sf *KKChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
 
 	idxsp := reader.FindAll([]byte(kkCharaSPMark))
 	for _, v := range idxsp {
+		countErr := checkCharaCount(len(sf.card.charaCards))
+		if countErr != nil {
+			err = countErr
+			return
+		}
+
 		chara, cerr := sf.ReadChara(reader, int64(v-5))
 		if cerr != nil {
 			if isDebug {
@@ -298,15 +390,38 @@ func (sf *KKChara) ReadScene(reader *bbio.Reader, pngSize int64) (bool, error) {
 		}
 	}
 
-	return len(sf.card.charaCards) > 0, nil
+	re = len(sf.card.charaCards) > 0
+	return
+}
+
+// ReadCard implements for KKChara, reads a standalone chara card
+func (sf *KKChara) ReadCard(reader *bbio.Reader, pngSize int64) (re bool, err error) {
+	defer recoverParse(&err)
+
+	sf.card.pngSize = pngSize
+	sf.card.charaCards = make(map[string]KKCharaCard)
+
+	chara, cErr := sf.ReadChara(reader, pngSize)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	chara.pngSize = pngSize
+	chara.pngData = rawRange(reader, 0, pngSize)
+
+	charFileName := sf.GenerateFileName(chara.sex)
+	sf.card.charaCards[charFileName] = chara
+
+	re = true
+	return
 }
 
 // WriteChara implements for KKChara
 func (sf *KKChara) WriteChara(card KKCharaCard, w io.Writer) (re bool, err error) {
 	re = false
-	writer := bbio.NewWriter(w)
+	writer := bbio.NewWriterBuffer()
 
-	pngBytes, pngErr := createPng(252, 352, int(card.sex))
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, card.pngData, ThumbInfo{game: gameKK, sex: card.sex, name: card.fullname(), face: card.faceData})
 	if pngErr != nil {
 		err = pngErr
 		return
@@ -348,74 +463,31 @@ func (sf *KKChara) WriteChara(card KKCharaCard, w io.Writer) (re bool, err error
 		return
 	}
 
-	keyArr := []string{"Custom", "Coordinate", "Parameter", "Status"}
-	keyExtra := "KKEx"
-
 	infoCount := len(card.infoHeader.lstInfo)
-	lstInfo := make([]map[string]interface{}, infoCount)
-	lstData := make(map[int][]byte)
-
-	var i, d int
-	var pos, datasz int64
-	d = 0
-	pos = int64(0)
-
-	infoEx := card.findInfo(keyExtra)
-	if infoEx.name == keyExtra {
-		i++
-	}
-
-	for _, key := range keyArr {
-		info := card.findInfo(key)
-		if info.name == key {
-			lstData[d] = card.data[key]
-			size := int64(len(lstData[d]))
-
-			infoMap := map[string]interface{}{
-				"name":    fmt.Sprintf(info.name),
-				"version": fmt.Sprintf("%s", info.version),
-				"pos":     pos,
-				"size":    size,
-			}
-			lstInfo[i] = infoMap
-
-			pos += size
-			datasz += size
+	lstInfo := make([]msgBlockInfo, infoCount)
+	lstPos := make([]int64, infoCount)
 
-			d++
-			i++
-		}
+	for i, info := range card.infoHeader.lstInfo {
+		lstInfo[i] = msgBlockInfo{Name: info.name, Version: info.version}
+		lstPos[i] = info.pos
 	}
 
-	if infoEx.name == keyExtra {
-		lstData[d] = card.data[keyExtra]
-		size := int64(len(lstData[d]))
-
-		infoMap := map[string]interface{}{
-			"name":    fmt.Sprintf(infoEx.name),
-			"version": fmt.Sprintf("%s", infoEx.version),
-			"pos":     pos,
-			"size":    size,
-		}
-		lstInfo[0] = infoMap
-
-		d++
+	var pos int64
+	order := blockDataOrder(lstPos)
+	for _, i := range order {
+		size := int64(len(card.data[lstInfo[i].Name]))
+		lstInfo[i].Pos = pos
+		lstInfo[i].Size = size
 		pos += size
-		datasz += size
-	}
-
-	blockHead := map[string][]map[string]interface{}{
-		"lstInfo": lstInfo,
 	}
 
-	head, msgErr := msgpack.Marshal(&blockHead)
+	head, msgErr := marshalBlockHeader(lstInfo)
 	if msgErr != nil {
 		err = msgErr
 		return
 	}
 
-	headsz := len(head)
-	headszErr := writer.WriteInt(int32(headsz))
+	headsz, headszErr := writer.ReserveInt()
 	if headszErr != nil {
 		err = headszErr
 		return
@@ -427,23 +499,35 @@ func (sf *KKChara) WriteChara(card KKCharaCard, w io.Writer) (re bool, err error
 		return
 	}
 
-	dataszErr := writer.WriteLong(datasz)
+	hpErr := writer.PatchLength(headsz)
+	if hpErr != nil {
+		err = hpErr
+		return
+	}
+
+	datasz, dataszErr := writer.ReserveLong()
 	if dataszErr != nil {
 		err = dataszErr
 		return
 	}
 
-	for j := 0; j < d; j++ {
-		_, sErr := writer.Write(lstData[j])
+	for _, i := range order {
+		_, sErr := writer.Write(card.data[lstInfo[i].Name])
 		if sErr != nil {
 			err = sErr
 			return
 		}
 	}
 
-	fluErr := writer.Flush()
-	if fluErr != nil {
-		err = fluErr
+	dpErr := writer.PatchLength(datasz)
+	if dpErr != nil {
+		err = dpErr
+		return
+	}
+
+	_, wtErr := writer.WriteTo(w)
+	if wtErr != nil {
+		err = wtErr
 		return
 	}
 
@@ -452,8 +536,83 @@ func (sf *KKChara) WriteChara(card KKCharaCard, w io.Writer) (re bool, err error
 	return
 }
 
+// WriteCharaRaw implements for KKChara, copies the original chara bytes
+func (sf *KKChara) WriteCharaRaw(card KKCharaCard, w io.Writer) (re bool, err error) {
+	re = false
+	if card.rawData == nil {
+		err = errors.New("Raw chara data not available")
+		return
+	}
+
+	writer := bbio.NewWriterBuffer()
+
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, card.pngData, ThumbInfo{game: gameKK, sex: card.sex, name: card.fullname(), face: card.faceData})
+	if pngErr != nil {
+		err = pngErr
+		return
+	}
+
+	_, pwErr := writer.Write(pngBytes)
+	if pwErr != nil {
+		err = pwErr
+		return
+	}
+
+	_, rwErr := writer.Write(card.rawData)
+	if rwErr != nil {
+		err = rwErr
+		return
+	}
+
+	_, wtErr := writer.WriteTo(w)
+	if wtErr != nil {
+		err = wtErr
+		return
+	}
+
+	re = true
+	return
+}
+
+// VerifyCharaFile implements for KKChara, re-reads a written card and
+// compares its blocks with the scene ones
+func (sf *KKChara) VerifyCharaFile(card KKCharaCard, filePath string) (err error) {
+	fileBytes, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	reader := bbio.NewReaderBytes(fileBytes)
+	written, wErr := sf.ReadChara(reader, getPngSize(reader))
+	if wErr != nil {
+		err = wErr
+		return
+	}
+
+	if len(written.infoHeader.lstInfo) != len(card.infoHeader.lstInfo) {
+		err = fmt.Errorf("Block count differs after write (%d, want %d)", len(written.infoHeader.lstInfo), len(card.infoHeader.lstInfo))
+		return
+	}
+
+	for i, info := range card.infoHeader.lstInfo {
+		wInfo := written.infoHeader.lstInfo[i]
+		if wInfo.name != info.name || wInfo.version != info.version {
+			err = fmt.Errorf("Block header %d differs after write (%s %v, want %s %v)", i, wInfo.name, wInfo.version, info.name, info.version)
+			return
+		}
+
+		cErr := compareBlockData(info.name, card.data[info.name], written.data[info.name])
+		if cErr != nil {
+			err = cErr
+			return
+		}
+	}
+	return
+}
+
 // WriteCharaFile implements for KKChara
-func (sf *KKChara) WriteCharaFile(card KKCharaCard, filePath string) (re bool, err error) {
+func (sf *KKChara) WriteCharaFile(card KKCharaCard, filePath string, opts ExtractOptions) (re bool, err error) {
 	re = false
 	f, cErr := os.Create(filePath)
 	if cErr != nil {
@@ -463,21 +622,24 @@ func (sf *KKChara) WriteCharaFile(card KKCharaCard, filePath string) (re bool, e
 	defer f.Close()
 
 	writer := bufio.NewWriter(f)
+	if opts.raw {
+		return sf.WriteCharaRaw(card, writer)
+	}
 	return sf.WriteChara(card, writer)
 }
 
 // ExtractChara implements for KKChara
-func (sf *KKChara) ExtractChara(currDir string, flag int) (total int, write int, err error) {
-	for k, v := range sf.card.charaCards {
-		total++
+func (sf *KKChara) ExtractChara(currDir string, opts ExtractOptions, report *ExtractReport) (err error) {
+	sf.thumb = opts.thumb
+	sf.meta = opts.cardMeta
 
-		// Not male
-		if flag == 1 && v.sex != 0 {
+	for k, v := range sf.card.charaCards {
+		if opts.skipGame(gameKK) {
 			continue
 		}
+		report.found(gameKK)
 
-		// Not female
-		if flag == 2 && v.sex != 1 {
+		if opts.skipSex(v.sex) {
 			continue
 		}
 
@@ -494,11 +656,19 @@ func (sf *KKChara) ExtractChara(currDir string, flag int) (total int, write int,
 			saveFilePath = path.Join(currDir, fmt.Sprintf("%s-%d.png", k, c))
 		}
 
-		_, saveErr := sf.WriteCharaFile(v, saveFilePath)
+		_, saveErr := sf.WriteCharaFile(v, saveFilePath, opts)
 		if saveErr != nil {
 			printError(saveErr)
-		} else {
-			write++
+			continue
+		}
+		report.wrote(gameKK)
+
+		if opts.verify {
+			vErr := sf.VerifyCharaFile(v, saveFilePath)
+			if vErr != nil {
+				printError(fmt.Errorf("%s: %v", saveFilePath, vErr))
+				report.verifyFailed(gameKK)
+			}
 		}
 	}
 	return
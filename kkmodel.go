@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// KKAnswerInfo strcture
+type KKAnswerInfo struct {
+	msgRaw
+	Animal      bool `msgpack:"animal"`
+	Eat         bool `msgpack:"eat"`
+	Cook        bool `msgpack:"cook"`
+	Exercise    bool `msgpack:"exercise"`
+	Study       bool `msgpack:"study"`
+	Fashionable bool `msgpack:"fashionable"`
+	BlackCoffee bool `msgpack:"blackCoffee"`
+	Spicy       bool `msgpack:"spicy"`
+	Sweet       bool `msgpack:"sweet"`
+}
+
+// DecodeMsgpack implements for KKAnswerInfo
+func (m *KKAnswerInfo) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKAnswerInfo
+func (m *KKAnswerInfo) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKDenialInfo strcture
+type KKDenialInfo struct {
+	msgRaw
+	Kiss      bool `msgpack:"kiss"`
+	Aibu      bool `msgpack:"aibu"`
+	Anal      bool `msgpack:"anal"`
+	Massage   bool `msgpack:"massage"`
+	NotCondom bool `msgpack:"notCondom"`
+}
+
+// DecodeMsgpack implements for KKDenialInfo
+func (m *KKDenialInfo) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKDenialInfo
+func (m *KKDenialInfo) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKAttributeInfo strcture
+type KKAttributeInfo struct {
+	msgRaw
+	Hinnyo    bool `msgpack:"hinnyo"`
+	Harapeko  bool `msgpack:"harapeko"`
+	Donkan    bool `msgpack:"donkan"`
+	Choroi    bool `msgpack:"choroi"`
+	Bitch     bool `msgpack:"bitch"`
+	Mutturi   bool `msgpack:"mutturi"`
+	Dokusyo   bool `msgpack:"dokusyo"`
+	Ongaku    bool `msgpack:"ongaku"`
+	Kappatu   bool `msgpack:"kappatu"`
+	Ukemi     bool `msgpack:"ukemi"`
+	Friendly  bool `msgpack:"friendly"`
+	Kireizuki bool `msgpack:"kireizuki"`
+	Taida     bool `msgpack:"taida"`
+	Sinsyutu  bool `msgpack:"sinsyutu"`
+	Hitori    bool `msgpack:"hitori"`
+	Undo      bool `msgpack:"undo"`
+	Majime    bool `msgpack:"majime"`
+	LikeGirls bool `msgpack:"likeGirls"`
+}
+
+// DecodeMsgpack implements for KKAttributeInfo
+func (m *KKAttributeInfo) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKAttributeInfo
+func (m *KKAttributeInfo) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKParameter strcture
+type KKParameter struct {
+	msgRaw
+	Version        string          `msgpack:"version"`
+	Sex            int32           `msgpack:"sex"`
+	ExType         int32           `msgpack:"exType"`
+	Lastname       string          `msgpack:"lastname"`
+	Firstname      string          `msgpack:"firstname"`
+	Nickname       string          `msgpack:"nickname"`
+	CallType       int32           `msgpack:"callType"`
+	Personality    int32           `msgpack:"personality"`
+	BloodType      int32           `msgpack:"bloodType"`
+	BirthMonth     int32           `msgpack:"birthMonth"`
+	BirthDay       int32           `msgpack:"birthDay"`
+	ClubActivities int32           `msgpack:"clubActivities"`
+	VoiceRate      float32         `msgpack:"voiceRate"`
+	WeakPoint      int32           `msgpack:"weakPoint"`
+	Awnser         KKAnswerInfo    `msgpack:"awnser"`
+	Denial         KKDenialInfo    `msgpack:"denial"`
+	Attribute      KKAttributeInfo `msgpack:"attribute"`
+	Aggressive     int32           `msgpack:"aggressive"`
+	Diligence      int32           `msgpack:"diligence"`
+	Kindness       int32           `msgpack:"kindness"`
+}
+
+// DecodeMsgpack implements for KKParameter
+func (m *KKParameter) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKParameter
+func (m *KKParameter) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKStatus strcture
+type KKStatus struct {
+	msgRaw
+	Version        string  `msgpack:"version"`
+	ClothesState   []byte  `msgpack:"clothesState"`
+	ShoesType      int32   `msgpack:"shoesType"`
+	HohoAkaRate    float32 `msgpack:"hohoAkaRate"`
+	TearsLv        int32   `msgpack:"tearsLv"`
+	EyesLookPtn    int32   `msgpack:"eyesLookPtn"`
+	EyesPtn        int32   `msgpack:"eyesPtn"`
+	EyesOpenMax    float32 `msgpack:"eyesOpenMax"`
+	EyesBlink      bool    `msgpack:"eyesBlink"`
+	EyebrowPtn     int32   `msgpack:"eyebrowPtn"`
+	EyebrowOpenMax float32 `msgpack:"eyebrowOpenMax"`
+	MouthPtn       int32   `msgpack:"mouthPtn"`
+	MouthOpenMax   float32 `msgpack:"mouthOpenMax"`
+	MouthFixed     bool    `msgpack:"mouthFixed"`
+	NeckLookPtn    int32   `msgpack:"neckLookPtn"`
+	ShowAccessory  []bool  `msgpack:"showAccessory"`
+	CoordinateType int32   `msgpack:"coordinateType"`
+	NipStand       float32 `msgpack:"nipStand"`
+	SiruLv         []byte  `msgpack:"siruLv"`
+	VisibleSon     bool    `msgpack:"visibleSon"`
+	VisibleSimple  bool    `msgpack:"visibleSimple"`
+}
+
+// DecodeMsgpack implements for KKStatus
+func (m *KKStatus) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKStatus
+func (m *KKStatus) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKMakeup strcture
+type KKMakeup struct {
+	msgRaw
+	EyeshadowID    int32       `msgpack:"eyeshadowId"`
+	EyeshadowColor []float32   `msgpack:"eyeshadowColor"`
+	CheekID        int32       `msgpack:"cheekId"`
+	CheekColor     []float32   `msgpack:"cheekColor"`
+	LipID          int32       `msgpack:"lipId"`
+	LipColor       []float32   `msgpack:"lipColor"`
+	PaintID        []int32     `msgpack:"paintId"`
+	PaintColor     [][]float32 `msgpack:"paintColor"`
+	PaintLayout    [][]float32 `msgpack:"paintLayout"`
+}
+
+// DecodeMsgpack implements for KKMakeup
+func (m *KKMakeup) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKMakeup
+func (m *KKMakeup) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKFace strcture
+type KKFace struct {
+	msgRaw
+	Version        string    `msgpack:"version"`
+	ShapeValueFace []float32 `msgpack:"shapeValueFace"`
+	HeadID         int32     `msgpack:"headId"`
+	SkinID         int32     `msgpack:"skinId"`
+	DetailID       int32     `msgpack:"detailId"`
+	DetailPower    float32   `msgpack:"detailPower"`
+	EyebrowID      int32     `msgpack:"eyebrowId"`
+	EyebrowColor   []float32 `msgpack:"eyebrowColor"`
+	NoseID         int32     `msgpack:"noseId"`
+	HlUpID         int32     `msgpack:"hlUpId"`
+	HlDownID       int32     `msgpack:"hlDownId"`
+	EyelineUpID    int32     `msgpack:"eyelineUpId"`
+	EyelineDownID  int32     `msgpack:"eyelineDownId"`
+	EyelineColor   []float32 `msgpack:"eyelineColor"`
+	MoleID         int32     `msgpack:"moleId"`
+	MoleColor      []float32 `msgpack:"moleColor"`
+	MoleLayout     []float32 `msgpack:"moleLayout"`
+	LipLineID      int32     `msgpack:"lipLineId"`
+	LipLineColor   []float32 `msgpack:"lipLineColor"`
+	LipGlossPower  float32   `msgpack:"lipGlossPower"`
+	DoubleTooth    bool      `msgpack:"doubleTooth"`
+	BaseMakeup     KKMakeup  `msgpack:"baseMakeup"`
+}
+
+// DecodeMsgpack implements for KKFace
+func (m *KKFace) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKFace
+func (m *KKFace) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKBody strcture
+type KKBody struct {
+	msgRaw
+	Version        string    `msgpack:"version"`
+	ShapeValueBody []float32 `msgpack:"shapeValueBody"`
+	BustSoftness   float32   `msgpack:"bustSoftness"`
+	BustWeight     float32   `msgpack:"bustWeight"`
+	SkinID         int32     `msgpack:"skinId"`
+	DetailID       int32     `msgpack:"detailId"`
+	DetailPower    float32   `msgpack:"detailPower"`
+	SkinMainColor  []float32 `msgpack:"skinMainColor"`
+	SkinSubColor   []float32 `msgpack:"skinSubColor"`
+	SkinGlossPower float32   `msgpack:"skinGlossPower"`
+	SunburnID      int32     `msgpack:"sunburnId"`
+	NipID          int32     `msgpack:"nipId"`
+	UnderhairID    int32     `msgpack:"underhairId"`
+	NailColor      []float32 `msgpack:"nailColor"`
+	AreolaSize     float32   `msgpack:"areolaSize"`
+}
+
+// DecodeMsgpack implements for KKBody
+func (m *KKBody) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKBody
+func (m *KKBody) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKHairParts strcture
+type KKHairParts struct {
+	msgRaw
+	ID           int32       `msgpack:"id"`
+	BaseColor    []float32   `msgpack:"baseColor"`
+	StartColor   []float32   `msgpack:"startColor"`
+	EndColor     []float32   `msgpack:"endColor"`
+	OutlineColor []float32   `msgpack:"outlineColor"`
+	AcsColor     [][]float32 `msgpack:"acsColor"`
+	Length       float32     `msgpack:"length"`
+}
+
+// DecodeMsgpack implements for KKHairParts
+func (m *KKHairParts) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKHairParts
+func (m *KKHairParts) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKHair strcture
+type KKHair struct {
+	msgRaw
+	Version string        `msgpack:"version"`
+	Parts   []KKHairParts `msgpack:"parts"`
+	Kind    int32         `msgpack:"kind"`
+	GlossID int32         `msgpack:"glossId"`
+}
+
+// DecodeMsgpack implements for KKHair
+func (m *KKHair) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKHair
+func (m *KKHair) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKCustom strcture
+type KKCustom struct {
+	Face  KKFace
+	Body  KKBody
+	Hair  KKHair
+	extra []byte
+}
+
+func parseKKCustom(data []byte) (custom KKCustom, err error) {
+	var off int
+	models := []msgModel{&custom.Face, &custom.Body, &custom.Hair}
+	for _, m := range models {
+		block, bErr := readSizedBlock(data, &off)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+
+		mErr := unmarshalModel(block, m)
+		if mErr != nil {
+			err = mErr
+			return
+		}
+	}
+	custom.extra = data[off:]
+	return
+}
+
+func (custom *KKCustom) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	models := []msgModel{&custom.Face, &custom.Body, &custom.Hair}
+	for _, m := range models {
+		block, mErr := marshalModel(m)
+		if mErr != nil {
+			return nil, mErr
+		}
+		writeSizedBlock(&buf, block)
+	}
+	buf.Write(custom.extra)
+	return buf.Bytes(), nil
+}
+
+// KKClothesColor strcture
+type KKClothesColor struct {
+	msgRaw
+	BaseColor    []float32 `msgpack:"baseColor"`
+	Pattern      int32     `msgpack:"pattern"`
+	PatternColor []float32 `msgpack:"patternColor"`
+	Tiling       []float32 `msgpack:"tiling"`
+}
+
+// DecodeMsgpack implements for KKClothesColor
+func (m *KKClothesColor) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKClothesColor
+func (m *KKClothesColor) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKClothesParts strcture
+type KKClothesParts struct {
+	msgRaw
+	ID        int32            `msgpack:"id"`
+	ColorInfo []KKClothesColor `msgpack:"colorInfo"`
+	HideOpt   []bool           `msgpack:"hideOpt"`
+	EmblemeID int32            `msgpack:"emblemeId"`
+}
+
+// DecodeMsgpack implements for KKClothesParts
+func (m *KKClothesParts) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKClothesParts
+func (m *KKClothesParts) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKClothes strcture
+type KKClothes struct {
+	msgRaw
+	Version       string           `msgpack:"version"`
+	Parts         []KKClothesParts `msgpack:"parts"`
+	SubPartsID    []int32          `msgpack:"subPartsId"`
+	HideBraOpt    []bool           `msgpack:"hideBraOpt"`
+	HideShortsOpt []bool           `msgpack:"hideShortsOpt"`
+}
+
+// DecodeMsgpack implements for KKClothes
+func (m *KKClothes) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKClothes
+func (m *KKClothes) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKAccessoryParts strcture
+type KKAccessoryParts struct {
+	msgRaw
+	Type         int32       `msgpack:"type"`
+	ID           int32       `msgpack:"id"`
+	ParentKey    string      `msgpack:"parentKey"`
+	Color        [][]float32 `msgpack:"color"`
+	HideCategory int32       `msgpack:"hideCategory"`
+}
+
+// DecodeMsgpack implements for KKAccessoryParts
+func (m *KKAccessoryParts) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKAccessoryParts
+func (m *KKAccessoryParts) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKAccessory strcture
+type KKAccessory struct {
+	msgRaw
+	Version string             `msgpack:"version"`
+	Parts   []KKAccessoryParts `msgpack:"parts"`
+}
+
+// DecodeMsgpack implements for KKAccessory
+func (m *KKAccessory) DecodeMsgpack(dec *msgpack.Decoder) error { return decodeModel(dec, m) }
+
+// EncodeMsgpack implements for KKAccessory
+func (m *KKAccessory) EncodeMsgpack(enc *msgpack.Encoder) error { return encodeModel(enc, m) }
+
+// KKCoordinate strcture
+type KKCoordinate struct {
+	Clothes      KKClothes
+	Accessory    KKAccessory
+	EnableMakeup bool
+	Makeup       KKMakeup
+	extra        []byte
+}
+
+func parseKKCoordinate(data []byte) (coord KKCoordinate, err error) {
+	var off int
+	clothes, cErr := readSizedBlock(data, &off)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	cmErr := unmarshalModel(clothes, &coord.Clothes)
+	if cmErr != nil {
+		err = cmErr
+		return
+	}
+
+	accessory, aErr := readSizedBlock(data, &off)
+	if aErr != nil {
+		err = aErr
+		return
+	}
+	amErr := unmarshalModel(accessory, &coord.Accessory)
+	if amErr != nil {
+		err = amErr
+		return
+	}
+
+	if off >= len(data) {
+		err = errors.New("Coordinate makeup flag missing")
+		return
+	}
+	coord.EnableMakeup = data[off] != 0
+	off++
+
+	makeup, mErr := readSizedBlock(data, &off)
+	if mErr != nil {
+		err = mErr
+		return
+	}
+	mmErr := unmarshalModel(makeup, &coord.Makeup)
+	if mmErr != nil {
+		err = mmErr
+		return
+	}
+
+	coord.extra = data[off:]
+	return
+}
+
+func (coord *KKCoordinate) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	clothes, cErr := marshalModel(&coord.Clothes)
+	if cErr != nil {
+		return nil, cErr
+	}
+	writeSizedBlock(&buf, clothes)
+
+	accessory, aErr := marshalModel(&coord.Accessory)
+	if aErr != nil {
+		return nil, aErr
+	}
+	writeSizedBlock(&buf, accessory)
+
+	if coord.EnableMakeup {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+
+	makeup, mErr := marshalModel(&coord.Makeup)
+	if mErr != nil {
+		return nil, mErr
+	}
+	writeSizedBlock(&buf, makeup)
+
+	buf.Write(coord.extra)
+	return buf.Bytes(), nil
+}
+
+// splitKKCoordinates is the serialized outfit of every coordinate slot
+func splitKKCoordinates(data []byte) (lstData [][]byte, err error) {
+	err = newMsgDecoder(data).Decode(&lstData)
+	return
+}
+
+func parseKKCoordinates(data []byte) (lstCoord []KKCoordinate, err error) {
+	lstData, uErr := splitKKCoordinates(data)
+	if uErr != nil {
+		err = uErr
+		return
+	}
+
+	lstCoord = make([]KKCoordinate, len(lstData))
+	for i, v := range lstData {
+		coord, cErr := parseKKCoordinate(v)
+		if cErr != nil {
+			err = cErr
+			return
+		}
+		lstCoord[i] = coord
+	}
+	return
+}
+
+func marshalKKCoordinates(lstCoord []KKCoordinate) ([]byte, error) {
+	lstData := make([][]byte, len(lstCoord))
+	for i := range lstCoord {
+		b, bErr := lstCoord[i].bytes()
+		if bErr != nil {
+			return nil, bErr
+		}
+		lstData[i] = b
+	}
+
+	var buf bytes.Buffer
+	err := newMsgEncoder(&buf).Encode(lstData)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Parameter implements for KKCharaCard
+func (sf *KKCharaCard) Parameter() (para KKParameter, err error) {
+	err = loadModel(sf.data, "Parameter", &para)
+	return
+}
+
+// SetParameter implements for KKCharaCard
+func (sf *KKCharaCard) SetParameter(para *KKParameter) error {
+	return storeModel(sf.data, "Parameter", para)
+}
+
+// Status implements for KKCharaCard
+func (sf *KKCharaCard) Status() (status KKStatus, err error) {
+	err = loadModel(sf.data, "Status", &status)
+	return
+}
+
+// SetStatus implements for KKCharaCard
+func (sf *KKCharaCard) SetStatus(status *KKStatus) error {
+	return storeModel(sf.data, "Status", status)
+}
+
+// Custom implements for KKCharaCard
+func (sf *KKCharaCard) Custom() (KKCustom, error) {
+	return parseKKCustom(sf.data["Custom"])
+}
+
+// SetCustom implements for KKCharaCard
+func (sf *KKCharaCard) SetCustom(custom *KKCustom) (err error) {
+	data, mErr := custom.bytes()
+	if mErr != nil {
+		err = mErr
+		return
+	}
+	sf.data["Custom"] = data
+	return
+}
+
+// Coordinates implements for KKCharaCard
+func (sf *KKCharaCard) Coordinates() ([]KKCoordinate, error) {
+	return parseKKCoordinates(sf.data["Coordinate"])
+}
+
+// SetCoordinates implements for KKCharaCard
+func (sf *KKCharaCard) SetCoordinates(lstCoord []KKCoordinate) (err error) {
+	data, mErr := marshalKKCoordinates(lstCoord)
+	if mErr != nil {
+		err = mErr
+		return
+	}
+	sf.data["Coordinate"] = data
+	return
+}
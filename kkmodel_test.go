@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// testSizedBlocks joins blocks the way Custom and Coordinate store them
+func testSizedBlocks(blocks ...[]byte) []byte {
+	var b bytes.Buffer
+	for _, block := range blocks {
+		writeSizedBlock(&b, block)
+	}
+	return b.Bytes()
+}
+
+func testKKCustom(t testing.TB) []byte {
+	face := testMsgMap(t,
+		"version", "0.0.2",
+		"headId", testMsgInt32(1),
+		"detailPower", testMsgFloat32(t, 0.4),
+		"baseMakeup", msgpack.RawMessage(testMsgMap(t, "lipId", testMsgInt32(2), "unknownMakeup", true)),
+	)
+	body := testMsgMap(t, "version", "0.0.2", "bustSoftness", testMsgFloat32(t, 0.6), "futureBody", "x")
+	hair := testMsgMap(t, "version", "0.0.4", "parts", []interface{}{}, "glossId", testMsgInt32(0))
+	return append(testSizedBlocks(face, body, hair), 7, 7)
+}
+
+func TestKKModelRoundTrip(t *testing.T) {
+	card := testKKCard(t)
+	card.data["Custom"] = testKKCustom(t)
+	card.data["Parameter"] = testMsgMap(t,
+		"version", "0.0.0",
+		"sex", testMsgInt32(1),
+		"voiceRate", testMsgFloat32(t, 0.7),
+		"awnser", msgpack.RawMessage(testMsgMap(t, "cook", true, "futureAnswer", 1)),
+		"futureParameter", []interface{}{"a"},
+	)
+	orig := make(map[string][]byte)
+	for k, v := range card.data {
+		orig[k] = append([]byte{}, v...)
+	}
+
+	para, pErr := card.Parameter()
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	status, sErr := card.Status()
+	if sErr != nil {
+		t.Fatal(sErr)
+	}
+	custom, cErr := card.Custom()
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	lstCoord, lErr := card.Coordinates()
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	if len(lstCoord) != len(kkCoordinateNames) || lstCoord[3].Clothes.Parts[0].ID != 3 || lstCoord[3].Makeup.CheekID != 2 {
+		t.Fatalf("coordinates read as %+v", lstCoord)
+	}
+
+	for _, err := range []error{
+		card.SetParameter(&para),
+		card.SetStatus(&status),
+		card.SetCustom(&custom),
+		card.SetCoordinates(lstCoord),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range orig {
+		if !bytes.Equal(card.data[name], want) {
+			t.Errorf("%s block changed\n got % x\nwant % x", name, card.data[name], want)
+		}
+	}
+}
+
+func TestKKModelEdit(t *testing.T) {
+	card := testKKCard(t)
+	card.data["Custom"] = testKKCustom(t)
+
+	custom, err := card.Custom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom.Body.BustSoftness = 0.5
+	if sErr := card.SetCustom(&custom); sErr != nil {
+		t.Fatal(sErr)
+	}
+
+	edited, eErr := card.Custom()
+	if eErr != nil {
+		t.Fatal(eErr)
+	}
+	if edited.Body.BustSoftness != 0.5 || edited.Face.DetailPower != 0.4 || !bytes.Equal(edited.extra, []byte{7, 7}) {
+		t.Errorf("edited custom read back as %+v", edited)
+	}
+
+	orig, _ := parseKKCustom(testKKCustom(t))
+	face, _ := marshalModel(&edited.Face)
+	origFace, _ := marshalModel(&orig.Face)
+	if !bytes.Equal(face, origFace) {
+		t.Error("face block changed by a body edit")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/sulfur/bbio"
+)
+
+// ReadLimits strcture
+//
+// Cards are parsed from untrusted input, so every length or count read from
+// a card is checked against these limits before anything is allocated.
+type ReadLimits struct {
+	MaxBlockSize  int64 // Largest single block (face image, header, data block)
+	MaxCharaCount int   // Characters accepted from one scene
+	MaxDepth      int   // Nesting depth of PlayHome scene objects
+}
+
+// DefaultReadLimits is large enough for any card the games produce.
+var DefaultReadLimits = ReadLimits{
+	MaxBlockSize:  64 << 20,
+	MaxCharaCount: 1024,
+	MaxDepth:      64,
+}
+
+var readLimits = DefaultReadLimits
+
+// SetReadLimits implements for ReadLimits
+func SetReadLimits(limits ReadLimits) {
+	readLimits = limits
+}
+
+// Read limit flags
+const (
+	flagMaxBlockSize = "--max-block-size"
+	flagMaxCharas    = "--max-charas"
+	flagMaxDepth     = "--max-depth"
+)
+
+// set changes the limit of a command line flag, block sizes are in MiB
+func (l *ReadLimits) set(flag string, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("%s expects a positive number, got '%s'", flag, value)
+	}
+
+	switch flag {
+	case flagMaxBlockSize:
+		l.MaxBlockSize = int64(n) << 20
+	case flagMaxCharas:
+		l.MaxCharaCount = n
+	case flagMaxDepth:
+		l.MaxDepth = n
+	default:
+		return fmt.Errorf("Unknown read limit %s", flag)
+	}
+	return nil
+}
+
+// checkBlockSize validates a length read from a card before it is used.
+func checkBlockSize(reader *bbio.Reader, size int64) error {
+	if size < 0 {
+		return fmt.Errorf("Invalid block size %d", size)
+	}
+	if size > readLimits.MaxBlockSize {
+		return fmt.Errorf("Block size %d exceeds limit %d", size, readLimits.MaxBlockSize)
+	}
+	if size > int64(reader.Len()) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// readBlock reads a length-prefixed block whose length was already read.
+func readBlock(reader *bbio.Reader, size int64) ([]byte, error) {
+	err := checkBlockSize(reader, size)
+	if err != nil {
+		return nil, err
+	}
+	return reader.ReadBytes(int(size))
+}
+
+// checkCharaCount reports an error once a scene holds too many characters.
+func checkCharaCount(count int) error {
+	if count >= readLimits.MaxCharaCount {
+		return fmt.Errorf("Scene has more than %d characters", readLimits.MaxCharaCount)
+	}
+	return nil
+}
+
+// parsePanics lets panics through recoverParse. The tests set it so a
+// parser panic fails them instead of becoming an error.
+var parsePanics = false
+
+// recoverParse is the last resort of the card readers. They check every
+// length and count themselves, so a panic here is a parser bug: it is
+// always reported, with the stack in debug builds, and the card is skipped
+// instead of crashing the program.
+func recoverParse(err *error) {
+	if parsePanics {
+		return
+	}
+
+	r := recover()
+	if r == nil {
+		return
+	}
+	if isDebug {
+		printError(fmt.Errorf("Card parse panic: %v\n%s", r, debug.Stack()))
+	} else {
+		printError(fmt.Errorf("Card parse panic, please report this card: %v", r))
+	}
+	*err = errors.New(fmt.Sprint("Card parse failed: ", r))
+}
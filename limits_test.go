@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sulfur/bbio"
+)
+
+// TestMain lets parser panics through recoverParse, a test that hits one
+// fails instead of passing on the recovered error
+func TestMain(m *testing.M) {
+	parsePanics = true
+	os.Exit(m.Run())
+}
+
+func TestReadLimitsSet(t *testing.T) {
+	tests := []struct {
+		flag  string
+		value string
+		want  ReadLimits
+		ok    bool
+	}{
+		{flagMaxBlockSize, "8", ReadLimits{MaxBlockSize: 8 << 20, MaxCharaCount: 1024, MaxDepth: 64}, true},
+		{flagMaxCharas, "2", ReadLimits{MaxBlockSize: 64 << 20, MaxCharaCount: 2, MaxDepth: 64}, true},
+		{flagMaxDepth, "3", ReadLimits{MaxBlockSize: 64 << 20, MaxCharaCount: 1024, MaxDepth: 3}, true},
+		{flagMaxDepth, "0", DefaultReadLimits, false},
+		{flagMaxCharas, "-1", DefaultReadLimits, false},
+		{flagMaxBlockSize, "big", DefaultReadLimits, false},
+		{"--max-other", "1", DefaultReadLimits, false},
+	}
+	for _, tt := range tests {
+		limits := DefaultReadLimits
+		err := limits.set(tt.flag, tt.value)
+		if (err == nil) != tt.ok || limits != tt.want {
+			t.Errorf("%s %s: %+v, %v", tt.flag, tt.value, limits, err)
+		}
+	}
+}
+
+// testLimits runs f with limits and puts the defaults back
+func testLimits(limits ReadLimits, f func()) {
+	defer SetReadLimits(DefaultReadLimits)
+	SetReadLimits(limits)
+	f()
+}
+
+func TestHSReadStringBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"string", []byte{3, 'a', 'b', 'c'}, true},
+		{"empty input", nil, false},
+		{"length cut", []byte{0x80}, false},
+		{"text cut", []byte{5, 'a', 'b'}, false},
+		{"huge length", []byte{0xff, 0xff, 0xff, 0xff, 0x07, 'a'}, false},
+		{"bad 7 bit int", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, false},
+	}
+	for _, tt := range tests {
+		str, n, err := readString(tt.data, 0)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: %q, %d, %v", tt.name, str, n, err)
+		}
+		if tt.ok && (str != "abc" || n != 4) {
+			t.Errorf("%s: %q, %d", tt.name, str, n)
+		}
+	}
+}
+
+func TestCheckBlockSize(t *testing.T) {
+	reader := bbio.NewReaderBytes(make([]byte, 16))
+	for _, size := range []int64{-1, 17, 1 << 40} {
+		if err := checkBlockSize(reader, size); err == nil {
+			t.Errorf("size %d accepted", size)
+		}
+	}
+	if err := checkBlockSize(reader, 16); err != nil {
+		t.Error(err)
+	}
+
+	testLimits(ReadLimits{MaxBlockSize: 8, MaxCharaCount: 1, MaxDepth: 1}, func() {
+		if err := checkBlockSize(reader, 9); err == nil || !strings.Contains(err.Error(), "limit") {
+			t.Errorf("block over the limit: %v", err)
+		}
+	})
+}
+
+// TestHostileLengths puts huge and negative values in every 4 bytes of the
+// written cards, the readers must fail or succeed without panicking
+func TestHostileLengths(t *testing.T) {
+	if testing.Short() {
+		t.Skip("reads every card a few thousand times")
+	}
+
+	readers := map[string]func(*bbio.Reader, int64) error{
+		gameKK: func(r *bbio.Reader, size int64) error {
+			_, err := NewKKChara().ReadCard(r, size)
+			return err
+		},
+		gameAIS: func(r *bbio.Reader, size int64) error {
+			_, err := NewAISChara().ReadCard(r, size)
+			return err
+		},
+		gameHS: func(r *bbio.Reader, size int64) error {
+			_, err := NewHSChara().ReadCard(r, size)
+			return err
+		},
+		gamePH: func(r *bbio.Reader, size int64) error {
+			_, err := NewPHChara().ReadCard(r, size)
+			return err
+		},
+	}
+
+	for game, card := range testWriteCards(t) {
+		pngSize := int(getPngSize(bbio.NewReaderBytes(card)))
+		b := make([]byte, len(card))
+		for off := pngSize; off+4 <= len(card); off++ {
+			for _, v := range []uint32{0x7fffffff, 0xffffffff} {
+				copy(b, card)
+				binary.LittleEndian.PutUint32(b[off:], v)
+				readers[game](bbio.NewReaderBytes(b), int64(pngSize))
+			}
+		}
+
+		// every truncation fails cleanly
+		for end := pngSize; end < len(card); end += 7 {
+			if readers[game](bbio.NewReaderBytes(card[:end]), int64(pngSize)) == nil {
+				t.Errorf("%s: card cut at %d of %d read", game, end, len(card))
+			}
+		}
+	}
+}
+
+func TestCharaCountLimit(t *testing.T) {
+	card := testWriteCards(t)[gameKK]
+	pngSize := getPngSize(bbio.NewReaderBytes(card))
+	scene := append(append([]byte{}, card...), card[pngSize:]...)
+
+	testLimits(ReadLimits{MaxBlockSize: 64 << 20, MaxCharaCount: 1, MaxDepth: 64}, func() {
+		if _, err := NewKKChara().ReadScene(bbio.NewReaderBytes(scene), pngSize); err == nil {
+			t.Error("two charas read with a limit of one")
+		}
+	})
+
+	h := NewKKChara()
+	if _, err := h.ReadScene(bbio.NewReaderBytes(scene), pngSize); err != nil || len(h.card.charaCards) != 2 {
+		t.Errorf("read %d charas: %v", len(h.card.charaCards), err)
+	}
+}
+
+// testPHFolders is depth nested empty PH folders
+func testPHFolders(depth int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < depth; i++ {
+		binary.Write(&b, binary.LittleEndian, int32(1)) // child count
+		binary.Write(&b, binary.LittleEndian, int32(3)) // folder
+		b.Write(make([]byte, 4))                        // dicKey
+		b.Write([]byte{0, 0, 0})                        // pos, rot, scale
+		b.Write(make([]byte, 5))                        // treeState, visible
+		b.WriteByte(0)                                  // name
+	}
+	binary.Write(&b, binary.LittleEndian, int32(0))
+	return b.Bytes()
+}
+
+func TestPHDepthLimit(t *testing.T) {
+	testLimits(ReadLimits{MaxBlockSize: 64 << 20, MaxCharaCount: 1024, MaxDepth: 4}, func() {
+		for depth, ok := range map[int]bool{0: true, 4: true, 5: false, 1000: false} {
+			err := readPHChild(bbio.NewReaderBytes(testPHFolders(depth)), 0, 0, map[int]PHCharaCard{})
+			if (err == nil) != ok {
+				t.Errorf("depth %d: %v", depth, err)
+			}
+		}
+	})
+}
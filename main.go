@@ -17,10 +17,20 @@ var Build = "gui"
 
 var isDebug = (Version == "development")
 
+// Commands, extract when none is given
+const (
+	cmdExtract = ""
+	cmdDump    = "dump"
+	cmdBuild   = "build"
+	cmdEdit    = "edit"
+	cmdThumb   = "thumbnail"
+	cmdCoord   = "coordinate"
+)
+
 func printHelp(exeName string) {
 
 	if Build == "full" {
-		fmt.Println("Extract charater card from Studio scene card.")
+		fmt.Println("Extract charater card from Studio scene card, or re-write a charater card.")
 
 		fmt.Println("Supported games:")
 		fmt.Println("\tAI Shoujo")
@@ -30,11 +40,16 @@ func printHelp(exeName string) {
 		fmt.Println("\tPlayHome")
 
 	} else {
-		fmt.Println("Extract charater card from Studio NEO / Studio NEO V2 scene card.")
+		fmt.Println("Extract charater card from Studio NEO / Studio NEO V2 scene card, or re-write a KK / AIS charater card.")
 	}
 
 	fmt.Println("\nUsage:")
 	fmt.Println("\t", exeName, "file [-options]")
+	fmt.Println("\t", exeName, "dump file [--json] [-options]")
+	fmt.Println("\t", exeName, "build file.json [-options]")
+	fmt.Println("\t", exeName, "edit file --set field=value [--set field=value ...]")
+	fmt.Println("\t", exeName, "coordinate file [-options]\t(KK, AIS and HS2 outfits as coordinate cards)")
+	fmt.Println("\t", exeName, "thumbnail file image [--verify]\t(chara card or scene card)")
 	fmt.Println("\t", exeName, "-h | --help")
 	fmt.Println("\t", exeName, "-v | --version")
 
@@ -43,21 +58,53 @@ func printHelp(exeName string) {
 	fmt.Println("\t-v --version\tShow version.")
 	fmt.Println("\t-m --male\tExtract male charater only.")
 	fmt.Println("\t-f --female\tExtract female charater only.")
+	fmt.Println("\t-g --game ID\tExtract charater of one game only (AIS, HS2, HS, KK, PH).")
+	fmt.Println("\t--raw\t\tCopy the original charater bytes, ignored by build.")
+	fmt.Println("\t--verify\tRe-read extracted cards and compare their blocks.")
+	fmt.Println("\t--hs-sig MODE\tHoney Select signature: regenerate (default) or preserve, which keeps the")
+	fmt.Println("\t\t\toriginal HMAC of a standalone card while its png is unchanged. Scene charas")
+	fmt.Println("\t\t\thave no card png and always get a new signature.")
+	fmt.Println("\t--ph-version V\tPlayHome card version: 10 (default), 0 to 9 or same. Older versions drop")
+	fmt.Println("\t\t\tthe colors and values they have no room for.")
+	fmt.Println("\t--thumb MODE\tThumbnail of written cards: solid, label (name, game, scene), template")
+	fmt.Println("\t\t\tface (KK face image, label for other games) or scene (scene screenshot).")
+	fmt.Println("\t--thumb-template F\tPNG or JPEG to draw the labels on, implies --thumb template.")
+	fmt.Println("\t--coord-ext\tcoordinate: copy the whole KKEx plugin block of AIS / HS2 charas, body")
+	fmt.Println("\t\t\tand face plugin data included. Without it only outfit and accessory plugins.")
+	fmt.Println("\t--meta\t\tAdd name, game, source file, hash and date as png text to written cards.")
+	fmt.Println("\t--max-block-size MB\tLargest block read from a card (default 64).")
+	fmt.Println("\t--max-charas N\tCharaters read from one scene (default 1024).")
+	fmt.Println("\t--max-depth N\tNesting depth of PlayHome scene objects (default 64).")
+	fmt.Println("\t--json\t\tdump: write every block to <file>.json instead of a summary.")
+	fmt.Println("\t--set F=V\tedit: change a field of a KK (firstname, lastname, nickname,")
+	fmt.Println("\t\t\tfullname \"last first\", personality) or AIS / HS2 (fullname, personality) card.")
 
 	fmt.Println("")
 }
 
-func parseArgs() (file string, flag int) {
+func parseArgs() (cmd string, file string, opts ExtractOptions) {
+	cmd = cmdExtract
 	file = ""
-	flag = 0
+	opts.limits = DefaultReadLimits
 
 	args := os.Args
 	exePath := args[0]
 	exeName := strings.TrimSuffix(filepath.Base(exePath), filepath.Ext(exePath))
 
 	aLen := len(args)
-	if aLen > 1 {
-		switch args[1] {
+	if aLen < 2 {
+		printHelp(exeName)
+		os.Exit(0)
+	}
+
+	start := 1
+	if args[1] == cmdDump || args[1] == cmdBuild || args[1] == cmdEdit || args[1] == cmdThumb || args[1] == cmdCoord {
+		cmd = args[1]
+		start++
+	}
+
+	for i := start; i < aLen; i++ {
+		switch args[i] {
 		case "-h", "--help":
 			printHelp(exeName)
 			os.Exit(0)
@@ -65,27 +112,101 @@ func parseArgs() (file string, flag int) {
 			fmt.Println(exeName, "version", Version)
 			os.Exit(0)
 		case "-m", "--male":
-			flag = 1
+			opts.flag = 1
 		case "-f", "--female":
-			flag = 2
-		default:
-			file = args[1]
-		}
+			opts.flag = 2
+		case "--raw":
+			opts.raw = true
+		case "--verify":
+			opts.verify = true
+		case "--json":
+			opts.json = true
+		case "--meta":
+			opts.meta = true
+		case "--coord-ext":
+			opts.coordExt = true
+		case "--thumb":
+			i++
+			if i >= aLen {
+				printError(errors.New("Missing mode for --thumb"))
+				os.Exit(1)
+			}
+			opts.thumbMode = args[i]
+		case "--thumb-template":
+			i++
+			if i >= aLen {
+				printError(errors.New("Missing file for --thumb-template"))
+				os.Exit(1)
+			}
+			opts.thumbTemplate = args[i]
+			if opts.thumbMode == "" {
+				opts.thumbMode = thumbTemplate
+			}
+		case "--set":
+			i++
+			if i >= aLen {
+				printError(errors.New("Missing field=value for --set"))
+				os.Exit(1)
+			}
 
-		if aLen > 2 {
-			switch args[2] {
-			case "-m", "--male":
-				flag = 1
-			case "-f", "--female":
-				flag = 2
-			default:
-				file = args[2]
+			edit, eErr := parseCharaEdit(args[i])
+			if eErr != nil {
+				printError(eErr)
+				os.Exit(1)
+			}
+			opts.edits = append(opts.edits, edit)
+		case "--hs-sig":
+			i++
+			if i >= aLen || (args[i] != hsSigRegenerate && args[i] != hsSigPreserve) {
+				printError(errors.New("--hs-sig expects " + hsSigRegenerate + " or " + hsSigPreserve))
+				os.Exit(1)
+			}
+			opts.hsSig = args[i]
+		case "--ph-version":
+			i++
+			if i >= aLen {
+				printError(errors.New("Missing version for --ph-version"))
+				os.Exit(1)
 			}
-		}
 
-	} else {
-		printHelp(exeName)
-		os.Exit(0)
+			_, pvErr := parsePHVersion(args[i])
+			if pvErr != nil {
+				printError(pvErr)
+				os.Exit(1)
+			}
+			opts.phVersion = args[i]
+		case flagMaxBlockSize, flagMaxCharas, flagMaxDepth:
+			i++
+			if i >= aLen {
+				printError(errors.New("Missing number for " + args[i-1]))
+				os.Exit(1)
+			}
+
+			lErr := opts.limits.set(args[i-1], args[i])
+			if lErr != nil {
+				printError(lErr)
+				os.Exit(1)
+			}
+		case "-g", "--game":
+			i++
+			if i >= aLen {
+				printError(errors.New("Missing game for " + args[i-1]))
+				os.Exit(1)
+			}
+
+			game, gErr := parseGameID(args[i])
+			if gErr != nil {
+				printError(gErr)
+				os.Exit(1)
+			}
+			opts.game = game
+		default:
+			if cmd == cmdThumb && file != "" {
+				opts.thumbImage = args[i]
+			} else {
+				file = args[i]
+			}
+		}
 	}
 	return
 }
@@ -114,14 +235,15 @@ func main() {
 		runGui(currDir)
 
 	} else {
-		var filePath string
-		var flag int
+		var cmd, filePath string
+		var opts ExtractOptions
 
 		if isDebug {
 			filePath = path.Join(currDir, "temp", "ph_665209fc29e5ffb.png")
 
 		} else {
-			filePath, flag = parseArgs()
+			cmd, filePath, opts = parseArgs()
+			SetReadLimits(opts.limits)
 		}
 
 		_, fErr := os.Stat(filePath)
@@ -130,17 +252,70 @@ func main() {
 			return
 		}
 
-		total, write, err := extractScene(currDir, filePath, flag, Build == "full")
+		if cmd == cmdEdit {
+			err = editCard(filePath, opts)
+			if err != nil {
+				printError(err)
+				return
+			}
+			fmt.Println("\033[30;102m SUCCESS \033[0m", "Edit success.")
+			return
+		}
+
+		if cmd == cmdThumb {
+			err = thumbnailCard(filePath, opts)
+			if err != nil {
+				printError(err)
+				return
+			}
+			fmt.Println("\033[30;102m SUCCESS \033[0m", "Thumbnail replaced.")
+			return
+		}
+
+		if cmd == cmdDump {
+			count, err := dumpScene(currDir, filePath, opts, Build == "full")
+			if err != nil {
+				printError(err)
+				return
+			}
+			if count == 0 {
+				fmt.Println("\t", "No charater found in card.")
+			}
+			return
+		}
+
+		if cmd == cmdCoord {
+			report, err := extractCoordinates(currDir, filePath, opts, Build == "full")
+			if err != nil {
+				printError(err)
+				return
+			}
+			fmt.Println("\033[30;102m SUCCESS \033[0m", "Export success.")
+			if report.Total() == 0 {
+				fmt.Println("\t", "No coordinate found in card.")
+			} else {
+				fmt.Println("\t", report.Total(), "coordinate(s) found and", report.Write(), "coordinate card(s) written.")
+			}
+			return
+		}
+
+		var report ExtractReport
+		if cmd == cmdBuild {
+			report, err = buildScene(currDir, filePath, opts)
+		} else {
+			report, err = extractScene(currDir, filePath, opts, Build == "full")
+		}
 		if err != nil {
 			printError(err)
 			return
 		}
 
 		fmt.Println("\033[30;102m SUCCESS \033[0m", "Extract success.")
-		if total == 0 {
-			fmt.Println("\t", "No charater found in scene card.")
+		if report.Total() == 0 {
+			fmt.Println("\t", "No charater found in card.")
 		} else {
-			fmt.Println("\t", total, "charater(s) found and", write, "charater(s) extracted.")
+			fmt.Println("\t", report.Total(), "charater(s) found and", report.Write(), "charater(s) extracted.")
+			report.print()
 		}
 	}
 }
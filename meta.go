@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// CardMeta strcture, provenance of the cards written from one file
+type CardMeta struct {
+	source string
+	// sha256 of the source file
+	hash string
+	date string
+}
+
+func newCardMeta(filePath string) (meta *CardMeta, err error) {
+	b, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	sum := sha256.Sum256(b)
+	meta = &CardMeta{
+		source: filepath.Base(filePath),
+		hash:   hex.EncodeToString(sum[:]),
+		date:   time.Now().Format(time.RFC1123Z),
+	}
+	return
+}
+
+// texts are the png text chunks of one chara, Title and Creation Time are
+// png keywords file browsers know
+func (m *CardMeta) texts(info ThumbInfo) []PngText {
+	texts := []PngText{
+		{keyword: "Title", text: info.name},
+		{keyword: "Game", text: gameNames[info.game]},
+		{keyword: "Source", text: m.source},
+		{keyword: "Source SHA256", text: m.hash},
+		{keyword: "Creation Time", text: m.date},
+		{keyword: "Software", text: "studioextract " + Version},
+	}
+	if info.name == "" {
+		texts = texts[1:]
+	}
+	return texts
+}
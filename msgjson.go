@@ -0,0 +1,983 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vmihailenco/msgpack/v5/codes"
+)
+
+// JSON form of msgpack values:
+//
+//	nil, bool, int, string   plain JSON
+//	float32                  number, always with a '.' or exponent
+//	float64                  {"$f64": number}
+//	bin                      {"$bin": base64} or {"$bin": layout} when it holds msgpack
+//	map                      object, or {"$map": [[key, value], ...]} for other keys
+//	ext                      {"$ext": type, "data": base64}
+//	invalid utf-8 string     {"$str": base64}
+//	NaN / Inf                {"$f32": "NaN"}, {"$f64": "+Inf"}
+//
+// A value written with a wider header than needed is wrapped as
+// {"$code": code, "$value": value}, so the JSON maps back to the same bytes.
+
+// Layouts of a block or bin
+const (
+	layoutMsgpack = "msgpack"
+	layoutSized   = "sized"
+	layoutBinary  = "binary"
+)
+
+const msgJSONMaxDepth = 64
+
+// msgLayout strcture, how the bytes of one block or bin are laid out
+type msgLayout struct {
+	Layout string          `json:"layout"`
+	Data   json.RawMessage `json:"data"`
+	Tail   string          `json:"tail,omitempty"`
+}
+
+// msgJSON strcture, converts msgpack bytes to ordered JSON
+type msgJSON struct {
+	data []byte
+	off  int
+}
+
+func msgUintCode(v uint64) byte {
+	switch {
+	case v <= uint64(codes.PosFixedNumHigh):
+		return byte(v)
+	case v <= math.MaxUint8:
+		return byte(codes.Uint8)
+	case v <= math.MaxUint16:
+		return byte(codes.Uint16)
+	case v <= math.MaxUint32:
+		return byte(codes.Uint32)
+	}
+	return byte(codes.Uint64)
+}
+
+func msgIntCode(v int64) byte {
+	switch {
+	case v >= 0:
+		return msgUintCode(uint64(v))
+	case v >= -32:
+		return byte(int8(v))
+	case v >= math.MinInt8:
+		return byte(codes.Int8)
+	case v >= math.MinInt16:
+		return byte(codes.Int16)
+	case v >= math.MinInt32:
+		return byte(codes.Int32)
+	}
+	return byte(codes.Int64)
+}
+
+func msgLenCode(n int, fix codes.Code, fixMax int, c8 codes.Code, c16 codes.Code, c32 codes.Code) byte {
+	switch {
+	case n <= fixMax:
+		return byte(fix) | byte(n)
+	case n <= math.MaxUint8 && c8 != 0:
+		return byte(c8)
+	case n <= math.MaxUint16:
+		return byte(c16)
+	}
+	return byte(c32)
+}
+
+func msgStrCode(n int) byte {
+	return msgLenCode(n, codes.FixedStrLow, int(codes.FixedStrMask), codes.Str8, codes.Str16, codes.Str32)
+}
+
+func msgBinCode(n int) byte {
+	return msgLenCode(n, 0, -1, codes.Bin8, codes.Bin16, codes.Bin32)
+}
+
+func msgArrayCode(n int) byte {
+	return msgLenCode(n, codes.FixedArrayLow, int(codes.FixedArrayMask), 0, codes.Array16, codes.Array32)
+}
+
+func msgMapCode(n int) byte {
+	return msgLenCode(n, codes.FixedMapLow, int(codes.FixedMapMask), 0, codes.Map16, codes.Map32)
+}
+
+func msgExtCode(n int) byte {
+	switch n {
+	case 1:
+		return byte(codes.FixExt1)
+	case 2:
+		return byte(codes.FixExt2)
+	case 4:
+		return byte(codes.FixExt4)
+	case 8:
+		return byte(codes.FixExt8)
+	case 16:
+		return byte(codes.FixExt16)
+	}
+	return msgLenCode(n, 0, -1, codes.Ext8, codes.Ext16, codes.Ext32)
+}
+
+func (m *msgJSON) read(n int) ([]byte, error) {
+	if n < 0 || n > len(m.data)-m.off {
+		return nil, errors.New("msgpack: unexpected end of data")
+	}
+	b := m.data[m.off : m.off+n]
+	m.off += n
+	return b, nil
+}
+
+func (m *msgJSON) uint(size int) (uint64, error) {
+	b, err := m.read(size)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (m *msgJSON) length(size int) (int, error) {
+	v, err := m.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(len(m.data)) {
+		return 0, fmt.Errorf("msgpack: length %d out of range", v)
+	}
+	return int(v), nil
+}
+
+func writeJSONString(w *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	w.Write(b)
+}
+
+func writeJSONFloat(w *bytes.Buffer, f float64, bits int, tag string) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		fmt.Fprintf(w, `{"%s":"%s"}`, tag, strconv.FormatFloat(f, 'g', -1, bits))
+		return
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !bytes.ContainsAny([]byte(s), ".eE") {
+		s += ".0"
+	}
+	if bits == 64 {
+		fmt.Fprintf(w, `{"%s":%s}`, tag, s)
+		return
+	}
+	w.WriteString(s)
+}
+
+func (m *msgJSON) value(w *bytes.Buffer, depth int) (err error) {
+	if depth > msgJSONMaxDepth {
+		err = errors.New("msgpack: nesting too deep")
+		return
+	}
+
+	hb, hErr := m.read(1)
+	if hErr != nil {
+		err = hErr
+		return
+	}
+	c := codes.Code(hb[0])
+
+	var canon byte
+	var n int
+	var body func(w *bytes.Buffer) error
+
+	switch {
+	case codes.IsFixedNum(c):
+		canon = byte(c)
+		body = func(w *bytes.Buffer) error {
+			w.WriteString(strconv.Itoa(int(int8(c))))
+			return nil
+		}
+	case c == codes.Nil, c == codes.False, c == codes.True:
+		canon = byte(c)
+		body = func(w *bytes.Buffer) error {
+			w.WriteString(map[codes.Code]string{codes.Nil: "null", codes.False: "false", codes.True: "true"}[c])
+			return nil
+		}
+	case c >= codes.Uint8 && c <= codes.Uint64:
+		v, vErr := m.uint(1 << uint(c-codes.Uint8))
+		if vErr != nil {
+			err = vErr
+			return
+		}
+		canon = msgUintCode(v)
+		body = func(w *bytes.Buffer) error {
+			w.WriteString(strconv.FormatUint(v, 10))
+			return nil
+		}
+	case c >= codes.Int8 && c <= codes.Int64:
+		size := 1 << uint(c-codes.Int8)
+		u, vErr := m.uint(size)
+		if vErr != nil {
+			err = vErr
+			return
+		}
+		v := int64(u<<uint(64-size*8)) >> uint(64-size*8)
+		canon = msgIntCode(v)
+		body = func(w *bytes.Buffer) error {
+			w.WriteString(strconv.FormatInt(v, 10))
+			return nil
+		}
+	case c == codes.Float:
+		u, vErr := m.uint(4)
+		if vErr != nil {
+			err = vErr
+			return
+		}
+		canon = byte(c)
+		body = func(w *bytes.Buffer) error {
+			writeJSONFloat(w, float64(math.Float32frombits(uint32(u))), 32, "$f32")
+			return nil
+		}
+	case c == codes.Double:
+		u, vErr := m.uint(8)
+		if vErr != nil {
+			err = vErr
+			return
+		}
+		canon = byte(c)
+		body = func(w *bytes.Buffer) error {
+			writeJSONFloat(w, math.Float64frombits(u), 64, "$f64")
+			return nil
+		}
+	case codes.IsString(c):
+		if codes.IsFixedString(c) {
+			n = int(c & codes.FixedStrMask)
+		} else {
+			n, err = m.length(1 << uint(c-codes.Str8))
+			if err != nil {
+				return
+			}
+		}
+		s, sErr := m.read(n)
+		if sErr != nil {
+			err = sErr
+			return
+		}
+		canon = msgStrCode(n)
+		body = func(w *bytes.Buffer) error {
+			if utf8.Valid(s) {
+				writeJSONString(w, string(s))
+			} else {
+				w.WriteString(`{"$str":`)
+				writeJSONString(w, base64.StdEncoding.EncodeToString(s))
+				w.WriteByte('}')
+			}
+			return nil
+		}
+	case codes.IsBin(c):
+		n, err = m.length(1 << uint(c-codes.Bin8))
+		if err != nil {
+			return
+		}
+		b, bErr := m.read(n)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+		canon = msgBinCode(n)
+		body = func(w *bytes.Buffer) error {
+			w.WriteString(`{"$bin":`)
+			layout, ok := decodeLayout(b, true, depth+1)
+			if ok {
+				lb, lErr := json.Marshal(layout)
+				if lErr != nil {
+					return lErr
+				}
+				w.Write(lb)
+			} else {
+				writeJSONString(w, base64.StdEncoding.EncodeToString(b))
+			}
+			w.WriteByte('}')
+			return nil
+		}
+	case codes.IsFixedArray(c), c == codes.Array16, c == codes.Array32:
+		if codes.IsFixedArray(c) {
+			n = int(c & codes.FixedArrayMask)
+		} else {
+			n, err = m.length(2 << uint(c-codes.Array16))
+			if err != nil {
+				return
+			}
+		}
+		canon = msgArrayCode(n)
+		body = func(w *bytes.Buffer) error {
+			w.WriteByte('[')
+			for i := 0; i < n; i++ {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				vErr := m.value(w, depth+1)
+				if vErr != nil {
+					return vErr
+				}
+			}
+			w.WriteByte(']')
+			return nil
+		}
+	case codes.IsFixedMap(c), c == codes.Map16, c == codes.Map32:
+		if codes.IsFixedMap(c) {
+			n = int(c & codes.FixedMapMask)
+		} else {
+			n, err = m.length(2 << uint(c-codes.Map16))
+			if err != nil {
+				return
+			}
+		}
+		canon = msgMapCode(n)
+		body = func(w *bytes.Buffer) error {
+			return m.mapBody(w, n, depth)
+		}
+	case codes.IsExt(c):
+		if codes.IsFixedExt(c) {
+			n = 1 << uint(c-codes.FixExt1)
+		} else {
+			n, err = m.length(1 << uint(c-codes.Ext8))
+			if err != nil {
+				return
+			}
+		}
+		t, tErr := m.read(1)
+		if tErr != nil {
+			err = tErr
+			return
+		}
+		b, bErr := m.read(n)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+		canon = msgExtCode(n)
+		body = func(w *bytes.Buffer) error {
+			fmt.Fprintf(w, `{"$ext":%d,"data":`, int8(t[0]))
+			writeJSONString(w, base64.StdEncoding.EncodeToString(b))
+			w.WriteByte('}')
+			return nil
+		}
+	default:
+		err = fmt.Errorf("msgpack: invalid code %x", byte(c))
+		return
+	}
+
+	if canon != byte(c) {
+		fmt.Fprintf(w, `{"$code":%d,"$value":`, byte(c))
+		err = body(w)
+		w.WriteByte('}')
+		return
+	}
+	err = body(w)
+	return
+}
+
+func (m *msgJSON) mapBody(w *bytes.Buffer, n int, depth int) (err error) {
+	keys := make([][]byte, n)
+	values := make([][]byte, n)
+	seen := make(map[string]bool)
+	plain := true
+
+	for i := 0; i < n; i++ {
+		var kb, vb bytes.Buffer
+		err = m.value(&kb, depth+1)
+		if err != nil {
+			return
+		}
+		err = m.value(&vb, depth+1)
+		if err != nil {
+			return
+		}
+		keys[i] = kb.Bytes()
+		values[i] = vb.Bytes()
+
+		k := string(keys[i])
+		if !bytes.HasPrefix(keys[i], []byte(`"`)) || bytes.HasPrefix(keys[i], []byte(`"$`)) || seen[k] {
+			plain = false
+		}
+		seen[k] = true
+	}
+
+	if plain {
+		w.WriteByte('{')
+		for i := range keys {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.Write(keys[i])
+			w.WriteByte(':')
+			w.Write(values[i])
+		}
+		w.WriteByte('}')
+		return
+	}
+
+	w.WriteString(`{"$map":[`)
+	for i := range keys {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteByte('[')
+		w.Write(keys[i])
+		w.WriteByte(',')
+		w.Write(values[i])
+		w.WriteByte(']')
+	}
+	w.WriteString(`]}`)
+	return
+}
+
+func isMsgContainer(c byte) bool {
+	code := codes.Code(c)
+	return codes.IsFixedMap(code) || code == codes.Map16 || code == codes.Map32 ||
+		codes.IsFixedArray(code) || code == codes.Array16 || code == codes.Array32
+}
+
+// msgpackToJSON converts exactly one msgpack value
+func msgpackToJSON(data []byte, depth int) (out json.RawMessage, err error) {
+	m := &msgJSON{data: data}
+	var w bytes.Buffer
+	err = m.value(&w, depth)
+	if err != nil {
+		return
+	}
+	if m.off != len(data) {
+		err = fmt.Errorf("msgpack: %d bytes after value", len(data)-m.off)
+		return
+	}
+	out = w.Bytes()
+	return
+}
+
+// decodeLayout finds how data is laid out. Nested data from a bin only counts
+// as msgpack when it holds maps or arrays, so short binary stays base64
+func decodeLayout(data []byte, nested bool, depth int) (layout msgLayout, ok bool) {
+	if len(data) > 0 && (!nested || isMsgContainer(data[0])) {
+		v, vErr := msgpackToJSON(data, depth)
+		if vErr == nil {
+			layout = msgLayout{Layout: layoutMsgpack, Data: v}
+			ok = true
+			return
+		}
+	}
+
+	var off int
+	var lst []json.RawMessage
+	for len(data)-off >= 4 {
+		size := int(int32(binary.LittleEndian.Uint32(data[off:])))
+		if size <= 0 || size > len(data)-off-4 || !isMsgContainer(data[off+4]) {
+			break
+		}
+		v, vErr := msgpackToJSON(data[off+4:off+4+size], depth)
+		if vErr != nil {
+			break
+		}
+		lst = append(lst, v)
+		off += 4 + size
+	}
+	if len(lst) > 0 {
+		lb, _ := json.Marshal(lst)
+		layout = msgLayout{Layout: layoutSized, Data: lb, Tail: base64.StdEncoding.EncodeToString(data[off:])}
+		ok = true
+		return
+	}
+
+	db, _ := json.Marshal(base64.StdEncoding.EncodeToString(data))
+	layout = msgLayout{Layout: layoutBinary, Data: db}
+	return
+}
+
+// jsonNode strcture, a JSON value that keeps the order of object keys
+type jsonNode struct {
+	// 'o' object, 'a' array, 'v' scalar
+	kind   byte
+	keys   []string
+	values []*jsonNode
+	scalar interface{}
+}
+
+func (n *jsonNode) get(key string) *jsonNode {
+	for i, k := range n.keys {
+		if k == key {
+			return n.values[i]
+		}
+	}
+	return nil
+}
+
+func (n *jsonNode) str() (string, error) {
+	s, ok := n.scalar.(string)
+	if n.kind != 'v' || !ok {
+		return "", errors.New("json: string expected")
+	}
+	return s, nil
+}
+
+func (n *jsonNode) number() (json.Number, error) {
+	num, ok := n.scalar.(json.Number)
+	if n.kind != 'v' || !ok {
+		return "", errors.New("json: number expected")
+	}
+	return num, nil
+}
+
+func readJSONNode(dec *json.Decoder) (node *jsonNode, err error) {
+	t, tErr := dec.Token()
+	if tErr != nil {
+		err = tErr
+		return
+	}
+
+	node = &jsonNode{kind: 'v', scalar: t}
+	switch t {
+	case json.Delim('{'):
+		node.kind = 'o'
+		for dec.More() {
+			kt, kErr := dec.Token()
+			if kErr != nil {
+				err = kErr
+				return
+			}
+			v, vErr := readJSONNode(dec)
+			if vErr != nil {
+				err = vErr
+				return
+			}
+			node.keys = append(node.keys, kt.(string))
+			node.values = append(node.values, v)
+		}
+		_, err = dec.Token()
+	case json.Delim('['):
+		node.kind = 'a'
+		for dec.More() {
+			v, vErr := readJSONNode(dec)
+			if vErr != nil {
+				err = vErr
+				return
+			}
+			node.values = append(node.values, v)
+		}
+		_, err = dec.Token()
+	}
+	return
+}
+
+func parseJSONNode(data []byte) (*jsonNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return readJSONNode(dec)
+}
+
+// writeMsgHeader writes code and n in the width the code asks for
+func writeMsgHeader(w *bytes.Buffer, code byte, n uint64) {
+	var width uint
+	switch codes.Code(code) {
+	case codes.Uint8, codes.Int8, codes.Bin8, codes.Str8, codes.Ext8:
+		width = 1
+	case codes.Uint16, codes.Int16, codes.Bin16, codes.Str16, codes.Array16, codes.Map16, codes.Ext16:
+		width = 2
+	case codes.Uint32, codes.Int32, codes.Bin32, codes.Str32, codes.Array32, codes.Map32, codes.Ext32, codes.Float:
+		width = 4
+	case codes.Uint64, codes.Int64, codes.Double:
+		width = 8
+	}
+
+	w.WriteByte(code)
+	for i := width; i > 0; i-- {
+		w.WriteByte(byte(n >> (8 * (i - 1))))
+	}
+}
+
+// msgCode returns the code a value is written with, code is -1 for canon
+func msgCode(canon byte, code int) byte {
+	if code < 0 {
+		return canon
+	}
+	return byte(code)
+}
+
+func checkMsgWidth(code byte, n uint64, signed bool) error {
+	var bits uint
+	switch codes.Code(code) {
+	case codes.Uint8, codes.Int8, codes.Bin8, codes.Str8, codes.Ext8:
+		bits = 8
+	case codes.Uint16, codes.Int16, codes.Bin16, codes.Str16, codes.Array16, codes.Map16, codes.Ext16:
+		bits = 16
+	case codes.Uint32, codes.Int32, codes.Bin32, codes.Str32, codes.Array32, codes.Map32, codes.Ext32:
+		bits = 32
+	default:
+		return nil
+	}
+	if signed {
+		v := int64(n)
+		if v < -(1<<(bits-1)) || v >= 1<<(bits-1) {
+			return fmt.Errorf("msgpack: %d does not fit code %x", v, code)
+		}
+		return nil
+	}
+	if n >= 1<<bits {
+		return fmt.Errorf("msgpack: %d does not fit code %x", n, code)
+	}
+	return nil
+}
+
+func (n *jsonNode) writeNumber(w *bytes.Buffer, num json.Number, code int) error {
+	s := num.String()
+	if strings.ContainsAny(s, ".eE") {
+		f, fErr := strconv.ParseFloat(s, 32)
+		if fErr != nil {
+			return fErr
+		}
+		writeMsgHeader(w, byte(codes.Float), uint64(math.Float32bits(float32(f))))
+		return nil
+	}
+
+	if strings.HasPrefix(s, "-") {
+		v, vErr := strconv.ParseInt(s, 10, 64)
+		if vErr != nil {
+			return vErr
+		}
+		c := msgCode(msgIntCode(v), code)
+		if isMsgFixNum(c) {
+			w.WriteByte(c)
+			return nil
+		}
+		wErr := checkMsgWidth(c, uint64(v), c >= byte(codes.Int8))
+		if wErr != nil {
+			return wErr
+		}
+		writeMsgHeader(w, c, uint64(v))
+		return nil
+	}
+
+	v, vErr := strconv.ParseUint(s, 10, 64)
+	if vErr != nil {
+		return vErr
+	}
+	c := msgCode(msgUintCode(v), code)
+	if isMsgFixNum(c) {
+		w.WriteByte(c)
+		return nil
+	}
+	wErr := checkMsgWidth(c, v, c >= byte(codes.Int8))
+	if wErr != nil {
+		return wErr
+	}
+	writeMsgHeader(w, c, v)
+	return nil
+}
+
+func isMsgFixNum(c byte) bool {
+	return codes.IsFixedNum(codes.Code(c))
+}
+
+func writeMsgFloat(w *bytes.Buffer, node *jsonNode, bits int) error {
+	var f float64
+	switch v := node.scalar.(type) {
+	case json.Number:
+		pf, pErr := strconv.ParseFloat(v.String(), bits)
+		if pErr != nil {
+			return pErr
+		}
+		f = pf
+	case string:
+		pf, pErr := strconv.ParseFloat(v, bits)
+		if pErr != nil {
+			return pErr
+		}
+		f = pf
+	default:
+		return errors.New("json: float expected")
+	}
+
+	if bits == 32 {
+		writeMsgHeader(w, byte(codes.Float), uint64(math.Float32bits(float32(f))))
+		return nil
+	}
+	writeMsgHeader(w, byte(codes.Double), math.Float64bits(f))
+	return nil
+}
+
+func writeMsgBytes(w *bytes.Buffer, b []byte, canon byte, code int) error {
+	c := msgCode(canon, code)
+	if codes.IsFixedString(codes.Code(c)) {
+		w.WriteByte(c)
+	} else {
+		wErr := checkMsgWidth(c, uint64(len(b)), false)
+		if wErr != nil {
+			return wErr
+		}
+		writeMsgHeader(w, c, uint64(len(b)))
+	}
+	w.Write(b)
+	return nil
+}
+
+func writeMsgLen(w *bytes.Buffer, n int, canon byte, code int) error {
+	c := msgCode(canon, code)
+	if codes.IsFixedArray(codes.Code(c)) || codes.IsFixedMap(codes.Code(c)) {
+		w.WriteByte(c)
+		return nil
+	}
+	wErr := checkMsgWidth(c, uint64(n), false)
+	if wErr != nil {
+		return wErr
+	}
+	writeMsgHeader(w, c, uint64(n))
+	return nil
+}
+
+// writeMsgpack writes node as msgpack, code is -1 for the shortest header
+func (n *jsonNode) writeMsgpack(w *bytes.Buffer, code int, depth int) (err error) {
+	if depth > msgJSONMaxDepth {
+		err = errors.New("json: nesting too deep")
+		return
+	}
+
+	switch n.kind {
+	case 'a':
+		err = writeMsgLen(w, len(n.values), msgArrayCode(len(n.values)), code)
+		if err != nil {
+			return
+		}
+		for _, v := range n.values {
+			err = v.writeMsgpack(w, -1, depth+1)
+			if err != nil {
+				return
+			}
+		}
+		return
+	case 'o':
+		if len(n.keys) > 0 && strings.HasPrefix(n.keys[0], "$") {
+			err = n.writeTagged(w, code, depth)
+			return
+		}
+
+		err = writeMsgLen(w, len(n.keys), msgMapCode(len(n.keys)), code)
+		if err != nil {
+			return
+		}
+		for i, k := range n.keys {
+			err = writeMsgBytes(w, []byte(k), msgStrCode(len(k)), -1)
+			if err != nil {
+				return
+			}
+			err = n.values[i].writeMsgpack(w, -1, depth+1)
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	switch v := n.scalar.(type) {
+	case nil:
+		w.WriteByte(byte(codes.Nil))
+	case bool:
+		if v {
+			w.WriteByte(byte(codes.True))
+		} else {
+			w.WriteByte(byte(codes.False))
+		}
+	case string:
+		err = writeMsgBytes(w, []byte(v), msgStrCode(len(v)), code)
+	case json.Number:
+		err = n.writeNumber(w, v, code)
+	default:
+		err = fmt.Errorf("json: unexpected %v", v)
+	}
+	return
+}
+
+func (n *jsonNode) writeTagged(w *bytes.Buffer, code int, depth int) (err error) {
+	switch {
+	case n.get("$code") != nil:
+		num, nErr := n.get("$code").number()
+		if nErr != nil {
+			err = nErr
+			return
+		}
+		c, cErr := num.Int64()
+		if cErr != nil || c < 0 || c > 0xff {
+			err = fmt.Errorf("json: invalid $code %s", num)
+			return
+		}
+		value := n.get("$value")
+		if value == nil {
+			err = errors.New("json: $code without $value")
+			return
+		}
+		err = value.writeMsgpack(w, int(c), depth+1)
+	case n.get("$f32") != nil:
+		err = writeMsgFloat(w, n.get("$f32"), 32)
+	case n.get("$f64") != nil:
+		err = writeMsgFloat(w, n.get("$f64"), 64)
+	case n.get("$str") != nil:
+		s, sErr := n.get("$str").str()
+		if sErr != nil {
+			err = sErr
+			return
+		}
+		b, bErr := base64.StdEncoding.DecodeString(s)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+		err = writeMsgBytes(w, b, msgStrCode(len(b)), code)
+	case n.get("$bin") != nil:
+		var b []byte
+		bin := n.get("$bin")
+		if bin.kind == 'o' {
+			b, err = encodeLayoutNode(bin, depth+1)
+		} else {
+			var s string
+			s, err = bin.str()
+			if err == nil {
+				b, err = base64.StdEncoding.DecodeString(s)
+			}
+		}
+		if err != nil {
+			return
+		}
+		err = writeMsgBytes(w, b, msgBinCode(len(b)), code)
+	case n.get("$map") != nil:
+		pairs := n.get("$map")
+		if pairs.kind != 'a' {
+			err = errors.New("json: $map expects an array")
+			return
+		}
+		err = writeMsgLen(w, len(pairs.values), msgMapCode(len(pairs.values)), code)
+		if err != nil {
+			return
+		}
+		for _, p := range pairs.values {
+			if p.kind != 'a' || len(p.values) != 2 {
+				err = errors.New("json: $map expects [key, value] pairs")
+				return
+			}
+			for _, v := range p.values {
+				err = v.writeMsgpack(w, -1, depth+1)
+				if err != nil {
+					return
+				}
+			}
+		}
+	case n.get("$ext") != nil:
+		num, nErr := n.get("$ext").number()
+		if nErr != nil {
+			err = nErr
+			return
+		}
+		t, tErr := num.Int64()
+		if tErr != nil || t < math.MinInt8 || t > math.MaxInt8 {
+			err = fmt.Errorf("json: invalid $ext %s", num)
+			return
+		}
+		data := n.get("data")
+		if data == nil {
+			err = errors.New("json: $ext without data")
+			return
+		}
+		s, sErr := data.str()
+		if sErr != nil {
+			err = sErr
+			return
+		}
+		b, bErr := base64.StdEncoding.DecodeString(s)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+		c := msgCode(msgExtCode(len(b)), code)
+		if codes.IsFixedExt(codes.Code(c)) {
+			w.WriteByte(c)
+		} else {
+			writeMsgHeader(w, c, uint64(len(b)))
+		}
+		w.WriteByte(byte(int8(t)))
+		w.Write(b)
+	default:
+		err = fmt.Errorf("json: unknown tag %s", n.keys[0])
+	}
+	return
+}
+
+func encodeLayout(layout string, data *jsonNode, tail string, depth int) (out []byte, err error) {
+	var w bytes.Buffer
+	switch layout {
+	case layoutMsgpack:
+		err = data.writeMsgpack(&w, -1, depth)
+	case layoutSized:
+		if data.kind != 'a' {
+			err = errors.New("json: sized layout expects an array")
+			return
+		}
+		for _, v := range data.values {
+			var block bytes.Buffer
+			err = v.writeMsgpack(&block, -1, depth)
+			if err != nil {
+				return
+			}
+			writeSizedBlock(&w, block.Bytes())
+		}
+		tb, tErr := base64.StdEncoding.DecodeString(tail)
+		if tErr != nil {
+			err = tErr
+			return
+		}
+		w.Write(tb)
+	case layoutBinary:
+		s, sErr := data.str()
+		if sErr != nil {
+			err = sErr
+			return
+		}
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		err = fmt.Errorf("json: unknown layout '%s'", layout)
+	}
+	out = w.Bytes()
+	return
+}
+
+func encodeLayoutNode(node *jsonNode, depth int) (out []byte, err error) {
+	ln, data := node.get("layout"), node.get("data")
+	if ln == nil || data == nil {
+		err = errors.New("json: layout and data expected")
+		return
+	}
+	layout, lErr := ln.str()
+	if lErr != nil {
+		err = lErr
+		return
+	}
+
+	var tail string
+	if tn := node.get("tail"); tn != nil {
+		tail, err = tn.str()
+		if err != nil {
+			return
+		}
+	}
+	return encodeLayout(layout, data, tail, depth)
+}
+
+// bytes converts a dumped layout back to the block bytes
+func (l *msgLayout) bytes() ([]byte, error) {
+	data, dErr := parseJSONNode(l.Data)
+	if dErr != nil {
+		return nil, dErr
+	}
+	return encodeLayout(l.Layout, data, l.Tail, 0)
+}
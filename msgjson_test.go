@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMsgJSONTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"nil", []byte{0xc0}, `null`},
+		{"bool", []byte{0xc3}, `true`},
+		{"fixint", []byte{0x05}, `5`},
+		{"negative fixint", []byte{0xff}, `-1`},
+		{"uint8", []byte{0xcc, 0xc8}, `200`},
+		{"uint16", []byte{0xcd, 0x01, 0x00}, `256`},
+		{"uint32", []byte{0xce, 0x00, 0x01, 0x00, 0x00}, `65536`},
+		{"uint64", []byte{0xcf, 0, 0, 0, 1, 0, 0, 0, 0}, `4294967296`},
+		{"int8", []byte{0xd0, 0x80}, `-128`},
+		{"int16", []byte{0xd1, 0xff, 0x00}, `-256`},
+		{"int32", []byte{0xd2, 0xff, 0xff, 0x00, 0x00}, `-65536`},
+		{"int64", []byte{0xd3, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}, `-4294967296`},
+		{"uint16 holding a fixint", []byte{0xcd, 0x00, 0x05}, `{"$code":205,"$value":5}`},
+		{"int32 holding an int8", []byte{0xd2, 0xff, 0xff, 0xff, 0x80}, `{"$code":210,"$value":-128}`},
+		{"float32", []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, `1.5`},
+		{"float32 integral", []byte{0xca, 0x40, 0x00, 0x00, 0x00}, `2.0`},
+		{"float32 NaN", []byte{0xca, 0x7f, 0xc0, 0x00, 0x00}, `{"$f32":"NaN"}`},
+		{"float64", []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, `{"$f64":1.5}`},
+		{"float64 Inf", []byte{0xcb, 0x7f, 0xf0, 0, 0, 0, 0, 0, 0}, `{"$f64":"+Inf"}`},
+		{"str", []byte{0xa2, 'h', 'i'}, `"hi"`},
+		{"str8", []byte{0xd9, 0x02, 'h', 'i'}, `{"$code":217,"$value":"hi"}`},
+		{"invalid utf-8 str", []byte{0xa1, 0xff}, `{"$str":"/w=="}`},
+		{"bin", []byte{0xc4, 0x02, 0x01, 0x02}, `{"$bin":"AQI="}`},
+		{"bin holding a string", []byte{0xc4, 0x02, 0xa1, 'a'}, `{"$bin":"oWE="}`},
+		{"bin holding a map", []byte{0xc4, 0x04, 0x81, 0xa1, 'a', 0x01}, `{"$bin":{"layout":"msgpack","data":{"a":1}}}`},
+		{"fixext", []byte{0xd4, 0x05, 0x07}, `{"$ext":5,"data":"Bw=="}`},
+		{"ext8", []byte{0xc7, 0x03, 0xfe, 0x01, 0x02, 0x03}, `{"$ext":-2,"data":"AQID"}`},
+		{"array", []byte{0x92, 0x01, 0xc0}, `[1,null]`},
+		{"map", []byte{0x82, 0xa1, 'b', 0xc3, 0xa1, 'a', 0xc2}, `{"b":true,"a":false}`},
+		{"map with an int key", []byte{0x81, 0x01, 0xa1, 'a'}, `{"$map":[[1,"a"]]}`},
+		{"map with a $ key", []byte{0x81, 0xa2, '$', 'a', 0x01}, `{"$map":[["$a",1]]}`},
+		{"map with a duplicate key", []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'a', 0x02}, `{"$map":[["a",1],["a",2]]}`},
+		{"map16", []byte{0xde, 0x00, 0x01, 0xa1, 'a', 0x01}, `{"$code":222,"$value":{"a":1}}`},
+	}
+	for _, tt := range tests {
+		got, err := msgpackToJSON(tt.data, 0)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: JSON %s, want %s", tt.name, got, tt.want)
+		}
+
+		node, nErr := parseJSONNode([]byte(tt.want))
+		if nErr != nil {
+			t.Fatalf("%s: %v", tt.name, nErr)
+		}
+		var w bytes.Buffer
+		if err := node.writeMsgpack(&w, -1, 0); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(w.Bytes(), tt.data) {
+			t.Errorf("%s: msgpack % x, want % x", tt.name, w.Bytes(), tt.data)
+		}
+	}
+}
+
+func TestMsgJSONErrors(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x91}, msgJSONMaxDepth+2)
+	reads := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"invalid code", []byte{0xc1}, "invalid code"},
+		{"truncated", []byte{0xcd, 0x01}, "unexpected end of data"},
+		{"trailing bytes", []byte{0x01, 0x02}, "1 bytes after value"},
+		{"too deep", append(deep, 0xc0), "nesting too deep"},
+	}
+	for _, tt := range reads {
+		_, err := msgpackToJSON(tt.data, 0)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	writes := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"value too wide for code", `{"$code":204,"$value":300}`, "does not fit"},
+		{"negative in uint code", `{"$code":205,"$value":-1}`, "does not fit"},
+		{"unknown tag", `{"$nope":1}`, "unknown tag"},
+		{"ext type out of range", `{"$ext":200,"data":""}`, "invalid $ext"},
+		{"bad map pair", `{"$map":[[1]]}`, "[key, value] pairs"},
+	}
+	for _, tt := range writes {
+		node, nErr := parseJSONNode([]byte(tt.json))
+		if nErr != nil {
+			t.Fatalf("%s: %v", tt.name, nErr)
+		}
+		err := node.writeMsgpack(&bytes.Buffer{}, -1, 0)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
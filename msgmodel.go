@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/codes"
+)
+
+// msgRaw keeps the original msgpack map of a model, so unknown keys and
+// untouched values are written back byte for byte
+type msgRaw struct {
+	decoded bool
+	isNil   bool
+	code    codes.Code
+	keys    []string
+	rawKeys [][]byte
+	values  [][]byte
+}
+
+func (raw *msgRaw) rawMap() *msgRaw {
+	return raw
+}
+
+type msgModel interface {
+	rawMap() *msgRaw
+}
+
+type msgField struct {
+	name  string
+	index int
+}
+
+func modelFields(t reflect.Type) (fields []msgField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Anonymous {
+			continue
+		}
+
+		name := f.Tag.Get("msgpack")
+		if idx := strings.IndexByte(name, ','); idx >= 0 {
+			name = name[:idx]
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, msgField{name: name, index: i})
+	}
+	return
+}
+
+// msgIntMap is an int keyed map of a model, encoded with sorted keys so an
+// edited block is written the same way every time
+type msgIntMap map[int32]int32
+
+// EncodeMsgpack implements for msgIntMap
+func (m msgIntMap) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if m == nil {
+		return enc.EncodeNil()
+	}
+
+	keys := make([]int32, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a] < keys[b] })
+
+	err := enc.EncodeMapLen(len(keys))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		kErr := enc.EncodeInt(int64(k))
+		if kErr != nil {
+			return kErr
+		}
+		vErr := enc.EncodeInt(int64(m[k]))
+		if vErr != nil {
+			return vErr
+		}
+	}
+	return nil
+}
+
+func newMsgEncoder(w *bytes.Buffer) *msgpack.Encoder {
+	enc := msgpack.NewEncoder(w)
+	enc.UseCompactInts(true)
+	return enc
+}
+
+func newMsgDecoder(data []byte) *msgpack.Decoder {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetDecodeMapFunc(decodeMsgMap)
+	return dec
+}
+
+func decodeModel(dec *msgpack.Decoder, m msgModel) (err error) {
+	rv := reflect.ValueOf(m).Elem()
+	raw := m.rawMap()
+	*raw = msgRaw{decoded: true}
+
+	code, codeErr := dec.PeekCode()
+	if codeErr != nil {
+		err = codeErr
+		return
+	}
+	raw.code = code
+
+	n, lenErr := dec.DecodeMapLen()
+	if lenErr != nil {
+		err = lenErr
+		return
+	}
+	if n == -1 {
+		raw.isNil = true
+		return
+	}
+
+	byName := make(map[string]int)
+	for _, f := range modelFields(rv.Type()) {
+		byName[f.name] = f.index
+	}
+
+	for i := 0; i < n; i++ {
+		rawKey, kErr := dec.DecodeRaw()
+		if kErr != nil {
+			err = kErr
+			return
+		}
+
+		var key string
+		keyErr := newMsgDecoder(rawKey).Decode(&key)
+		if keyErr != nil {
+			err = keyErr
+			return
+		}
+
+		value, vErr := dec.DecodeRaw()
+		if vErr != nil {
+			err = vErr
+			return
+		}
+
+		raw.keys = append(raw.keys, key)
+		raw.rawKeys = append(raw.rawKeys, rawKey)
+		raw.values = append(raw.values, value)
+
+		idx, ok := byName[key]
+		if !ok {
+			continue
+		}
+
+		fErr := newMsgDecoder(value).Decode(rv.Field(idx).Addr().Interface())
+		if fErr != nil {
+			err = fmt.Errorf("%s.%s: %v", rv.Type().Name(), key, fErr)
+			return
+		}
+	}
+	return
+}
+
+func encodeMapLen(w *bytes.Buffer, code codes.Code, n int) {
+	switch {
+	case code == codes.Map16 && n <= 0xffff:
+		w.WriteByte(byte(codes.Map16))
+		binary.Write(w, binary.BigEndian, uint16(n))
+	case code == codes.Map32:
+		w.WriteByte(byte(codes.Map32))
+		binary.Write(w, binary.BigEndian, uint32(n))
+	default:
+		newMsgEncoder(w).EncodeMapLen(n)
+	}
+}
+
+func encodeModel(enc *msgpack.Encoder, m msgModel) (err error) {
+	rv := reflect.ValueOf(m).Elem()
+	raw := m.rawMap()
+	fields := modelFields(rv.Type())
+
+	byName := make(map[string]int)
+	for _, f := range fields {
+		byName[f.name] = f.index
+	}
+
+	var body bytes.Buffer
+	var count int
+	seen := make(map[string]bool)
+
+	for i, key := range raw.keys {
+		seen[key] = true
+		body.Write(raw.rawKeys[i])
+		count++
+
+		idx, ok := byName[key]
+		if !ok {
+			body.Write(raw.values[i])
+			continue
+		}
+
+		cur := rv.Field(idx)
+		orig := reflect.New(cur.Type())
+		oErr := newMsgDecoder(raw.values[i]).Decode(orig.Interface())
+		if oErr == nil && reflect.DeepEqual(orig.Elem().Interface(), cur.Interface()) {
+			body.Write(raw.values[i])
+			continue
+		}
+
+		vErr := newMsgEncoder(&body).Encode(cur.Addr().Interface())
+		if vErr != nil {
+			err = fmt.Errorf("%s.%s: %v", rv.Type().Name(), key, vErr)
+			return
+		}
+	}
+
+	for _, f := range fields {
+		cur := rv.Field(f.index)
+		if seen[f.name] || cur.IsZero() {
+			continue
+		}
+
+		enc := newMsgEncoder(&body)
+		kErr := enc.EncodeString(f.name)
+		if kErr != nil {
+			err = kErr
+			return
+		}
+
+		vErr := enc.Encode(cur.Addr().Interface())
+		if vErr != nil {
+			err = fmt.Errorf("%s.%s: %v", rv.Type().Name(), f.name, vErr)
+			return
+		}
+		count++
+	}
+
+	if raw.isNil && count == 0 {
+		return enc.EncodeNil()
+	}
+
+	var out bytes.Buffer
+	encodeMapLen(&out, raw.code, count)
+	out.Write(body.Bytes())
+
+	_, err = enc.Writer().Write(out.Bytes())
+	return
+}
+
+func unmarshalModel(data []byte, m msgModel) error {
+	return decodeModel(newMsgDecoder(data), m)
+}
+
+func marshalModel(m msgModel) ([]byte, error) {
+	var buf bytes.Buffer
+	err := encodeModel(newMsgEncoder(&buf), m)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func loadModel(data map[string][]byte, name string, m msgModel) error {
+	block, ok := data[name]
+	if !ok {
+		return fmt.Errorf("%s block not found", name)
+	}
+	return unmarshalModel(block, m)
+}
+
+func storeModel(data map[string][]byte, name string, m msgModel) error {
+	block, err := marshalModel(m)
+	if err != nil {
+		return err
+	}
+	data[name] = block
+	return nil
+}
+
+func readSizedBlock(data []byte, off *int) ([]byte, error) {
+	if len(data)-*off < 4 {
+		return nil, errors.New("Block size missing")
+	}
+	size := int(int32(binary.LittleEndian.Uint32(data[*off:])))
+	*off += 4
+
+	if size < 0 || size > len(data)-*off {
+		return nil, errors.New("Block size out of range")
+	}
+	block := data[*off : *off+size]
+	*off += size
+	return block, nil
+}
+
+func writeSizedBlock(w *bytes.Buffer, block []byte) {
+	binary.Write(w, binary.LittleEndian, int32(len(block)))
+	w.Write(block)
+}
+
+// msgBlockInfo strcture, one lstInfo entry of a KK / AIS block header
+type msgBlockInfo struct {
+	Name    string `msgpack:"name"`
+	Version string `msgpack:"version"`
+	Pos     int64  `msgpack:"pos"`
+	Size    int64  `msgpack:"size"`
+}
+
+func marshalBlockHeader(lstInfo []msgBlockInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	blockHead := map[string][]msgBlockInfo{
+		"lstInfo": lstInfo,
+	}
+
+	err := newMsgEncoder(&buf).Encode(blockHead)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockDataOrder returns header indexes sorted by their original data
+// position, so blocks are written back in the order they were read
+func blockDataOrder(lstPos []int64) []int {
+	order := make([]int, len(lstPos))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return lstPos[order[a]] < lstPos[order[b]]
+	})
+	return order
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// testMsgInt32 is n written as a full int32, the way the game encodes it
+func testMsgInt32(n int32) msgpack.RawMessage {
+	return msgpack.RawMessage{0xd2, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+}
+
+func testMsgFloat32(t testing.TB, f float32) msgpack.RawMessage {
+	var b bytes.Buffer
+	if err := msgpack.NewEncoder(&b).EncodeFloat32(f); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// testMap16 rewrites the fixmap header of a testMsgMap as a map16 one
+func testMap16(m []byte) []byte {
+	return append([]byte{0xde, 0, m[0] & 0x0f}, m[1:]...)
+}
+
+func TestModelRoundTrip(t *testing.T) {
+	answer := testMsgMap(t, "animal", true, "unknownAnswer", int8(-1))
+	tests := []struct {
+		name  string
+		data  []byte
+		model msgModel
+	}{
+		{"KKParameter", testMsgMap(t,
+			"version", "0.0.0",
+			"sex", testMsgInt32(1),
+			"lastname", "Sato",
+			"voiceRate", testMsgFloat32(t, 0.3),
+			"awnser", msgpack.RawMessage(answer),
+			"futureKey", []interface{}{1, "a"},
+			"personality", testMsgInt32(-7),
+		), &KKParameter{}},
+		{"KKStatus", testMap16(testMsgMap(t,
+			"version", "0.0.0",
+			"clothesState", []byte{0, 1, 2},
+			"hohoAkaRate", testMsgFloat32(t, 1.0/3),
+			"showAccessory", []bool{true, false},
+			"coordinateType", testMsgInt32(2),
+		)), &KKStatus{}},
+		{"KKFace", testMsgMap(t,
+			"version", "0.0.1",
+			"shapeValueFace", []interface{}{testMsgFloat32(t, 0.1), testMsgFloat32(t, 0.7)},
+			"baseMakeup", msgpack.RawMessage(testMsgMap(t,
+				"cheekId", testMsgInt32(3),
+				"paintColor", []interface{}{[]interface{}{testMsgFloat32(t, 0.2)}},
+				"unknownMakeup", map[string]interface{}{"a": 1},
+			)),
+		), &KKFace{}},
+		{"KKHair", testMsgMap(t,
+			"version", "0.0.0",
+			"parts", []interface{}{
+				msgpack.RawMessage(testMsgMap(t, "id", testMsgInt32(10), "length", testMsgFloat32(t, 0.5))),
+				msgpack.RawMessage(testMap16(testMsgMap(t, "id", 11, "extra", "x"))),
+			},
+			"glossId", testMsgInt32(0),
+		), &KKHair{}},
+		{"AISParameter", testMsgMap(t,
+			"version", "0.0.0",
+			"fullname", "Ai",
+			"hsWish", []interface{}{testMsgInt32(1), testMsgInt32(2)},
+			"voiceRate", testMsgFloat32(t, 0.25),
+		), &AISParameter{}},
+		{"AISStatus", testMsgMap(t,
+			"version", "0.0.0",
+			"eyesOpenMax", testMsgFloat32(t, 0.9),
+			"tongueState", testMsgInt32(1),
+			"unknownStatus", nil,
+		), &AISStatus{}},
+	}
+
+	for _, tt := range tests {
+		if err := unmarshalModel(tt.data, tt.model); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tt.name, err)
+		}
+		out, err := marshalModel(tt.model)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", tt.name, err)
+		}
+		if !bytes.Equal(out, tt.data) {
+			t.Errorf("%s: round trip changed the block\n got % x\nwant % x", tt.name, out, tt.data)
+		}
+	}
+}
+
+func TestModelEdit(t *testing.T) {
+	data := testMsgMap(t,
+		"version", "0.0.0",
+		"sex", testMsgInt32(1),
+		"unknownKey", testMsgInt32(5),
+		"firstname", "Yui",
+	)
+
+	var para KKParameter
+	if err := unmarshalModel(data, &para); err != nil {
+		t.Fatal(err)
+	}
+	para.Firstname = "Mio"
+	para.Personality = 4
+
+	out, err := marshalModel(&para)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// edited values are re-encoded in place, new ones appended
+	want := testMsgMap(t,
+		"version", "0.0.0",
+		"sex", testMsgInt32(1),
+		"unknownKey", testMsgInt32(5),
+		"firstname", "Mio",
+		"personality", 4,
+	)
+	if !bytes.Equal(out, want) {
+		t.Errorf("got % x\nwant % x", out, want)
+	}
+}
+
+func TestModelNil(t *testing.T) {
+	var status KKStatus
+	if err := unmarshalModel([]byte{0xc0}, &status); err != nil {
+		t.Fatal(err)
+	}
+	out, err := marshalModel(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte{0xc0}) {
+		t.Errorf("nil map written as % x", out)
+	}
+}
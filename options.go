@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Game IDs
+const (
+	gameAIS = "AIS"
+	gameHS2 = "HS2"
+	gameHS  = "HS"
+	gameKK  = "KK"
+	gamePH  = "PH"
+)
+
+var gameIDs = []string{gameAIS, gameHS2, gameHS, gameKK, gamePH}
+
+var gameNames = map[string]string{
+	gameAIS: "AI Shoujo",
+	gameHS2: "Honey Select 2",
+	gameHS:  "Honey Select",
+	gameKK:  "Koikatsu",
+	gamePH:  "PlayHome",
+}
+
+func parseGameID(str string) (game string, err error) {
+	for _, v := range gameIDs {
+		if strings.EqualFold(v, str) {
+			game = v
+			return
+		}
+	}
+	err = fmt.Errorf("Unknown game '%s', expected one of %s", str, strings.Join(gameIDs, ", "))
+	return
+}
+
+// ExtractOptions strcture
+type ExtractOptions struct {
+	// 0 all, 1 male, 2 female
+	flag int
+	// empty for all games
+	game string
+	// copy the original chara bytes instead of re-serializing
+	raw bool
+	// re-read written cards and compare their blocks
+	verify bool
+	// HS trailer, hsSigRegenerate or hsSigPreserve
+	hsSig string
+	// PH output version as given to --ph-version, empty for phLatestVersion
+	phVersion string
+	// dump every block as JSON instead of a summary
+	json bool
+	// fields to change with the edit command
+	edits []CharaEdit
+	// thumbMode is one of the thumb* modes, empty for default
+	thumbMode     string
+	thumbTemplate string
+	// built from thumbMode by newThumbnailer
+	thumb Thumbnailer
+	// embed provenance text chunks in written cards
+	meta bool
+	// built from meta by newCardMeta
+	cardMeta *CardMeta
+	// new png or jpeg of the thumbnail command
+	thumbImage string
+	// AIS / HS2 coordinate cards get the whole KKEx block of the chara, not
+	// only the outfit and accessory plugins
+	coordExt bool
+	// read limits of the command line, applied by SetReadLimits
+	limits ReadLimits
+}
+
+func parsePHVersion(str string) (version int32, err error) {
+	if str == "same" {
+		version = phVersionSame
+		return
+	}
+
+	v, vErr := strconv.Atoi(str)
+	if vErr != nil || v < 0 || v > phLatestVersion {
+		err = fmt.Errorf("Unsupported PlayHome version '%s', expected same or 0 to %d", str, phLatestVersion)
+		return
+	}
+	version = int32(v)
+	return
+}
+
+func (opts *ExtractOptions) skipGame(game string) bool {
+	return opts.game != "" && opts.game != game
+}
+
+// skipSex reports whether the male / female flag filters out sex
+func (opts *ExtractOptions) skipSex(sex int32) bool {
+	return (opts.flag == 1 && sex != 0) || (opts.flag == 2 && sex != 1)
+}
+
+// GameReport strcture
+type GameReport struct {
+	game   string
+	total  int
+	write  int
+	failed int
+}
+
+// ExtractReport strcture
+type ExtractReport struct {
+	games []GameReport
+}
+
+func (r *ExtractReport) find(game string) *GameReport {
+	for i := range r.games {
+		if r.games[i].game == game {
+			return &r.games[i]
+		}
+	}
+	r.games = append(r.games, GameReport{game: game})
+	return &r.games[len(r.games)-1]
+}
+
+func (r *ExtractReport) found(game string) {
+	r.find(game).total++
+}
+
+func (r *ExtractReport) wrote(game string) {
+	r.find(game).write++
+}
+
+func (r *ExtractReport) verifyFailed(game string) {
+	r.find(game).failed++
+}
+
+// Total implements for ExtractReport
+func (r *ExtractReport) Total() (total int) {
+	for _, v := range r.games {
+		total += v.total
+	}
+	return
+}
+
+// Write implements for ExtractReport
+func (r *ExtractReport) Write() (write int) {
+	for _, v := range r.games {
+		write += v.write
+	}
+	return
+}
+
+func (r *ExtractReport) print() {
+	for _, v := range r.games {
+		if v.failed > 0 {
+			fmt.Printf("\t %s: %d found, %d extracted, %d failed verification\n", gameNames[v.game], v.total, v.write, v.failed)
+		} else {
+			fmt.Printf("\t %s: %d found, %d extracted\n", gameNames[v.game], v.total, v.write)
+		}
+	}
+}
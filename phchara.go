@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -24,6 +25,10 @@ type PHCharaCard struct {
 	body      []byte
 	wear      []byte
 	accessory []byte
+	// original CustomParameter bytes, in the source version
+	rawData []byte
+	// original thumbnail of a standalone card
+	pngData []byte
 }
 
 // PHSceneCard strcture
@@ -33,13 +38,104 @@ type PHSceneCard struct {
 	charaCards map[string]PHCharaCard
 }
 
+// PlayHome CustomParameter sex
+const (
+	phSexFemale = 0
+	phSexMale   = 1
+)
+
+// PlayHome studio OICharInfo sex, the other way round
+const (
+	phSceneSexMale   = 0
+	phSceneSexFemale = 1
+)
+
+// phSexInfo strcture, one row of the PlayHome sex mapping
+type phSexInfo struct {
+	custom int32
+	scene  int32
+	marker string
+	// 0 male, 1 female like the other games, used by filter and thumbnail
+	sex int32
+}
+
+var phSexTable = []phSexInfo{
+	{custom: phSexFemale, scene: phSceneSexFemale, marker: phCharaFemaleMark, sex: 1},
+	{custom: phSexMale, scene: phSceneSexMale, marker: phCharaMaleMark, sex: 0},
+}
+
+func phSexByCustom(sex int32) (info phSexInfo, err error) {
+	for _, v := range phSexTable {
+		if v.custom == sex {
+			info = v
+			return
+		}
+	}
+	err = fmt.Errorf("Unknown PlayHome sex %d", sex)
+	return
+}
+
+func phSexByMarker(marker string) (info phSexInfo, err error) {
+	for _, v := range phSexTable {
+		if v.marker == marker {
+			info = v
+			return
+		}
+	}
+	err = errors.New("PH Chara mark not found")
+	return
+}
+
+// phLatestVersion is the CustomParameter version the readers convert to
+const phLatestVersion = 10
+
+// phVersionSame writes cards in the version of the scene
+const phVersionSame = -1
+
 var phStudioMark = "【PHStudio】"
 var phCharaMaleMark = "【PlayHome_Male】"
 var phCharaFemaleMark = "【PlayHome_Female】"
 
 // PHChara strcture
 type PHChara struct {
-	card *PHSceneCard
+	card  *PHSceneCard
+	thumb Thumbnailer
+	meta  *CardMeta
+	// CustomParameter version of written cards, or phVersionSame
+	version int32
+}
+
+// copyPHBytes copies n bytes from the reader to the buffer unchanged.
+func copyPHBytes(reader *bbio.Reader, buf *bbio.Buffer, n int) error {
+	b, err := reader.ReadBytes(n)
+	if err != nil {
+		return err
+	}
+	_, err = buf.Write(b)
+	return err
+}
+
+// skipPHBytes discards n bytes from the reader.
+func skipPHBytes(reader *bbio.Reader, n int) error {
+	_, err := reader.ReadBytes(n)
+	return err
+}
+
+// readPHCount reads an element count, each element taking at least elemSize bytes.
+func readPHCount(reader *bbio.Reader, elemSize int64) (int, error) {
+	count, err := reader.ReadInt32()
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("Invalid element count %d", count)
+	}
+
+	err = checkBlockSize(reader, int64(count)*elemSize)
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
 }
 
 func readPHColorHair(reader *bbio.Reader, version int32) (b []byte, err error) {
@@ -47,8 +143,10 @@ func readPHColorHair(reader *bbio.Reader, version int32) (b []byte, err error) {
 	buf.PutInt(1) // colorType
 
 	if version < 4 {
-		bm, _ := reader.ReadBytes(16) // mainColor
-		buf.Write(bm)
+		err = copyPHBytes(reader, buf, 16) // mainColor
+		if err != nil {
+			return
+		}
 
 		// cuticleColor, cuticleExp
 		buf.PutFloatAll(0.75, 0.75, 0.75, 1.0, 6.0)
@@ -56,11 +154,16 @@ func readPHColorHair(reader *bbio.Reader, version int32) (b []byte, err error) {
 		buf.PutFloatAll(0.75, 0.75, 0.75, 1.0, 0.3)
 
 	} else {
-		reader.ReadInt32() // colorType >> 1
+		err = skipPHBytes(reader, 4) // colorType >> 1
+		if err != nil {
+			return
+		}
 
 		// mainColor, cuticleColor, cuticleExp, fresnelColor, fresnelExp
-		bc, _ := reader.ReadBytes(56)
-		buf.Write(bc)
+		err = copyPHBytes(reader, buf, 56)
+		if err != nil {
+			return
+		}
 	}
 
 	b = buf.Bytes()
@@ -72,8 +175,10 @@ func readPHColorPBR1(reader *bbio.Reader, version int32) (b []byte, err error) {
 	buf.PutInt(2) // colorType
 
 	if version < 4 {
-		bm, _ := reader.ReadBytes(16) // mainColor1
-		buf.Write(bm)
+		err = copyPHBytes(reader, buf, 16) // mainColor1
+		if err != nil {
+			return
+		}
 
 		// specColor1
 		buf.PutFloatAll(1.0, 1.0, 1.0, 1.0)
@@ -81,11 +186,17 @@ func readPHColorPBR1(reader *bbio.Reader, version int32) (b []byte, err error) {
 		buf.PutFloatAll(0.0, 0.0)
 
 	} else {
-		colorType, _ := reader.ReadInt32() // colorType
+		colorType, ctErr := reader.ReadInt32() // colorType
+		if ctErr != nil {
+			err = ctErr
+			return
+		}
 		if colorType != 0 {
 			// mainColor1, specColor1, specular1, smooth1
-			bc, _ := reader.ReadBytes(40)
-			buf.Write(bc)
+			err = copyPHBytes(reader, buf, 40)
+			if err != nil {
+				return
+			}
 
 		} else {
 			// mainColor1
@@ -106,8 +217,10 @@ func readPHColorPBR2(reader *bbio.Reader, version int32) (b []byte, err error) {
 	buf.PutInt(3) // colorType
 
 	if version < 4 {
-		bm, _ := reader.ReadBytes(16) // mainColor1
-		buf.Write(bm)
+		err = copyPHBytes(reader, buf, 16) // mainColor1
+		if err != nil {
+			return
+		}
 
 		// specColor1, specular1, smooth1
 		buf.PutFloatAll(1.0, 1.0, 1.0, 1.0, 0.0, 0.0)
@@ -119,17 +232,25 @@ func readPHColorPBR2(reader *bbio.Reader, version int32) (b []byte, err error) {
 		buf.PutFloatAll(0.0, 0.0)
 
 	} else {
-		colorType, _ := reader.ReadInt32() // colorType
+		colorType, ctErr := reader.ReadInt32() // colorType
+		if ctErr != nil {
+			err = ctErr
+			return
+		}
 		if colorType != 0 {
 			// mainColor1, specColor1, specular1
 			// smooth1, mainColor2, specColor2
-			bc, _ := reader.ReadBytes(72)
-			buf.Write(bc)
+			err = copyPHBytes(reader, buf, 72)
+			if err != nil {
+				return
+			}
 
 			if version >= 5 {
 				// specular2
-				sp2, _ := reader.ReadSingle()
-				buf.PutFloat(sp2)
+				err = copyPHBytes(reader, buf, 4)
+				if err != nil {
+					return
+				}
 
 			} else {
 				// specular2
@@ -137,8 +258,10 @@ func readPHColorPBR2(reader *bbio.Reader, version int32) (b []byte, err error) {
 			}
 
 			// smooth2
-			sm2, _ := reader.ReadSingle()
-			buf.PutFloat(sm2)
+			err = copyPHBytes(reader, buf, 4)
+			if err != nil {
+				return
+			}
 
 		} else {
 			// mainColor1
@@ -166,18 +289,26 @@ func readPHColorAlloy(reader *bbio.Reader, version int32) (b []byte, err error)
 	buf.PutInt(4) // colorType
 
 	if version < 4 {
-		bm, _ := reader.ReadBytes(16) // mainColor
-		buf.Write(bm)
+		err = copyPHBytes(reader, buf, 16) // mainColor
+		if err != nil {
+			return
+		}
 
 		// metallic, smooth
 		buf.PutFloatAll(0.0, 0.0)
 
 	} else {
-		colorType, _ := reader.ReadInt32() // colorType
+		colorType, ctErr := reader.ReadInt32() // colorType
+		if ctErr != nil {
+			err = ctErr
+			return
+		}
 		if colorType != 0 {
 			// mainColor, metallic, smooth
-			bc, _ := reader.ReadBytes(24)
-			buf.Write(bc)
+			err = copyPHBytes(reader, buf, 24)
+			if err != nil {
+				return
+			}
 
 		} else {
 			// mainColor, metallic, smooth
@@ -194,35 +325,54 @@ func readPHColorAlloyHSVOffset(reader *bbio.Reader, version int32) (b []byte, er
 	buf.PutInt(5) // colorType
 
 	if version < 4 {
-		reader.ReadBytes(16)
+		err = skipPHBytes(reader, 16)
+		if err != nil {
+			return
+		}
 
 		// hsv offset + alpha, metallic, smooth
 		buf.PutFloatAll(0.0, 1.0, 1.0, 1.0, 0.0, 0.562)
 
 	} else {
-		colorType, _ := reader.ReadInt32() // colorType
+		colorType, ctErr := reader.ReadInt32() // colorType
+		if ctErr != nil {
+			err = ctErr
+			return
+		}
 		if colorType != 0 {
 
 			if version < 6 {
-				reader.ReadBytes(16)
+				err = skipPHBytes(reader, 16)
+				if err != nil {
+					return
+				}
 				// hsv offset + alpha
 				buf.PutFloatAll(0.0, 1.0, 1.0, 1.0)
 
 			} else {
 				// offset_h, offset_s, offset_v
-				bm, _ := reader.ReadBytes(12)
-				buf.Write(bm)
+				err = copyPHBytes(reader, buf, 12)
+				if err != nil {
+					return
+				}
 
 				if version == 7 {
-					reader.ReadBoolean()
+					err = skipPHBytes(reader, 1)
+					if err != nil {
+						return
+					}
 					// alpha
-					a, _ := reader.ReadSingle()
-					buf.PutFloat(a)
+					err = copyPHBytes(reader, buf, 4)
+					if err != nil {
+						return
+					}
 
 				} else if version >= 8 {
 					// alpha
-					a, _ := reader.ReadSingle()
-					buf.PutFloat(a)
+					err = copyPHBytes(reader, buf, 4)
+					if err != nil {
+						return
+					}
 
 				} else {
 					// alpha
@@ -231,8 +381,10 @@ func readPHColorAlloyHSVOffset(reader *bbio.Reader, version int32) (b []byte, er
 			}
 
 			// metallic, smooth
-			ms, _ := reader.ReadBytes(8)
-			buf.Write(ms)
+			err = copyPHBytes(reader, buf, 8)
+			if err != nil {
+				return
+			}
 
 		} else {
 			// hsv offset + alpha, metallic, smooth
@@ -249,8 +401,10 @@ func readPHColorEyeHighlight(reader *bbio.Reader, version int32) (b []byte, err
 	buf.PutInt(7) // colorType
 
 	if version < 4 {
-		bm, _ := reader.ReadBytes(16) // mainColor1
-		buf.Write(bm)
+		err = copyPHBytes(reader, buf, 16) // mainColor1
+		if err != nil {
+			return
+		}
 
 		// specColor1
 		buf.PutFloatAll(1.0, 1.0, 1.0, 1.0)
@@ -258,11 +412,17 @@ func readPHColorEyeHighlight(reader *bbio.Reader, version int32) (b []byte, err
 		buf.PutFloatAll(0.0, 0.0)
 
 	} else {
-		colorType, _ := reader.ReadInt32() // colorType
+		colorType, ctErr := reader.ReadInt32() // colorType
+		if ctErr != nil {
+			err = ctErr
+			return
+		}
 		if colorType != 0 {
 			// mainColor1, specColor1, specular1, smooth1
-			bc, _ := reader.ReadBytes(40)
-			buf.Write(bc)
+			err = copyPHBytes(reader, buf, 40)
+			if err != nil {
+				return
+			}
 
 		} else {
 			// mainColor1
@@ -281,21 +441,35 @@ func readPHColorEyeHighlight(reader *bbio.Reader, version int32) (b []byte, err
 func readPHHair(reader *bbio.Reader, version int32) (b []byte, err error) {
 	buf := bbio.NewBuffer()
 
-	partsCount, _ := reader.ReadInt32()
-	buf.PutInt(partsCount)
+	partsCount, pcErr := readPHCount(reader, 4)
+	if pcErr != nil {
+		err = pcErr
+		return
+	}
+	buf.PutInt(int32(partsCount))
 
-	for i := 0; i < int(partsCount); i++ {
+	for i := 0; i < partsCount; i++ {
 		// hairPartID
-		id, _ := reader.ReadInt32()
-		buf.PutInt(id)
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
 
 		// hairColor
-		hairColor, _ := readPHColorHair(reader, version)
+		hairColor, hcErr := readPHColorHair(reader, version)
+		if hcErr != nil {
+			err = hcErr
+			return
+		}
 		buf.Write(hairColor)
 
 		if version > 0 {
 			// acceColor
-			acceColor, _ := readPHColorPBR1(reader, version)
+			acceColor, acErr := readPHColorPBR1(reader, version)
+			if acErr != nil {
+				err = acErr
+				return
+			}
 			buf.Write(acceColor)
 
 		} else {
@@ -312,54 +486,76 @@ func readPHHead(reader *bbio.Reader, version int32, sex int32) (b []byte, err er
 	buf := bbio.NewBuffer()
 
 	// headID, faceTexID, detailID, detailWeight, eyeBrowID
-	b1, _ := reader.ReadBytes(20)
-	buf.Write(b1)
+	err = copyPHBytes(reader, buf, 20)
+	if err != nil {
+		return
+	}
 
 	// eyeBrowColor
-	ebc, _ := readPHColorPBR1(reader, version)
+	ebc, ebcErr := readPHColorPBR1(reader, version)
+	if ebcErr != nil {
+		err = ebcErr
+		return
+	}
 	buf.Write(ebc)
 
 	if version < 4 {
 		// eyeScleraColor
-		esc, _ := reader.ReadBytes(16)
+		esc, escErr := reader.ReadBytes(16)
+		if escErr != nil {
+			err = escErr
+			return
+		}
 
 		// eyeID_L
-		eyeIDL, _ := reader.ReadInt32()
-		buf.PutInt(eyeIDL)
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
 
 		// eyeScleraColorL
 		buf.Write(esc)
 
 		// eyeIrisColorL
-		eicl, _ := reader.ReadBytes(16)
-		buf.Write(eicl)
+		err = copyPHBytes(reader, buf, 16)
+		if err != nil {
+			return
+		}
 
 		// eyePupilDilationL, eyeEmissiveL
 		buf.PutFloatAll(0.0, 0.5)
 
 		// eyeID_R
-		eyeIDR, _ := reader.ReadInt32()
-		buf.PutInt(eyeIDR)
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
 
 		// eyeScleraColorR
 		buf.Write(esc)
 
 		// eyeIrisColorR
-		eicr, _ := reader.ReadBytes(16)
-		buf.Write(eicr)
+		err = copyPHBytes(reader, buf, 16)
+		if err != nil {
+			return
+		}
 
 		// eyePupilDilationR, eyeEmissiveR
 		buf.PutFloatAll(0.0, 0.5)
 
 	} else {
 		// eyeID_L, eyeScleraColorL, eyeIrisColorL eyePupilDilationL
-		bel, _ := reader.ReadBytes(40)
-		buf.Write(bel)
+		err = copyPHBytes(reader, buf, 40)
+		if err != nil {
+			return
+		}
 
 		if version >= 10 {
 			// eyeEmissiveL
-			eel, _ := reader.ReadSingle()
-			buf.PutFloat(eel)
+			err = copyPHBytes(reader, buf, 4)
+			if err != nil {
+				return
+			}
 
 		} else {
 			// eyeEmissiveL
@@ -367,13 +563,17 @@ func readPHHead(reader *bbio.Reader, version int32, sex int32) (b []byte, err er
 		}
 
 		// eyeID_R, eyeScleraColorR, eyeIrisColorR, eyePupilDilationR
-		ber, _ := reader.ReadBytes(40)
-		buf.Write(ber)
+		err = copyPHBytes(reader, buf, 40)
+		if err != nil {
+			return
+		}
 
 		if version >= 10 {
 			// eyeEmissiveR
-			eer, _ := reader.ReadSingle()
-			buf.PutFloat(eer)
+			err = copyPHBytes(reader, buf, 4)
+			if err != nil {
+				return
+			}
 
 		} else {
 			// eyeEmissiveR
@@ -382,52 +582,68 @@ func readPHHead(reader *bbio.Reader, version int32, sex int32) (b []byte, err er
 	}
 
 	// tattooID, tattooColor
-	bt, _ := reader.ReadBytes(20)
-	buf.Write(bt)
+	err = copyPHBytes(reader, buf, 20)
+	if err != nil {
+		return
+	}
 
 	// shapeVals
-	shapeCount, _ := reader.ReadInt32()
-	buf.PutInt(shapeCount)
-	sh, _ := reader.ReadBytes(int(shapeCount) * 4)
-	buf.Write(sh)
+	shapeCount, scErr := readPHCount(reader, 4)
+	if scErr != nil {
+		err = scErr
+		return
+	}
+	buf.PutInt(int32(shapeCount))
+	err = copyPHBytes(reader, buf, shapeCount*4)
+	if err != nil {
+		return
+	}
 
-	if sex == 0 {
+	if sex == phSexFemale {
 		// eyeLash
-		el, _ := reader.ReadInt32()
-		buf.PutInt(el)
-		elb, _ := readPHColorPBR1(reader, version)
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
+		elb, elbErr := readPHColorPBR1(reader, version)
+		if elbErr != nil {
+			err = elbErr
+			return
+		}
 		buf.Write(elb)
 
-		// eyeshadow
-		eyeshadow, _ := reader.ReadBytes(20)
-		buf.Write(eyeshadow)
-
-		// cheek
-		cheek, _ := reader.ReadBytes(20)
-		buf.Write(cheek)
-
-		// lip
-		lip, _ := reader.ReadBytes(20)
-		buf.Write(lip)
-
-		// mole
-		mole, _ := reader.ReadBytes(20)
-		buf.Write(mole)
+		// eyeshadow, cheek, lip, mole
+		err = copyPHBytes(reader, buf, 80)
+		if err != nil {
+			return
+		}
 
 		// eyeHighlight
-		eyehl, _ := reader.ReadInt32()
-		buf.PutInt(eyehl)
-		eyehlb, _ := readPHColorEyeHighlight(reader, version)
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
+		eyehlb, ehErr := readPHColorEyeHighlight(reader, version)
+		if ehErr != nil {
+			err = ehErr
+			return
+		}
 		buf.Write(eyehlb)
 
 	} else {
 		// beard
-		beard, _ := reader.ReadBytes(20)
-		buf.Write(beard)
+		err = copyPHBytes(reader, buf, 20)
+		if err != nil {
+			return
+		}
 
 		if version >= 2 {
 			// eyeHighlightColor
-			ehlc, _ := readPHColorEyeHighlight(reader, version)
+			ehlc, ehErr := readPHColorEyeHighlight(reader, version)
+			if ehErr != nil {
+				err = ehErr
+				return
+			}
 			buf.Write(ehlc)
 
 		} else {
@@ -447,52 +663,88 @@ func readPHBody(reader *bbio.Reader, version int32, sex int32) (b []byte, err er
 	buf := bbio.NewBuffer()
 
 	// bodyID
-	bID, _ := reader.ReadInt32()
-	buf.PutInt(bID)
+	err = copyPHBytes(reader, buf, 4)
+	if err != nil {
+		return
+	}
 
 	// skinColor
-	sc, _ := readPHColorAlloyHSVOffset(reader, version)
+	sc, scErr := readPHColorAlloyHSVOffset(reader, version)
+	if scErr != nil {
+		err = scErr
+		return
+	}
 	buf.Write(sc)
 
 	// detailID, detailWeight, underhairID
-	b1, _ := reader.ReadBytes(12)
-	buf.Write(b1)
+	err = copyPHBytes(reader, buf, 12)
+	if err != nil {
+		return
+	}
 
 	// underhairColor
-	uhc, _ := readPHColorAlloy(reader, version)
+	uhc, uhcErr := readPHColorAlloy(reader, version)
+	if uhcErr != nil {
+		err = uhcErr
+		return
+	}
 	buf.Write(uhc)
 
 	// tattooID, tattooColor
-	bt, _ := reader.ReadBytes(20)
-	buf.Write(bt)
+	err = copyPHBytes(reader, buf, 20)
+	if err != nil {
+		return
+	}
 
 	// shapeVals
-	shapeCount, _ := reader.ReadInt32()
-	buf.PutInt(shapeCount)
-	sh, _ := reader.ReadBytes(int(shapeCount) * 4)
-	buf.Write(sh)
+	shapeCount, shErr := readPHCount(reader, 4)
+	if shErr != nil {
+		err = shErr
+		return
+	}
+	buf.PutInt(int32(shapeCount))
+	err = copyPHBytes(reader, buf, shapeCount*4)
+	if err != nil {
+		return
+	}
 
-	if sex == 0 {
+	if sex == phSexFemale {
 		// nipID
-		nipID, _ := reader.ReadInt32()
-		buf.PutInt(nipID)
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
 
 		// nipColor
-		nipColor, _ := readPHColorAlloyHSVOffset(reader, version)
+		nipColor, ncErr := readPHColorAlloyHSVOffset(reader, version)
+		if ncErr != nil {
+			err = ncErr
+			return
+		}
 		buf.Write(nipColor)
 
 		// sunburnID, sunburnColor
-		sun, _ := reader.ReadBytes(20)
-		buf.Write(sun)
+		err = copyPHBytes(reader, buf, 20)
+		if err != nil {
+			return
+		}
 
 		if version >= 3 {
 			// nailColor
-			nail, _ := readPHColorAlloyHSVOffset(reader, version)
+			nail, nErr := readPHColorAlloyHSVOffset(reader, version)
+			if nErr != nil {
+				err = nErr
+				return
+			}
 			buf.Write(nail)
 
 			if version >= 9 {
 				// manicureColor
-				manc, _ := readPHColorPBR1(reader, version)
+				manc, mErr := readPHColorPBR1(reader, version)
+				if mErr != nil {
+					err = mErr
+					return
+				}
 				buf.Write(manc)
 
 			} else {
@@ -504,8 +756,10 @@ func readPHBody(reader *bbio.Reader, version int32, sex int32) (b []byte, err er
 			}
 
 			// areolaSize, bustSoftness, bustWeight
-			abb, _ := reader.ReadBytes(12)
-			buf.Write(abb)
+			err = copyPHBytes(reader, buf, 12)
+			if err != nil {
+				return
+			}
 
 		} else {
 			// nailColor
@@ -533,18 +787,26 @@ func readPHWear(reader *bbio.Reader, version int32, sex int32) (b []byte, err er
 
 	for i := 0; i < 11; i++ {
 		// WEAR_TYPE, id
-		bb, _ := reader.ReadBytes(8)
-		buf.Write(bb)
+		err = copyPHBytes(reader, buf, 8)
+		if err != nil {
+			return
+		}
 
 		// color
-		bc, _ := readPHColorPBR2(reader, version)
+		bc, bcErr := readPHColorPBR2(reader, version)
+		if bcErr != nil {
+			err = bcErr
+			return
+		}
 		buf.Write(bc)
 	}
 
-	if sex == 0 {
+	if sex == phSexFemale {
 		// isSwimwear, swimOptTop, swimOptBtm
-		bf, _ := reader.ReadBytes(3)
-		buf.Write(bf)
+		err = copyPHBytes(reader, buf, 3)
+		if err != nil {
+			return
+		}
 	}
 
 	b = buf.Bytes()
@@ -556,11 +818,17 @@ func readPHAccessory(reader *bbio.Reader, version int32) (b []byte, err error) {
 
 	for i := 0; i < 10; i++ {
 		// ACCESSORY_TYPE, id, nowAttach, addPos, addRot addScl
-		bb, _ := reader.ReadBytes(48)
-		buf.Write(bb)
+		err = copyPHBytes(reader, buf, 48)
+		if err != nil {
+			return
+		}
 
 		// color
-		bc, _ := readPHColorPBR2(reader, version)
+		bc, bcErr := readPHColorPBR2(reader, version)
+		if bcErr != nil {
+			err = bcErr
+			return
+		}
 		buf.Write(bc)
 	}
 
@@ -569,6 +837,8 @@ func readPHAccessory(reader *bbio.Reader, version int32) (b []byte, err error) {
 }
 
 func readPHCustomParameter(reader *bbio.Reader) (card PHCharaCard, err error) {
+	startOffset := reader.Position()
+
 	ver, vErr := reader.ReadInt32()
 	if vErr != nil {
 		err = vErr
@@ -617,231 +887,848 @@ func readPHCustomParameter(reader *bbio.Reader) (card PHCharaCard, err error) {
 		return
 	}
 	card.accessory = accessory
+	card.rawData = rawRange(reader, startOffset, reader.Position())
 	return
 }
 
-func readPHChild(reader *bbio.Reader, version int, lstChara map[int]PHCharaCard) (err error) {
-	chCount, ccErr := reader.ReadInt32()
-	if ccErr != nil {
-		err = ccErr
+// readPHColor10 reads a color of a version 10 stream, data is nil for a
+// colorType 0 color, which the game fills with defaults
+func readPHColor10(reader *bbio.Reader, size int) (colorType int32, data []byte, err error) {
+	colorType, err = reader.ReadInt32()
+	if err != nil || colorType == 0 {
 		return
 	}
-	var readErr error
-	for i := 0; i < int(chCount); i++ {
-		iType, itErr := reader.ReadInt32()
-		if itErr != nil {
-			err = itErr
-			return
-		}
-		switch iType {
-		case 0:
-			readErr = readPHOICharInfo(reader, version, lstChara)
-		case 1:
-			readErr = readPHOIItemInfo(reader, version, lstChara)
-		case 2:
-			readErr = readPHOILightInfo(reader)
-		case 3:
-			readErr = readPHOIFolderInfo(reader, version, lstChara)
-		default:
-		}
-
-		if readErr != nil {
-			err = readErr
-			return
-		}
-	}
+	data, err = reader.ReadBytes(size)
 	return
 }
 
-func readPHCharFileStatus(reader *bbio.Reader, version int) (name string, err error) {
-	reader.ReadBytes(4) // coordinateType
-
-	countAccessory, _ := reader.ReadInt32()
-	reader.ReadBytes(int(countAccessory))
-
-	// eyesPtn, eyesOpen, eyesOpenMin, eyesOpenMax, eyesFixed
-	// mouthPtn, mouthOpen, mouthOpenMin, mouthOpenMax, mouthFixed
-	// tongueState, eyesLookPtn, eyesTargetNo, eyesTargetRate
-	// neckLookPtn, neckTargetNo, neckTargetRate, eyesBlink, disableShapeMouth
-	reader.ReadBytes(67)
+// putPHColorMain writes the mainColor only layout of versions before 4
+func putPHColorMain(buf *bbio.Buffer, data []byte) {
+	if data == nil {
+		buf.PutFloatAll(1.0, 1.0, 1.0, 1.0)
+		return
+	}
+	buf.Write(data[:16])
+}
 
-	countClothesState, _ := reader.ReadInt32()
-	reader.ReadBytes(int(countClothesState))
+// putPHColor writes a PBR1, Alloy or EyeHighlight color in version, they
+// only lose everything but mainColor before version 4
+func putPHColor(buf *bbio.Buffer, colorType int32, data []byte, version int32) {
+	if version < 4 {
+		putPHColorMain(buf, data)
+		return
+	}
+	buf.PutInt(colorType)
+	buf.Write(data)
+}
 
-	countSiruLv, _ := reader.ReadInt32()
-	reader.ReadBytes(int(countSiruLv))
+func writePHColorHair(reader *bbio.Reader, buf *bbio.Buffer, version int32) (err error) {
+	// colorType
+	err = skipPHBytes(reader, 4)
+	if err != nil {
+		return
+	}
 
-	// nipStand, hohoAkaRate, tearsLv
-	// disableShapeBustL, disableShapeBustR, disableShapeNipL
-	// disableShapeNipR, hideEyesHighlight
-	reader.ReadBytes(17)
+	// mainColor, cuticleColor, cuticleExp, fresnelColor, fresnelExp
+	data, dErr := reader.ReadBytes(56)
+	if dErr != nil {
+		err = dErr
+		return
+	}
 
-	name = ""
-	if version >= 14 {
-		name, _ = reader.ReadString()
+	if version < 4 {
+		putPHColorMain(buf, data)
+	} else {
+		buf.PutInt(1)
+		buf.Write(data)
 	}
 	return
 }
 
-func readPHObjectInfo(reader *bbio.Reader, other bool) (err error) {
-	reader.ReadBytes(4) // dicKey
-	reader.ReadString() // ChangeAmount.pos
-	reader.ReadString() // ChangeAmount.rot
-	reader.ReadString() // ChangeAmount.scale
-	if other {
-		// treeState, visible
-		reader.ReadBytes(5)
+func writePHColorSimple(reader *bbio.Reader, buf *bbio.Buffer, version int32, size int) (err error) {
+	colorType, data, cErr := readPHColor10(reader, size)
+	if cErr != nil {
+		err = cErr
+		return
 	}
+	putPHColor(buf, colorType, data, version)
 	return
 }
 
-func readPHOICharInfo(reader *bbio.Reader, version int, lstChara map[int]PHCharaCard) (err error) {
-	err = readPHObjectInfo(reader, true)
-	if err != nil {
+func writePHColorPBR1(reader *bbio.Reader, buf *bbio.Buffer, version int32) error {
+	// mainColor1, specColor1, specular1, smooth1
+	return writePHColorSimple(reader, buf, version, 40)
+}
+
+func writePHColorAlloy(reader *bbio.Reader, buf *bbio.Buffer, version int32) error {
+	// mainColor, metallic, smooth
+	return writePHColorSimple(reader, buf, version, 24)
+}
+
+func writePHColorEyeHighlight(reader *bbio.Reader, buf *bbio.Buffer, version int32) error {
+	// mainColor1, specColor1, specular1, smooth1
+	return writePHColorSimple(reader, buf, version, 40)
+}
+
+func writePHColorPBR2(reader *bbio.Reader, buf *bbio.Buffer, version int32) (err error) {
+	// mainColor1, specColor1, specular1, smooth1, mainColor2, specColor2,
+	// specular2, smooth2
+	colorType, data, cErr := readPHColor10(reader, 80)
+	if cErr != nil {
+		err = cErr
 		return
 	}
 
-	sex, sexErr := reader.ReadInt32()
-	if sexErr != nil {
-		err = sexErr
+	if version >= 5 || version < 4 || data == nil {
+		putPHColor(buf, colorType, data, version)
 		return
 	}
 
-	// CustomParameter
-	card, cErr := readPHCustomParameter(reader)
+	// no specular2
+	buf.PutInt(colorType)
+	buf.Write(data[:72])
+	buf.Write(data[76:])
+	return
+}
+
+func writePHColorAlloyHSVOffset(reader *bbio.Reader, buf *bbio.Buffer, version int32) (err error) {
+	// offset_h, offset_s, offset_v, alpha, metallic, smooth
+	colorType, data, cErr := readPHColor10(reader, 24)
 	if cErr != nil {
 		err = cErr
 		return
 	}
-	card.sceneSex = sex
 
-	// CharFileStatus
-	name, cfsErr := readPHCharFileStatus(reader, version)
-	if cfsErr != nil {
-		err = cfsErr
+	if version < 4 {
+		// the old color is not read back
+		buf.PutFloatAll(1.0, 1.0, 1.0, 1.0)
 		return
 	}
-	card.name = name
-
-	idx := len(lstChara)
-	lstChara[idx] = card
 
-	// bones
-	countBones, _ := reader.ReadInt32()
-	for i := 0; i < int(countBones); i++ {
-		reader.ReadBytes(4)
-		readPHObjectInfo(reader, false)
+	buf.PutInt(colorType)
+	if data == nil {
+		return
 	}
 
-	// IkTarget
-	countIkTarget, _ := reader.ReadInt32()
-	for i := 0; i < int(countIkTarget); i++ {
-		reader.ReadBytes(4)
-		readPHObjectInfo(reader, false)
+	switch {
+	case version < 6:
+		buf.PutFloatAll(1.0, 1.0, 1.0, 1.0)
+	case version == 6:
+		buf.Write(data[:12])
+	case version == 7:
+		buf.Write(data[:12])
+		buf.WriteByte(0)
+		buf.Write(data[12:16])
+	default:
+		buf.Write(data[:16])
 	}
 
-	// child
-	countChild, _ := reader.ReadInt32()
-	for i := 0; i < int(countChild); i++ {
-		reader.ReadBytes(4)
-		readPHChild(reader, version, lstChara)
-	}
+	// metallic, smooth
+	buf.Write(data[16:])
+	return
+}
 
-	// kinematicMode, animeInfo.group, animeInfo.category, animeInfo.no
-	// handPtnL, handPtnR, skinRate nipple, siru
-	reader.ReadBytes(37)
+func writePHHair(reader *bbio.Reader, version int32) (b []byte, err error) {
+	buf := bbio.NewBuffer()
 
-	if version >= 12 {
-		// faceOption
-		reader.ReadBytes(4)
+	partsCount, pcErr := readPHCount(reader, 4)
+	if pcErr != nil {
+		err = pcErr
+		return
 	}
+	buf.PutInt(int32(partsCount))
 
-	// mouthOpen, lipSync
-	reader.ReadBytes(5)
+	for i := 0; i < partsCount; i++ {
+		// hairPartID
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
 
-	// lookAtTarget
-	readPHObjectInfo(reader, false)
+		// hairColor
+		err = writePHColorHair(reader, buf, version)
+		if err != nil {
+			return
+		}
 
-	// enableIK, activeIK, enableFK, activeFK
-	// expression, animeSpeed
-	reader.ReadBytes(22)
+		// acceColor
+		acceBuf := bbio.NewBuffer()
+		err = writePHColorPBR1(reader, acceBuf, version)
+		if err != nil {
+			return
+		}
+		if version > 0 {
+			buf.Write(acceBuf.Bytes())
+		}
+	}
+
+	b = buf.Bytes()
+	return
+}
+
+func writePHHead(reader *bbio.Reader, version int32, sex int32) (b []byte, err error) {
+	buf := bbio.NewBuffer()
+
+	// headID, faceTexID, detailID, detailWeight, eyeBrowID
+	err = copyPHBytes(reader, buf, 20)
+	if err != nil {
+		return
+	}
+
+	// eyeBrowColor
+	err = writePHColorPBR1(reader, buf, version)
+	if err != nil {
+		return
+	}
+
+	// eyeID, eyeScleraColor, eyeIrisColor, eyePupilDilation, eyeEmissive
+	eyes := make([][]byte, 2)
+	for i := range eyes {
+		eyes[i], err = reader.ReadBytes(44)
+		if err != nil {
+			return
+		}
+	}
+
+	if version < 4 {
+		// eyeScleraColor, shared by both eyes
+		buf.Write(eyes[0][4:20])
+		for _, eye := range eyes {
+			// eyeID, eyeIrisColor
+			buf.Write(eye[:4])
+			buf.Write(eye[20:36])
+		}
+
+	} else {
+		for _, eye := range eyes {
+			if version >= 10 {
+				buf.Write(eye)
+			} else {
+				// no eyeEmissive
+				buf.Write(eye[:40])
+			}
+		}
+	}
+
+	// tattooID, tattooColor
+	err = copyPHBytes(reader, buf, 20)
+	if err != nil {
+		return
+	}
+
+	// shapeVals
+	shapeCount, scErr := readPHCount(reader, 4)
+	if scErr != nil {
+		err = scErr
+		return
+	}
+	buf.PutInt(int32(shapeCount))
+	err = copyPHBytes(reader, buf, shapeCount*4)
+	if err != nil {
+		return
+	}
+
+	if sex == phSexFemale {
+		// eyeLash
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
+		err = writePHColorPBR1(reader, buf, version)
+		if err != nil {
+			return
+		}
+
+		// eyeshadow, cheek, lip, mole
+		err = copyPHBytes(reader, buf, 80)
+		if err != nil {
+			return
+		}
+
+		// eyeHighlight
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
+		err = writePHColorEyeHighlight(reader, buf, version)
+		if err != nil {
+			return
+		}
+
+	} else {
+		// beard
+		err = copyPHBytes(reader, buf, 20)
+		if err != nil {
+			return
+		}
+
+		// eyeHighlightColor
+		hlBuf := bbio.NewBuffer()
+		err = writePHColorEyeHighlight(reader, hlBuf, version)
+		if err != nil {
+			return
+		}
+		if version >= 2 {
+			buf.Write(hlBuf.Bytes())
+		}
+	}
+
+	b = buf.Bytes()
+	return
+}
+
+func writePHBody(reader *bbio.Reader, version int32, sex int32) (b []byte, err error) {
+	buf := bbio.NewBuffer()
+
+	// bodyID
+	err = copyPHBytes(reader, buf, 4)
+	if err != nil {
+		return
+	}
+
+	// skinColor
+	err = writePHColorAlloyHSVOffset(reader, buf, version)
+	if err != nil {
+		return
+	}
+
+	// detailID, detailWeight, underhairID
+	err = copyPHBytes(reader, buf, 12)
+	if err != nil {
+		return
+	}
+
+	// underhairColor
+	err = writePHColorAlloy(reader, buf, version)
+	if err != nil {
+		return
+	}
+
+	// tattooID, tattooColor
+	err = copyPHBytes(reader, buf, 20)
+	if err != nil {
+		return
+	}
+
+	// shapeVals
+	shapeCount, shErr := readPHCount(reader, 4)
+	if shErr != nil {
+		err = shErr
+		return
+	}
+	buf.PutInt(int32(shapeCount))
+	err = copyPHBytes(reader, buf, shapeCount*4)
+	if err != nil {
+		return
+	}
+
+	if sex == phSexFemale {
+		// nipID
+		err = copyPHBytes(reader, buf, 4)
+		if err != nil {
+			return
+		}
+
+		// nipColor
+		err = writePHColorAlloyHSVOffset(reader, buf, version)
+		if err != nil {
+			return
+		}
+
+		// sunburnID, sunburnColor
+		err = copyPHBytes(reader, buf, 20)
+		if err != nil {
+			return
+		}
+
+		// nailColor, manicureColor, areolaSize, bustSoftness, bustWeight
+		nailBuf := bbio.NewBuffer()
+		err = writePHColorAlloyHSVOffset(reader, nailBuf, version)
+		if err != nil {
+			return
+		}
+		maniBuf := bbio.NewBuffer()
+		err = writePHColorPBR1(reader, maniBuf, version)
+		if err != nil {
+			return
+		}
+		bust, bErr := reader.ReadBytes(12)
+		if bErr != nil {
+			err = bErr
+			return
+		}
+
+		if version >= 3 {
+			buf.Write(nailBuf.Bytes())
+			if version >= 9 {
+				buf.Write(maniBuf.Bytes())
+			}
+			buf.Write(bust)
+		}
+	}
+
+	b = buf.Bytes()
+	return
+}
+
+func writePHWear(reader *bbio.Reader, version int32, sex int32) (b []byte, err error) {
+	buf := bbio.NewBuffer()
+
+	for i := 0; i < 11; i++ {
+		// WEAR_TYPE, id
+		err = copyPHBytes(reader, buf, 8)
+		if err != nil {
+			return
+		}
+
+		// color
+		err = writePHColorPBR2(reader, buf, version)
+		if err != nil {
+			return
+		}
+	}
+
+	if sex == phSexFemale {
+		// isSwimwear, swimOptTop, swimOptBtm
+		err = copyPHBytes(reader, buf, 3)
+		if err != nil {
+			return
+		}
+	}
+
+	b = buf.Bytes()
+	return
+}
+
+func writePHAccessory(reader *bbio.Reader, version int32) (b []byte, err error) {
+	buf := bbio.NewBuffer()
+
+	for i := 0; i < 10; i++ {
+		// ACCESSORY_TYPE, id, nowAttach, addPos, addRot addScl
+		err = copyPHBytes(reader, buf, 48)
+		if err != nil {
+			return
+		}
+
+		// color
+		err = writePHColorPBR2(reader, buf, version)
+		if err != nil {
+			return
+		}
+	}
+
+	b = buf.Bytes()
+	return
+}
+
+// writePHCustomParameter converts the version 10 sections of a chara back
+// to version, values the older version has no room for are dropped
+func writePHCustomParameter(card PHCharaCard, version int32) (b []byte, err error) {
+	buf := bbio.NewBuffer()
+	buf.PutInt(version)
+	buf.PutInt(card.sex)
+
+	if version == phLatestVersion {
+		for _, section := range [][]byte{card.hair, card.head, card.body, card.wear, card.accessory} {
+			buf.Write(section)
+		}
+		b = buf.Bytes()
+		return
+	}
+
+	hair, haErr := writePHHair(bbio.NewReaderBytes(card.hair), version)
+	if haErr != nil {
+		err = haErr
+		return
+	}
+	buf.Write(hair)
+
+	head, heErr := writePHHead(bbio.NewReaderBytes(card.head), version, card.sex)
+	if heErr != nil {
+		err = heErr
+		return
+	}
+	buf.Write(head)
+
+	body, bErr := writePHBody(bbio.NewReaderBytes(card.body), version, card.sex)
+	if bErr != nil {
+		err = bErr
+		return
+	}
+	buf.Write(body)
+
+	wear, wErr := writePHWear(bbio.NewReaderBytes(card.wear), version, card.sex)
+	if wErr != nil {
+		err = wErr
+		return
+	}
+	buf.Write(wear)
+
+	accessory, aErr := writePHAccessory(bbio.NewReaderBytes(card.accessory), version)
+	if aErr != nil {
+		err = aErr
+		return
+	}
+	buf.Write(accessory)
+
+	b = buf.Bytes()
+	return
+}
+
+func readPHChild(reader *bbio.Reader, version int, depth int, lstChara map[int]PHCharaCard) (err error) {
+	if depth > readLimits.MaxDepth {
+		err = fmt.Errorf("Scene objects nested deeper than %d", readLimits.MaxDepth)
+		return
+	}
+
+	// type, ObjectInfo
+	chCount, ccErr := readPHCount(reader, 8)
+	if ccErr != nil {
+		err = ccErr
+		return
+	}
+	for i := 0; i < chCount; i++ {
+		err = readPHObject(reader, version, depth, lstChara)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func readPHObject(reader *bbio.Reader, version int, depth int, lstChara map[int]PHCharaCard) (err error) {
+	iType, itErr := reader.ReadInt32()
+	if itErr != nil {
+		err = itErr
+		return
+	}
+	switch iType {
+	case 0:
+		err = readPHOICharInfo(reader, version, depth, lstChara)
+	case 1:
+		err = readPHOIItemInfo(reader, version, depth, lstChara)
+	case 2:
+		err = readPHOILightInfo(reader)
+	case 3:
+		err = readPHOIFolderInfo(reader, version, depth, lstChara)
+	default:
+		err = fmt.Errorf("Unknown scene object type %d", iType)
+	}
+	return
+}
+
+func readPHCharFileStatus(reader *bbio.Reader, version int) (name string, err error) {
+	err = skipPHBytes(reader, 4) // coordinateType
+	if err != nil {
+		return
+	}
+
+	countAccessory, caErr := readPHCount(reader, 1)
+	if caErr != nil {
+		err = caErr
+		return
+	}
+	err = skipPHBytes(reader, countAccessory)
+	if err != nil {
+		return
+	}
+
+	// eyesPtn, eyesOpen, eyesOpenMin, eyesOpenMax, eyesFixed
+	// mouthPtn, mouthOpen, mouthOpenMin, mouthOpenMax, mouthFixed
+	// tongueState, eyesLookPtn, eyesTargetNo, eyesTargetRate
+	// neckLookPtn, neckTargetNo, neckTargetRate, eyesBlink, disableShapeMouth
+	err = skipPHBytes(reader, 67)
+	if err != nil {
+		return
+	}
+
+	countClothesState, csErr := readPHCount(reader, 1)
+	if csErr != nil {
+		err = csErr
+		return
+	}
+	err = skipPHBytes(reader, countClothesState)
+	if err != nil {
+		return
+	}
+
+	countSiruLv, slErr := readPHCount(reader, 1)
+	if slErr != nil {
+		err = slErr
+		return
+	}
+	err = skipPHBytes(reader, countSiruLv)
+	if err != nil {
+		return
+	}
+
+	// nipStand, hohoAkaRate, tearsLv
+	// disableShapeBustL, disableShapeBustR, disableShapeNipL
+	// disableShapeNipR, hideEyesHighlight
+	err = skipPHBytes(reader, 17)
+	if err != nil {
+		return
+	}
+
+	name = ""
+	if version >= 14 {
+		name, err = reader.ReadString()
+	}
+	return
+}
+
+func readPHObjectInfo(reader *bbio.Reader, other bool) (err error) {
+	err = skipPHBytes(reader, 4) // dicKey
+	if err != nil {
+		return
+	}
+
+	// ChangeAmount.pos, ChangeAmount.rot, ChangeAmount.scale
+	for i := 0; i < 3; i++ {
+		_, err = reader.ReadString()
+		if err != nil {
+			return
+		}
+	}
+
+	if other {
+		// treeState, visible
+		err = skipPHBytes(reader, 5)
+	}
+	return
+}
+
+func readPHOICharInfo(reader *bbio.Reader, version int, depth int, lstChara map[int]PHCharaCard) (err error) {
+	err = readPHObjectInfo(reader, true)
+	if err != nil {
+		return
+	}
+
+	sex, sexErr := reader.ReadInt32()
+	if sexErr != nil {
+		err = sexErr
+		return
+	}
+
+	// CustomParameter
+	card, cErr := readPHCustomParameter(reader)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	card.sceneSex = sex
+
+	sexInfo, sexErr := phSexByCustom(card.sex)
+	if sexErr != nil {
+		err = sexErr
+		return
+	}
+	if sexInfo.scene != sex {
+		printWarning(fmt.Errorf("PlayHome chara sex %d does not match scene sex %d", card.sex, sex))
+	}
+
+	// CharFileStatus
+	name, cfsErr := readPHCharFileStatus(reader, version)
+	if cfsErr != nil {
+		err = cfsErr
+		return
+	}
+	card.name = name
+
+	err = checkCharaCount(len(lstChara))
+	if err != nil {
+		return
+	}
+	idx := len(lstChara)
+	lstChara[idx] = card
+
+	// bones, IkTarget
+	for j := 0; j < 2; j++ {
+		countBones, cbErr := readPHCount(reader, 4)
+		if cbErr != nil {
+			err = cbErr
+			return
+		}
+		for i := 0; i < countBones; i++ {
+			err = skipPHBytes(reader, 4)
+			if err != nil {
+				return
+			}
+			err = readPHObjectInfo(reader, false)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	// child
+	countChild, ccErr := readPHCount(reader, 4)
+	if ccErr != nil {
+		err = ccErr
+		return
+	}
+	for i := 0; i < countChild; i++ {
+		err = skipPHBytes(reader, 4)
+		if err != nil {
+			return
+		}
+		err = readPHChild(reader, version, depth+1, lstChara)
+		if err != nil {
+			return
+		}
+	}
+
+	// kinematicMode, animeInfo.group, animeInfo.category, animeInfo.no
+	// handPtnL, handPtnR, skinRate nipple, siru
+	err = skipPHBytes(reader, 37)
+	if err != nil {
+		return
+	}
+
+	if version >= 12 {
+		// faceOption
+		err = skipPHBytes(reader, 4)
+		if err != nil {
+			return
+		}
+	}
+
+	// mouthOpen, lipSync
+	err = skipPHBytes(reader, 5)
+	if err != nil {
+		return
+	}
+
+	// lookAtTarget
+	err = readPHObjectInfo(reader, false)
+	if err != nil {
+		return
+	}
+
+	// enableIK, activeIK, enableFK, activeFK
+	// expression, animeSpeed
+	err = skipPHBytes(reader, 22)
+	if err != nil {
+		return
+	}
 
 	if version < 12 {
 		// animePattern[0]
-		reader.ReadSingle()
+		err = skipPHBytes(reader, 4)
 	} else {
 		// animePattern[0], animePattern[1]
-		reader.ReadBytes(8)
+		err = skipPHBytes(reader, 8)
+	}
+	if err != nil {
+		return
 	}
 
 	// animeOptionVisible, isAnimeForceLoop
-	reader.ReadBytes(2)
+	err = skipPHBytes(reader, 2)
+	if err != nil {
+		return
+	}
 
-	// voice
-	voiceCount, _ := reader.ReadInt32()
-	for i := 0; i < int(voiceCount); i++ {
-		// group, category, no
-		reader.ReadBytes(12)
+	// voice: group, category, no
+	voiceCount, vcErr := readPHCount(reader, 12)
+	if vcErr != nil {
+		err = vcErr
+		return
 	}
 	// repeat
-	reader.ReadBytes(4)
+	err = skipPHBytes(reader, voiceCount*12+4)
+	if err != nil {
+		return
+	}
 
-	if sex == 0 {
+	if sex == phSceneSexMale {
 		// visibleSimple
-		reader.ReadBoolean()
+		err = skipPHBytes(reader, 1)
+		if err != nil {
+			return
+		}
 		// simpleColor
-		reader.ReadString()
+		_, err = reader.ReadString()
+		if err != nil {
+			return
+		}
 		// visibleSon, animeOptionParam[0], animeOptionParam[1]
-		reader.ReadBytes(9)
+		err = skipPHBytes(reader, 9)
+		if err != nil {
+			return
+		}
 	}
 
-	// nectState
-	countNeckByte, _ := reader.ReadInt32()
-	reader.ReadBytes(int(countNeckByte))
-
-	// eyesState
-	countEyesByte, _ := reader.ReadInt32()
-	reader.ReadBytes(int(countEyesByte))
+	// nectState, eyesState
+	for j := 0; j < 2; j++ {
+		countByte, cbErr := readPHCount(reader, 1)
+		if cbErr != nil {
+			err = cbErr
+			return
+		}
+		err = skipPHBytes(reader, countByte)
+		if err != nil {
+			return
+		}
+	}
 
 	// animeNormalizedTime
-	reader.ReadBytes(4)
-
-	// AccessGroup state
-	countAccessGroup, _ := reader.ReadInt32()
-	for i := 0; i < int(countAccessGroup); i++ {
-		// key, TreeState
-		reader.ReadBytes(8)
+	err = skipPHBytes(reader, 4)
+	if err != nil {
+		return
 	}
 
-	// AccessNo state
-	countAccessNo, _ := reader.ReadInt32()
-	for i := 0; i < int(countAccessNo); i++ {
-		// key, TreeState
-		reader.ReadBytes(8)
+	// AccessGroup state, AccessNo state: key, TreeState
+	for j := 0; j < 2; j++ {
+		countAccess, caErr := readPHCount(reader, 8)
+		if caErr != nil {
+			err = caErr
+			return
+		}
+		err = skipPHBytes(reader, countAccess*8)
+		if err != nil {
+			return
+		}
 	}
 
 	return
 }
 
-func readPHOIItemInfo(reader *bbio.Reader, version int, lstChara map[int]PHCharaCard) (err error) {
+func readPHOIItemInfo(reader *bbio.Reader, version int, depth int, lstChara map[int]PHCharaCard) (err error) {
 	err = readPHObjectInfo(reader, true)
 	if err != nil {
 		return
 	}
 
 	// no, animeSpeed, colortype, color, color2, enableFK
-	reader.ReadBytes(157)
+	err = skipPHBytes(reader, 157)
+	if err != nil {
+		return
+	}
 
 	// bones
-	cBone, err := reader.ReadInt32()
-	for i := 0; i < int(cBone); i++ {
-		reader.ReadString()
+	cBone, cbErr := readPHCount(reader, 4)
+	if cbErr != nil {
+		err = cbErr
+		return
+	}
+	for i := 0; i < cBone; i++ {
+		_, err = reader.ReadString()
+		if err != nil {
+			return
+		}
 		err = readPHObjectInfo(reader, false)
+		if err != nil {
+			return
+		}
 	}
 
 	// animeNormalizedTime
-	reader.ReadBytes(4)
-	err = readPHChild(reader, version, lstChara)
+	err = skipPHBytes(reader, 4)
+	if err != nil {
+		return
+	}
+	err = readPHChild(reader, version, depth+1, lstChara)
 	return
 }
 
@@ -851,25 +1738,28 @@ func readPHOILightInfo(reader *bbio.Reader) (err error) {
 		return
 	}
 	// no, color, intensity, range, spotAngle, shadow, enable, drawTarget
-	reader.ReadBytes(35)
+	err = skipPHBytes(reader, 35)
 	return
 }
 
-func readPHOIFolderInfo(reader *bbio.Reader, version int, lstChara map[int]PHCharaCard) (err error) {
+func readPHOIFolderInfo(reader *bbio.Reader, version int, depth int, lstChara map[int]PHCharaCard) (err error) {
 	err = readPHObjectInfo(reader, true)
 	if err != nil {
 		return
 	}
 	// name
-	reader.ReadString()
-	err = readPHChild(reader, version, lstChara)
+	_, err = reader.ReadString()
+	if err != nil {
+		return
+	}
+	err = readPHChild(reader, version, depth+1, lstChara)
 	return
 }
 
 // NewPHChara implements for PHChara
 func NewPHChara() *PHChara {
 	c := &PHSceneCard{}
-	return &PHChara{card: c}
+	return &PHChara{card: c, version: phLatestVersion}
 }
 
 // IsPHStudioSceneCard implements for PH studio scene
@@ -877,6 +1767,12 @@ func IsPHStudioSceneCard(reader *bbio.Reader) bool {
 	return (reader.Index([]byte(phStudioMark)) > 0)
 }
 
+// IsPHCharaCard implements for standalone PH chara card
+func IsPHCharaCard(reader *bbio.Reader, pngSize int64) bool {
+	_, err := phSexByMarker(readCardMark(reader, pngSize, 0))
+	return err == nil
+}
+
 // GenerateFileName implements for PHChara
 func (sf *PHChara) GenerateFileName(name string) string {
 	return name + ".png"
@@ -884,6 +1780,8 @@ func (sf *PHChara) GenerateFileName(name string) string {
 
 // ReadScene implements for PHChara
 func (sf *PHChara) ReadScene(reader *bbio.Reader, pngSize int64) (re bool, err error) {
+	defer recoverParse(&err)
+
 	_, seekErr := reader.Seek(pngSize, io.SeekStart)
 	if seekErr != nil {
 		err = seekErr
@@ -908,7 +1806,8 @@ func (sf *PHChara) ReadScene(reader *bbio.Reader, pngSize int64) (re bool, err e
 	}
 	verInt := int(iVer)
 
-	iCount, icErr := reader.ReadInt32()
+	// key, type, ObjectInfo
+	iCount, icErr := readPHCount(reader, 12)
 	if icErr != nil {
 		err = icErr
 		return
@@ -916,29 +1815,14 @@ func (sf *PHChara) ReadScene(reader *bbio.Reader, pngSize int64) (re bool, err e
 
 	lstChara := make(map[int]PHCharaCard)
 
-	var readErr error
-	for i := 0; i < int(iCount); i++ {
-		reader.ReadInt32()
-
-		iType, itErr := reader.ReadInt32()
-		if itErr != nil {
-			err = itErr
+	for i := 0; i < iCount; i++ {
+		err = skipPHBytes(reader, 4) // key
+		if err != nil {
 			return
 		}
-		switch iType {
-		case 0:
-			readErr = readPHOICharInfo(reader, verInt, lstChara)
-		case 1:
-			readErr = readPHOIItemInfo(reader, verInt, lstChara)
-		case 2:
-			readErr = readPHOILightInfo(reader)
-		case 3:
-			readErr = readPHOIFolderInfo(reader, verInt, lstChara)
-		default:
-		}
 
-		if readErr != nil {
-			err = readErr
+		err = readPHObject(reader, verInt, 0, lstChara)
+		if err != nil {
 			return
 		}
 	}
@@ -973,19 +1857,56 @@ func (sf *PHChara) ReadScene(reader *bbio.Reader, pngSize int64) (re bool, err e
 	return
 }
 
-// WriteChara implements for PHChara
-func (sf *PHChara) WriteChara(card PHCharaCard, w io.Writer) (re bool, err error) {
-	re = false
-	writer := bbio.NewWriter(w)
+// ReadCard implements for PHChara, reads a standalone chara card
+func (sf *PHChara) ReadCard(reader *bbio.Reader, pngSize int64) (re bool, err error) {
+	defer recoverParse(&err)
 
-	var sex int
-	if card.sex == 0 {
-		sex = 1
-	} else {
-		sex = 0
+	_, seekErr := reader.Seek(pngSize, io.SeekStart)
+	if seekErr != nil {
+		err = seekErr
+		return
+	}
+
+	sf.card.pngSize = pngSize
+	sf.card.charaCards = make(map[string]PHCharaCard)
+
+	mark, markErr := reader.ReadString()
+	if markErr != nil {
+		err = markErr
+		return
+	}
+	sexInfo, sexErr := phSexByMarker(mark)
+	if sexErr != nil {
+		err = sexErr
+		return
+	}
+
+	chara, cErr := readPHCustomParameter(reader)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+	if chara.sex != sexInfo.custom {
+		printWarning(fmt.Errorf("PlayHome chara sex %d does not match card mark %s", chara.sex, mark))
+	}
+	chara.sceneSex = sexInfo.scene
+	chara.pngData = rawRange(reader, 0, pngSize)
+
+	name := strings.ReplaceAll(time.Now().Format("2006.01.02.15.04.05.000"), ".", "")
+	sf.card.charaCards[name] = chara
+
+	re = true
+	return
+}
+
+func (sf *PHChara) writeCharaHeader(card PHCharaCard, writer *bbio.Writer) (err error) {
+	sexInfo, sexErr := phSexByCustom(card.sex)
+	if sexErr != nil {
+		err = sexErr
+		return
 	}
 
-	pngBytes, pngErr := createPng(252, 352, sex)
+	pngBytes, pngErr := renderThumb(sf.thumb, sf.meta, card.pngData, ThumbInfo{game: gamePH, sex: sexInfo.sex, name: card.name})
 	if pngErr != nil {
 		err = pngErr
 		return
@@ -997,19 +1918,69 @@ func (sf *PHChara) WriteChara(card PHCharaCard, w io.Writer) (re bool, err error
 		return
 	}
 
-	if card.sex == 0 {
-		writer.WriteString(phCharaFemaleMark)
-	} else {
-		writer.WriteString(phCharaMaleMark)
+	_, err = writer.WriteString(sexInfo.marker)
+	return
+}
+
+// WriteChara implements for PHChara, converts the chara to the version of
+// the handler
+func (sf *PHChara) WriteChara(card PHCharaCard, w io.Writer) (re bool, err error) {
+	re = false
+	writer := bbio.NewWriter(w)
+
+	version := sf.version
+	if version == phVersionSame {
+		version = card.version
+	}
+	custom, cErr := writePHCustomParameter(card, version)
+	if cErr != nil {
+		err = cErr
+		return
 	}
 
-	writer.WriteInt(10)
-	writer.WriteInt(card.sex)
-	writer.Write(card.hair)
-	writer.Write(card.head)
-	writer.Write(card.body)
-	writer.Write(card.wear)
-	writer.Write(card.accessory)
+	hErr := sf.writeCharaHeader(card, writer)
+	if hErr != nil {
+		err = hErr
+		return
+	}
+
+	_, wErr := writer.Write(custom)
+	if wErr != nil {
+		err = wErr
+		return
+	}
+
+	fluErr := writer.Flush()
+	if fluErr != nil {
+		err = fluErr
+		return
+	}
+
+	re = true
+	return
+}
+
+// WriteCharaRaw implements for PHChara, keeps the source version payload
+func (sf *PHChara) WriteCharaRaw(card PHCharaCard, w io.Writer) (re bool, err error) {
+	re = false
+	if card.rawData == nil {
+		err = errors.New("Raw chara data not available")
+		return
+	}
+
+	writer := bbio.NewWriter(w)
+
+	hErr := sf.writeCharaHeader(card, writer)
+	if hErr != nil {
+		err = hErr
+		return
+	}
+
+	_, rwErr := writer.Write(card.rawData)
+	if rwErr != nil {
+		err = rwErr
+		return
+	}
 
 	fluErr := writer.Flush()
 	if fluErr != nil {
@@ -1022,7 +1993,7 @@ func (sf *PHChara) WriteChara(card PHCharaCard, w io.Writer) (re bool, err error
 }
 
 // WriteCharaFile implements for PHChara
-func (sf *PHChara) WriteCharaFile(card PHCharaCard, filePath string) (re bool, err error) {
+func (sf *PHChara) WriteCharaFile(card PHCharaCard, filePath string, opts ExtractOptions) (re bool, err error) {
 	re = false
 	f, cErr := os.Create(filePath)
 	if cErr != nil {
@@ -1032,21 +2003,40 @@ func (sf *PHChara) WriteCharaFile(card PHCharaCard, filePath string) (re bool, e
 	defer f.Close()
 
 	writer := bufio.NewWriter(f)
+
+	// no conversion needed, keep the original payload
+	if opts.raw || sf.version == phVersionSame || card.version == sf.version {
+		return sf.WriteCharaRaw(card, writer)
+	}
 	return sf.WriteChara(card, writer)
 }
 
 // ExtractChara implements for PHChara
-func (sf *PHChara) ExtractChara(currDir string, flag int) (total int, write int, err error) {
+func (sf *PHChara) ExtractChara(currDir string, opts ExtractOptions, report *ExtractReport) (err error) {
+	if opts.phVersion != "" {
+		version, vErr := parsePHVersion(opts.phVersion)
+		if vErr != nil {
+			err = vErr
+			return
+		}
+		sf.version = version
+	}
+	sf.thumb = opts.thumb
+	sf.meta = opts.cardMeta
+
 	for k, v := range sf.card.charaCards {
-		total++
+		if opts.skipGame(gamePH) {
+			continue
+		}
+		report.found(gamePH)
 
-		// Not male
-		if flag == 1 && v.sex != 0 {
+		sexInfo, sexErr := phSexByCustom(v.sex)
+		if sexErr != nil {
+			printError(sexErr)
 			continue
 		}
 
-		// Not female
-		if flag == 2 && v.sex != 1 {
+		if opts.skipSex(sexInfo.sex) {
 			continue
 		}
 
@@ -1063,11 +2053,11 @@ func (sf *PHChara) ExtractChara(currDir string, flag int) (total int, write int,
 			saveFilePath = path.Join(currDir, fmt.Sprintf("%s-%d.png", k, c))
 		}
 
-		_, saveErr := sf.WriteCharaFile(v, saveFilePath)
+		_, saveErr := sf.WriteCharaFile(v, saveFilePath, opts)
 		if saveErr != nil {
 			printError(saveErr)
 		} else {
-			write++
+			report.wrote(gamePH)
 		}
 	}
 	return
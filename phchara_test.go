@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/sulfur/bbio"
+)
+
+// testPHRead reads the single chara of a written PH card
+func testPHRead(t testing.TB, b []byte) PHCharaCard {
+	h := NewPHChara()
+	reader := bbio.NewReaderBytes(b)
+	if _, err := h.ReadCard(reader, getPngSize(reader)); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.card.charaCards) != 1 {
+		t.Fatalf("read %d charas", len(h.card.charaCards))
+	}
+	for _, card := range h.card.charaCards {
+		return card
+	}
+	return PHCharaCard{}
+}
+
+func TestPHDownConvert(t *testing.T) {
+	for _, sex := range []int32{phSexFemale, phSexMale} {
+		card := testPHCard(t, sex)
+
+		for version := int32(0); version <= phLatestVersion; version++ {
+			h := NewPHChara()
+			h.version = version
+			var b bytes.Buffer
+			if _, err := h.WriteChara(card, &b); err != nil {
+				t.Fatalf("sex %d version %d: %v", sex, version, err)
+			}
+
+			got := testPHRead(t, b.Bytes())
+			if got.version != version || got.sex != sex {
+				t.Fatalf("sex %d version %d: read back as version %d sex %d", sex, version, got.version, got.sex)
+			}
+
+			// a second conversion drops nothing more
+			again, aErr := writePHCustomParameter(got, version)
+			if aErr != nil {
+				t.Fatal(aErr)
+			}
+			if !bytes.Equal(again, got.rawData) {
+				t.Errorf("sex %d version %d: converting the read card again changed it", sex, version)
+			}
+
+			// hair count, part id, colorType then mainColor survive every version
+			if !bytes.Equal(got.hair[:28], card.hair[:28]) {
+				t.Errorf("sex %d version %d: hair main color lost", sex, version)
+			}
+			if version >= 5 && !bytes.Equal(got.wear, card.wear) {
+				t.Errorf("sex %d version %d: wear colors changed", sex, version)
+			}
+			if version >= 9 && !bytes.Equal(got.body, card.body) {
+				t.Errorf("sex %d version %d: body changed", sex, version)
+			}
+			if version == phLatestVersion && !bytes.Equal(got.rawData, testPHCustom(sex)) {
+				t.Errorf("sex %d: version %d written differently", sex, version)
+			}
+		}
+	}
+}
+
+func TestPHOldVersions(t *testing.T) {
+	for _, sex := range []int32{phSexFemale, phSexMale} {
+		for version := int32(0); version <= phLatestVersion; version++ {
+			fixture := testPHCustomVersion(sex, version)
+
+			reader := bbio.NewReaderBytes(fixture)
+			card, err := readPHCustomParameter(reader)
+			if err != nil {
+				t.Fatalf("sex %d version %d: %v", sex, version, err)
+			}
+			if reader.Len() != 0 {
+				t.Errorf("sex %d version %d: %d bytes left unread", sex, version, reader.Len())
+			}
+			if card.version != version || card.sex != sex {
+				t.Fatalf("sex %d version %d: read as version %d sex %d", sex, version, card.version, card.sex)
+			}
+
+			// the writer lays the version out the way the game saved it
+			b, wErr := writePHCustomParameter(card, version)
+			if wErr != nil {
+				t.Fatalf("sex %d version %d: %v", sex, version, wErr)
+			}
+			if !bytes.Equal(b, fixture) {
+				t.Errorf("sex %d version %d: written differently from the fixture", sex, version)
+			}
+
+			// and the written card loads as a whole
+			sexInfo, sErr := phSexByCustom(sex)
+			if sErr != nil {
+				t.Fatal(sErr)
+			}
+			card.sceneSex = sexInfo.scene
+			h := NewPHChara()
+			h.version = phVersionSame
+			var out bytes.Buffer
+			if _, err := h.WriteChara(card, &out); err != nil {
+				t.Fatalf("sex %d version %d: %v", sex, version, err)
+			}
+			if got := testPHRead(t, out.Bytes()); !bytes.Equal(got.rawData, fixture) {
+				t.Errorf("sex %d version %d: card read back differently", sex, version)
+			}
+		}
+	}
+}
+
+func TestPHVersionSame(t *testing.T) {
+	card := testPHCard(t, phSexFemale)
+	h := NewPHChara()
+	h.version = 4
+	var b bytes.Buffer
+	if _, err := h.WriteChara(card, &b); err != nil {
+		t.Fatal(err)
+	}
+	v4 := testPHRead(t, b.Bytes())
+
+	h.version = phVersionSame
+	b.Reset()
+	if _, err := h.WriteChara(v4, &b); err != nil {
+		t.Fatal(err)
+	}
+	if got := testPHRead(t, b.Bytes()); got.version != 4 || !bytes.Equal(got.rawData, v4.rawData) {
+		t.Errorf("same wrote version %d", got.version)
+	}
+}
+
+func TestParsePHVersion(t *testing.T) {
+	tests := []struct {
+		str  string
+		want int32
+		ok   bool
+	}{
+		{"same", phVersionSame, true},
+		{"0", 0, true},
+		{"7", 7, true},
+		{"10", phLatestVersion, true},
+		{"11", 0, false},
+		{"-1", 0, false},
+		{"latest", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parsePHVersion(tt.str)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parsePHVersion(%q) = %d, %v, want %d ok=%v", tt.str, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPHSexTable(t *testing.T) {
+	// the values PlayHome saves, CustomParameter counts female first and
+	// the studio scene male first
+	tests := []struct {
+		marker string
+		custom int32
+		scene  int32
+		sex    int32
+	}{
+		{"【PlayHome_Male】", 1, 0, 0},
+		{"【PlayHome_Female】", 0, 1, 1},
+	}
+	for _, tt := range tests {
+		byMarker, mErr := phSexByMarker(tt.marker)
+		if mErr != nil {
+			t.Fatal(mErr)
+		}
+		byCustom, cErr := phSexByCustom(tt.custom)
+		if cErr != nil {
+			t.Fatal(cErr)
+		}
+		want := phSexInfo{custom: tt.custom, scene: tt.scene, marker: tt.marker, sex: tt.sex}
+		if byMarker != want || byCustom != want {
+			t.Errorf("%s: by marker %+v, by custom %+v, want %+v", tt.marker, byMarker, byCustom, want)
+		}
+	}
+
+	if _, err := phSexByCustom(2); err == nil {
+		t.Error("sex 2 accepted")
+	}
+	if _, err := phSexByMarker(hsCharaFemaleMark); err == nil {
+		t.Error("HS marker accepted")
+	}
+}
+
+func TestPHSexCards(t *testing.T) {
+	tests := []struct {
+		custom int32
+		marker string
+		scene  int32
+		color  color.Color
+	}{
+		{phSexMale, phCharaMaleMark, phSceneSexMale, thumbColorMale},
+		{phSexFemale, phCharaFemaleMark, phSceneSexFemale, thumbColorFemale},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if _, err := NewPHChara().WriteChara(testPHCard(t, tt.custom), &b); err != nil {
+			t.Fatal(err)
+		}
+
+		reader := bbio.NewReaderBytes(b.Bytes())
+		pngSize := getPngSize(reader)
+		if mark := readCardMark(reader, pngSize, 0); mark != tt.marker {
+			t.Errorf("sex %d: marker %s, want %s", tt.custom, mark, tt.marker)
+		}
+
+		got := testPHRead(t, b.Bytes())
+		if got.sex != tt.custom || got.sceneSex != tt.scene {
+			t.Errorf("sex %d: read back sex %d scene %d", tt.custom, got.sex, got.sceneSex)
+		}
+
+		img, iErr := png.Decode(bytes.NewReader(b.Bytes()[:pngSize]))
+		if iErr != nil {
+			t.Fatal(iErr)
+		}
+		r, g, bl, a := img.At(0, 0).RGBA()
+		wr, wg, wb, wa := tt.color.RGBA()
+		if r != wr || g != wg || bl != wb || a != wa {
+			t.Errorf("sex %d: thumbnail color %v, want %v", tt.custom, img.At(0, 0), tt.color)
+		}
+	}
+}
+
+func TestPHSexFilter(t *testing.T) {
+	tests := []struct {
+		flag int
+		want []string
+	}{
+		{0, []string{"female.png", "male.png"}},
+		{1, []string{"male.png"}},
+		{2, []string{"female.png"}},
+	}
+	for _, tt := range tests {
+		h := NewPHChara()
+		h.card.charaCards = map[string]PHCharaCard{
+			"male":   testPHCard(t, phSexMale),
+			"female": testPHCard(t, phSexFemale),
+		}
+
+		dir := t.TempDir()
+		var report ExtractReport
+		if err := h.ExtractChara(dir, ExtractOptions{flag: tt.flag}, &report); err != nil {
+			t.Fatal(err)
+		}
+
+		files, rErr := ioutil.ReadDir(dir)
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		var got []string
+		for _, f := range files {
+			got = append(got, f.Name())
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("flag %d wrote %v, want %v", tt.flag, got, tt.want)
+		}
+	}
+}
+
+func TestPHColorDefaults(t *testing.T) {
+	b, err := readPHColorHair(bbio.NewReaderBytes(make([]byte, 16)), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// colorType, mainColor then the cuticle color old cards don't have
+	want := []float32{0.75, 0.75, 0.75, 1.0, 6.0, 0.75, 0.75, 0.75, 1.0, 0.3}
+	if len(b) != 20+4*len(want) {
+		t.Fatalf("hair color of %d bytes", len(b))
+	}
+	for i, w := range want {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(b[20+4*i:])); got != w {
+			t.Errorf("float %d: %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestPHFemaleLayout(t *testing.T) {
+	fixture := testPHFemaleCustom()
+	reader := bbio.NewReaderBytes(fixture)
+	card, err := readPHCustomParameter(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Len() != 0 || !bytes.Equal(card.rawData, fixture) {
+		t.Fatalf("%d bytes left unread", reader.Len())
+	}
+
+	float := func(b []byte, off int) float32 {
+		return math.Float32frombits(binary.LittleEndian.Uint32(b[off:]))
+	}
+	tests := []struct {
+		name string
+		got  float32
+		want float32
+	}{
+		// count, then 108 bytes a part
+		{"third hairPartID", float32(int32(binary.LittleEndian.Uint32(card.hair[220:]))), 102},
+		// ids, eyeBrowColor, eyeL, eyeID_R, eyeScleraColorR
+		{"eyeIrisColorR blue", float(card.head, 64+44+4+16+8), 0.8},
+		{"eyeEmissiveR", float(card.head, 64+44+40), 0.45},
+		{"bustWeight", float(card.body, len(card.body)-4), 0.65},
+		{"last accessory smooth2", float(card.accessory, len(card.accessory)-4), 0.7},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if swim := card.wear[len(card.wear)-3:]; !bytes.Equal(swim, []byte{1, 1, 0}) {
+		t.Errorf("swimwear flags % x", swim)
+	}
+
+	// the studio and the card marker see a female
+	sexInfo, sErr := phSexByCustom(card.sex)
+	if sErr != nil {
+		t.Fatal(sErr)
+	}
+	if sexInfo.marker != phCharaFemaleMark || sexInfo.scene != 1 {
+		t.Errorf("female read as %+v", sexInfo)
+	}
+	card.sceneSex = sexInfo.scene
+	var b bytes.Buffer
+	if _, err := NewPHChara().WriteChara(card, &b); err != nil {
+		t.Fatal(err)
+	}
+	if got := testPHRead(t, b.Bytes()); !bytes.Equal(got.rawData, fixture) {
+		t.Error("written card read back differently")
+	}
+
+	// version 9 drops the eye emission only
+	v9, vErr := writePHCustomParameter(card, 9)
+	if vErr != nil {
+		t.Fatal(vErr)
+	}
+	if len(v9) != len(fixture)-8 {
+		t.Errorf("version 9 is %d bytes, want %d", len(v9), len(fixture)-8)
+	}
+	old, oErr := readPHCustomParameter(bbio.NewReaderBytes(v9))
+	if oErr != nil {
+		t.Fatal(oErr)
+	}
+	if f := float(old.head, 64+44+40); f != 0.5 {
+		t.Errorf("version 9 eyeEmissiveR = %v, want the 0.5 default", f)
+	}
+	if !bytes.Equal(old.body, card.body) || !bytes.Equal(old.wear, card.wear) {
+		t.Error("version 9 changed body or wear")
+	}
+}
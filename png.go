@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+var pngSignature = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+
+const pngMaxChunkLength = 0x7fffffff
+
+// PngChunk strcture, one chunk of a png file
+type PngChunk struct {
+	name string
+	// offset of the length field in the file
+	pos  int64
+	data []byte
+}
+
+// size is the length of the chunk in the file, length, name and crc included
+func (c *PngChunk) size() int64 {
+	return int64(len(c.data)) + 12
+}
+
+// critical is true for chunks a decoder can not skip, their name starts
+// with an uppercase letter
+func (c *PngChunk) critical() bool {
+	return c.name[0]&0x20 == 0
+}
+
+// readPngChunks walks the chunks of the png at the start of b up to IEND,
+// size is the offset right after the IEND crc
+func readPngChunks(b []byte) (chunks []PngChunk, size int64, err error) {
+	if !bytes.HasPrefix(b, pngSignature) {
+		err = errors.New("Png signature not found")
+		return
+	}
+
+	pos := int64(len(pngSignature))
+	for {
+		if int64(len(b))-pos < 12 {
+			err = fmt.Errorf("Png chunk at %d is truncated", pos)
+			return
+		}
+
+		length := binary.BigEndian.Uint32(b[pos:])
+		if length > pngMaxChunkLength || int64(length) > int64(len(b))-pos-12 {
+			err = fmt.Errorf("Png chunk at %d has invalid length %d", pos, length)
+			return
+		}
+
+		end := pos + 8 + int64(length)
+		chunk := PngChunk{name: string(b[pos+4 : pos+8]), pos: pos, data: b[pos+8 : end]}
+
+		// games and editors leave bad crcs in text chunks, only the
+		// critical chunks the image needs must be intact
+		sum := binary.BigEndian.Uint32(b[end:])
+		if crc32.ChecksumIEEE(b[pos+4:end]) != sum {
+			if chunk.critical() {
+				err = fmt.Errorf("Png chunk %s at %d has a bad crc", chunk.name, pos)
+				return
+			}
+			printWarning(fmt.Errorf("Png chunk %s at %d has a bad crc, ignored", chunk.name, pos))
+		}
+
+		if len(chunks) == 0 && chunk.name != "IHDR" {
+			err = errors.New("Png does not start with IHDR")
+			return
+		}
+		chunks = append(chunks, chunk)
+
+		pos = end + 4
+		if chunk.name == "IEND" {
+			size = pos
+			return
+		}
+	}
+}
+
+// checkPngData is the exact size of the png at the start of b
+func checkPngData(b []byte) (size int64, err error) {
+	_, size, err = readPngChunks(b)
+	return
+}
+
+// PngText strcture, a tEXt or iTXt entry
+type PngText struct {
+	keyword string
+	text    string
+}
+
+// keyword is the text before the first zero of a tEXt or iTXt chunk
+func (c *PngChunk) keyword() (string, bool) {
+	if c.name != "tEXt" && c.name != "iTXt" {
+		return "", false
+	}
+	idx := bytes.IndexByte(c.data, 0)
+	if idx < 0 {
+		return "", false
+	}
+	return string(c.data[:idx]), true
+}
+
+func writePngChunk(buf *bytes.Buffer, name string, data []byte) {
+	var head [8]byte
+	binary.BigEndian.PutUint32(head[:4], uint32(len(data)))
+	copy(head[4:], name)
+	buf.Write(head[:])
+	buf.Write(data)
+
+	sum := crc32.NewIEEE()
+	sum.Write(head[4:])
+	sum.Write(data)
+	var tail [4]byte
+	binary.BigEndian.PutUint32(tail[:], sum.Sum32())
+	buf.Write(tail[:])
+}
+
+func isASCII(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// chunk is a tEXt chunk for ascii and an uncompressed utf-8 iTXt chunk
+// for anything else
+func (t *PngText) chunk() (name string, data []byte) {
+	if isASCII(t.text) {
+		return "tEXt", []byte(t.keyword + "\x00" + t.text)
+	}
+	// no compression, no language, no translated keyword
+	return "iTXt", []byte(t.keyword + "\x00\x00\x00\x00\x00" + t.text)
+}
+
+// insertPngText writes texts right before IEND of b. Text chunks with the
+// same keywords are dropped so a card written twice keeps one copy
+func insertPngText(b []byte, texts []PngText) (re []byte, err error) {
+	chunks, _, cErr := readPngChunks(b)
+	if cErr != nil {
+		err = cErr
+		return
+	}
+
+	keywords := make(map[string]bool)
+	for _, t := range texts {
+		keywords[t.keyword] = true
+	}
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	for _, c := range chunks {
+		if k, ok := c.keyword(); ok && keywords[k] {
+			continue
+		}
+		if c.name == "IEND" {
+			for _, t := range texts {
+				name, data := t.chunk()
+				writePngChunk(&buf, name, data)
+			}
+		}
+		writePngChunk(&buf, c.name, c.data)
+	}
+	re = buf.Bytes()
+	return
+}
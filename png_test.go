@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sulfur/bbio"
+)
+
+// testTextPng is a small png with a tEXt chunk before IEND
+func testTextPng(t testing.TB) []byte {
+	b, err := createPng(4, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = insertPngText(b, []PngText{{keyword: "Comment", text: "card"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testBreakCrc copies b with the crc of its first chunk called name flipped
+func testBreakCrc(t testing.TB, b []byte, name string) []byte {
+	chunks, _, err := readPngChunks(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := append([]byte(nil), b...)
+	for _, c := range chunks {
+		if c.name == name {
+			crcPos := c.pos + c.size() - 4
+			binary.BigEndian.PutUint32(re[crcPos:], ^binary.BigEndian.Uint32(re[crcPos:]))
+			return re
+		}
+	}
+	t.Fatalf("no %s chunk", name)
+	return nil
+}
+
+func TestReadPngChunks(t *testing.T) {
+	good := testTextPng(t)
+	payload := []byte("KoiKatuChara")
+
+	noIHDR := append([]byte(nil), good...)
+	copy(noIHDR[len(pngSignature)+4:], "IHDX")
+
+	badLength := append([]byte(nil), good...)
+	binary.BigEndian.PutUint32(badLength[len(pngSignature):], 0xffffffff)
+
+	tests := []struct {
+		name string
+		b    []byte
+		ok   bool
+	}{
+		{"valid", good, true},
+		{"payload after IEND", append(append([]byte(nil), good...), payload...), true},
+		{"bad tEXt crc", testBreakCrc(t, good, "tEXt"), true},
+		{"bad IHDR crc", testBreakCrc(t, good, "IHDR"), false},
+		{"bad IDAT crc", testBreakCrc(t, good, "IDAT"), false},
+		{"bad IEND crc", testBreakCrc(t, good, "IEND"), false},
+		{"IHDR not first", noIHDR, false},
+		{"truncated", good[:len(good)-6], false},
+		{"bad length", badLength, false},
+		{"no signature", good[1:], false},
+		{"empty", nil, false},
+	}
+
+	for _, tt := range tests {
+		chunks, size, err := readPngChunks(tt.b)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+
+		pngSize := getPngSize(bbio.NewReaderBytes(tt.b))
+		if !tt.ok {
+			if pngSize != 0 {
+				t.Errorf("%s: getPngSize %d", tt.name, pngSize)
+			}
+			continue
+		}
+		if size != int64(len(good)) || pngSize != size {
+			t.Errorf("%s: size %d, getPngSize %d, want %d", tt.name, size, pngSize, len(good))
+		}
+		if chunks[0].name != "IHDR" || chunks[len(chunks)-1].name != "IEND" {
+			t.Errorf("%s: chunks %s to %s", tt.name, chunks[0].name, chunks[len(chunks)-1].name)
+		}
+	}
+}
+
+func TestPngChunkCritical(t *testing.T) {
+	for name, want := range map[string]bool{"IHDR": true, "PLTE": true, "IDAT": true, "IEND": true, "tEXt": false, "iTXt": false, "zTXt": false, "gAMA": false} {
+		c := PngChunk{name: name}
+		if got := c.critical(); got != want {
+			t.Errorf("%s: critical %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestInsertPngTextBadCrc(t *testing.T) {
+	b, err := insertPngText(testBreakCrc(t, testTextPng(t), "tEXt"), []PngText{{keyword: "Title", text: "Alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the chunks are written again with good crcs
+	chunks, _, cErr := readPngChunks(b)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	for _, c := range chunks {
+		want := crc32.ChecksumIEEE(b[c.pos+4 : c.pos+8+int64(len(c.data))])
+		if got := binary.BigEndian.Uint32(b[c.pos+c.size()-4:]); got != want {
+			t.Errorf("%s: crc %08x, want %08x", c.name, got, want)
+		}
+	}
+}
+
+func TestThumbnailBadTextCrc(t *testing.T) {
+	dir := t.TempDir()
+	scene := append(testBreakCrc(t, testTextPng(t), "tEXt"), neoV2Mark...)
+	scenePath := filepath.Join(dir, "scene.png")
+	if err := ioutil.WriteFile(scenePath, scene, 0644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := createPng(sceneShotSize.X, sceneShotSize.Y, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgPath := filepath.Join(dir, "image.png")
+	if wErr := ioutil.WriteFile(imgPath, img, 0644); wErr != nil {
+		t.Fatal(wErr)
+	}
+
+	if tErr := thumbnailCard(scenePath, ExtractOptions{thumbImage: imgPath}); tErr != nil {
+		t.Fatal(tErr)
+	}
+}
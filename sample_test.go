@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sulfur/bbio"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// testMsgMap encodes kv pairs as a msgpack map in the given order
+func testMsgMap(t testing.TB, kv ...interface{}) []byte {
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	enc.UseCompactInts(true)
+	if err := enc.EncodeMapLen(len(kv) / 2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(kv); i += 2 {
+		if err := enc.EncodeString(kv[i].(string)); err != nil {
+			t.Fatal(err)
+		}
+		if raw, ok := kv[i+1].(msgpack.RawMessage); ok {
+			b.Write(raw)
+			continue
+		}
+		if err := enc.Encode(kv[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Bytes()
+}
+
+// testKKCoordinate is one coordinate slot as the game serializes it
+func testKKCoordinate(t testing.TB, id int) []byte {
+	var b bytes.Buffer
+	parts := []interface{}{msgpack.RawMessage(testMsgMap(t, "id", id, "colorInfo", []interface{}{}))}
+	writeSizedBlock(&b, testMsgMap(t, "version", "0.0.0", "parts", parts))
+	writeSizedBlock(&b, testMsgMap(t, "version", "0.0.0", "parts", []interface{}{}))
+	b.WriteByte(1)
+	writeSizedBlock(&b, testMsgMap(t, "cheekId", 2))
+	return b.Bytes()
+}
+
+func testKKCard(t testing.TB) KKCharaCard {
+	var coord bytes.Buffer
+	slots := make([][]byte, len(kkCoordinateNames))
+	for i := range slots {
+		slots[i] = testKKCoordinate(t, i)
+	}
+	if err := msgpack.NewEncoder(&coord).Encode(slots); err != nil {
+		t.Fatal(err)
+	}
+
+	card := KKCharaCard{loadProductNo: 100, marker: kkCharaMark, loadVersion: "0.0.0", faceData: []byte{1, 2, 3}, faceLength: 3}
+	card.data = map[string][]byte{
+		"KKEx":       testMsgMap(t, "com.example.plugin", []byte{9, 9}),
+		"Custom":     make([]byte, 12),
+		"Coordinate": coord.Bytes(),
+		"Parameter":  testMsgMap(t, "version", "0.0.0", "sex", 1, "lastname", "Sato", "firstname", "Yui", "nickname", "Yu", "personality", 3),
+		"Status":     testMsgMap(t, "version", "0.0.0", "coordinateType", 0),
+	}
+	for _, name := range []string{"KKEx", "Custom", "Coordinate", "Parameter", "Status"} {
+		card.infoHeader.lstInfo = append(card.infoHeader.lstInfo, KKHeaderInfo{name: name, version: "0.0.0"})
+	}
+	if err := card.loadPreviewInfo(); err != nil {
+		t.Fatal(err)
+	}
+	return card
+}
+
+// testAISCoordinate is the Coordinate block of an AIS chara
+func testAISCoordinate(t testing.TB) []byte {
+	var b bytes.Buffer
+	writeSizedBlock(&b, testMsgMap(t, "version", "0.0.0", "parts", []interface{}{}))
+	writeSizedBlock(&b, testMsgMap(t, "version", "0.0.0", "parts", []interface{}{}))
+	return b.Bytes()
+}
+
+func testAISCard(t testing.TB) AISCharaCard {
+	card := AISCharaCard{loadProductNo: 100, marker: aisCharaMark, loadVersion: "1.0.0", userID: "user", dataID: "data"}
+	card.data = map[string][]byte{
+		"Custom":     make([]byte, 4),
+		"Coordinate": testAISCoordinate(t),
+		"Parameter":  testMsgMap(t, "version", "0.0.0", "sex", 1, "fullname", "Ai", "personality", 2),
+		"GameInfo":   testMsgMap(t, "version", "0.0.0"),
+		"Status":     testMsgMap(t, "version", "0.0.0"),
+		"KKEx":       testMsgMap(t, "com.example.plugin", []byte{9, 9}),
+	}
+	for _, name := range []string{"Custom", "Coordinate", "Parameter", "GameInfo", "Status", "KKEx"} {
+		card.infoHeader.lstInfo = append(card.infoHeader.lstInfo, AISHeaderInfo{name: name, version: "0.0.0"})
+	}
+	if err := card.loadPreviewInfo(); err != nil {
+		t.Fatal(err)
+	}
+	return card
+}
+
+func testHSCard(t testing.TB) HSCharaCard {
+	card := HSCharaCard{marker: hsCharaFemaleMark, sex: 1, loadVersion: 2}
+	preview := bbio.NewBuffer()
+	preview.PutInt(1)
+	preview.PutInt(1)
+	preview.PutInt(0)
+	preview.PutInt(0)
+	preview.WriteString("Hana")
+	card.data = map[string][]byte{"プレビュー情報": preview.Bytes(), "カスタム情報": {1, 2, 3, 4}}
+	card.infoHeader.lstInfo = []HSHeaderInfo{{Name: "プレビュー情報", Version: 4}, {Name: "カスタム情報", Version: 1}}
+	if err := card.loadPreviewInfo(); err != nil {
+		t.Fatal(err)
+	}
+	return card
+}
+
+// testPHStream builds PlayHome CustomParameter bytes laid out the way each
+// game version saved them, every float a distinct value so conversions can
+// be checked. Values an old version does not read back are written as the
+// placeholders the game leaves in the file.
+type testPHStream struct {
+	buf     *bbio.Buffer
+	f       float32
+	version int32
+}
+
+func (s *testPHStream) floats(n int) {
+	for i := 0; i < n; i++ {
+		s.f += 0.25
+		s.buf.PutFloat(s.f)
+	}
+}
+
+func (s *testPHStream) color(colorType int32, n int) {
+	s.buf.PutInt(colorType)
+	s.floats(n)
+}
+
+func (s *testPHStream) hairColor() {
+	if s.version < 4 {
+		s.floats(4) // mainColor
+		return
+	}
+	s.color(1, 14)
+}
+
+// simpleColor is a PBR1, Alloy or EyeHighlight color of n floats
+func (s *testPHStream) simpleColor(colorType int32, n int) {
+	if s.version < 4 {
+		s.floats(4) // mainColor
+		return
+	}
+	s.color(colorType, n)
+}
+
+func (s *testPHStream) pbr2Color() {
+	if s.version < 4 {
+		s.floats(4) // mainColor1
+		return
+	}
+	s.color(3, 18)
+	if s.version >= 5 {
+		s.floats(1) // specular2
+	}
+	s.floats(1) // smooth2
+}
+
+func (s *testPHStream) hsvOffsetColor() {
+	if s.version < 4 {
+		s.buf.PutFloatAll(1.0, 1.0, 1.0, 1.0)
+		return
+	}
+	s.buf.PutInt(5)
+	switch {
+	case s.version < 6:
+		s.buf.PutFloatAll(1.0, 1.0, 1.0, 1.0)
+	case s.version == 6:
+		s.floats(3) // offset_h, offset_s, offset_v
+	case s.version == 7:
+		s.floats(3)
+		s.buf.WriteByte(0)
+		s.floats(1) // alpha
+	default:
+		s.floats(4)
+	}
+	s.floats(2) // metallic, smooth
+}
+
+func testPHCustomVersion(sex int32, version int32) []byte {
+	s := testPHStream{buf: bbio.NewBuffer(), version: version}
+	s.buf.PutInt(version)
+	s.buf.PutInt(sex)
+
+	// hair
+	s.buf.PutInt(2)
+	for i := int32(0); i < 2; i++ {
+		s.buf.PutInt(i + 1)
+		s.hairColor()
+		if version > 0 {
+			s.simpleColor(2, 10)
+		}
+	}
+
+	// head
+	s.floats(5)
+	s.simpleColor(2, 10)
+	if version < 4 {
+		s.floats(4)  // eyeScleraColor
+		s.floats(10) // eyeID_L, eyeIrisColorL, eyeID_R, eyeIrisColorR
+	} else {
+		for eye := 0; eye < 2; eye++ {
+			s.floats(10)
+			if version >= 10 {
+				s.floats(1) // eyeEmissive
+			}
+		}
+	}
+	s.floats(5)
+	s.buf.PutInt(3)
+	s.floats(3)
+	if sex == phSexFemale {
+		s.floats(1)
+		s.simpleColor(2, 10)
+		s.floats(20)
+		s.floats(1)
+		s.simpleColor(7, 10)
+	} else {
+		s.floats(5)
+		if version >= 2 {
+			s.simpleColor(7, 10)
+		}
+	}
+
+	// body
+	s.floats(1)
+	s.hsvOffsetColor()
+	s.floats(3)
+	s.simpleColor(4, 6)
+	s.floats(5)
+	s.buf.PutInt(2)
+	s.floats(2)
+	if sex == phSexFemale {
+		s.floats(1)
+		s.hsvOffsetColor()
+		s.floats(5)
+		if version >= 3 {
+			s.hsvOffsetColor()
+			if version >= 9 {
+				s.simpleColor(2, 10)
+			}
+			s.floats(3)
+		}
+	}
+
+	// wear
+	for i := 0; i < 11; i++ {
+		s.floats(2)
+		s.pbr2Color()
+	}
+	if sex == phSexFemale {
+		s.buf.Write([]byte{1, 0, 1})
+	}
+
+	// accessory
+	for i := 0; i < 10; i++ {
+		s.floats(12)
+		s.pbr2Color()
+	}
+	return s.buf.Bytes()
+}
+
+func testPHCustom(sex int32) []byte {
+	return testPHCustomVersion(sex, phLatestVersion)
+}
+
+// testPHFemaleCustom is a version 10 female CustomParameter spelled out
+// field by field in the order the game saves them, with game-like ids and
+// colors instead of a generated sequence
+func testPHFemaleCustom() []byte {
+	buf := bbio.NewBuffer()
+	rgba := func(r, g, b, a float32) { buf.PutFloatAll(r, g, b, a) }
+	pbr1 := func(r, g, b float32) {
+		buf.PutInt(2)
+		rgba(r, g, b, 1.0)        // mainColor1
+		rgba(1.0, 1.0, 1.0, 1.0)  // specColor1
+		buf.PutFloatAll(0.1, 0.4) // specular1, smooth1
+	}
+	pbr2 := func(r, g, b float32) {
+		buf.PutInt(3)
+		rgba(r, g, b, 1.0)        // mainColor1
+		rgba(1.0, 1.0, 1.0, 1.0)  // specColor1
+		buf.PutFloatAll(0.2, 0.3) // specular1, smooth1
+		rgba(b, g, r, 1.0)        // mainColor2
+		rgba(1.0, 1.0, 1.0, 1.0)  // specColor2
+		buf.PutFloatAll(0.6, 0.7) // specular2, smooth2
+	}
+	hsvOffset := func(h, s, v float32) {
+		buf.PutInt(5)
+		buf.PutFloatAll(h, s, v, 1.0) // offset_h, offset_s, offset_v, alpha
+		buf.PutFloatAll(0.0, 0.562)   // metallic, smooth
+	}
+
+	buf.PutInt(10) // version
+	buf.PutInt(0)  // sex, female
+
+	// hair: back, side, front
+	buf.PutInt(3)
+	for id := int32(0); id < 3; id++ {
+		buf.PutInt(100 + id) // hairPartID
+		buf.PutInt(1)
+		rgba(0.35, 0.2, 0.1, 1.0)   // mainColor
+		rgba(0.75, 0.75, 0.75, 1.0) // cuticleColor
+		buf.PutFloat(6.0)           // cuticleExp
+		rgba(0.75, 0.75, 0.75, 1.0) // fresnelColor
+		buf.PutFloat(0.3)           // fresnelExp
+		pbr1(0.9, 0.1, 0.1)         // acceColor
+	}
+
+	// head
+	buf.PutInt(0)       // headID
+	buf.PutInt(2)       // faceTexID
+	buf.PutInt(1)       // detailID
+	buf.PutFloat(0.5)   // detailWeight
+	buf.PutInt(4)       // eyeBrowID
+	pbr1(0.3, 0.2, 0.1) // eyeBrowColor
+	for eye := int32(0); eye < 2; eye++ {
+		buf.PutInt(7 + eye)         // eyeID
+		rgba(0.95, 0.95, 0.95, 1.0) // eyeScleraColor
+		rgba(0.2, 0.4, 0.8, 1.0)    // eyeIrisColor
+		buf.PutFloat(0.1)           // eyePupilDilation
+		buf.PutFloat(0.45)          // eyeEmissive
+	}
+	buf.PutInt(-1)           // tattooID
+	rgba(1.0, 1.0, 1.0, 1.0) // tattooColor
+	buf.PutInt(4)            // shapeVals
+	buf.PutFloatAll(0.5, 0.25, 0.75, 0.5)
+	buf.PutInt(3)       // eyeLashID
+	pbr1(0.1, 0.1, 0.1) // eyeLashColor
+	for id := int32(0); id < 4; id++ {
+		buf.PutInt(id)           // eyeshadow, cheek, lip, mole id
+		rgba(0.8, 0.4, 0.4, 0.5) // color
+	}
+	buf.PutInt(1) // eyeHighlightID
+	buf.PutInt(7)
+	rgba(1.0, 1.0, 1.0, 1.0)  // mainColor1
+	rgba(1.0, 1.0, 1.0, 1.0)  // specColor1
+	buf.PutFloatAll(0.0, 0.0) // specular1, smooth1
+
+	// body
+	buf.PutInt(0)             // bodyID
+	hsvOffset(0.02, 0.9, 1.1) // skinColor
+	buf.PutInt(1)             // detailID
+	buf.PutFloat(0.3)         // detailWeight
+	buf.PutInt(2)             // underhairID
+	buf.PutInt(4)
+	rgba(0.2, 0.15, 0.1, 1.0) // underhairColor
+	buf.PutFloatAll(0.0, 0.2) // metallic, smooth
+	buf.PutInt(-1)            // tattooID
+	rgba(1.0, 1.0, 1.0, 1.0)  // tattooColor
+	buf.PutInt(3)             // shapeVals
+	buf.PutFloatAll(0.6, 0.4, 0.5)
+	buf.PutInt(5)                    // nipID
+	hsvOffset(0.0, 1.2, 0.9)         // nipColor
+	buf.PutInt(0)                    // sunburnID
+	rgba(1.0, 1.0, 1.0, 0.0)         // sunburnColor
+	hsvOffset(0.0, 1.0, 1.0)         // nailColor
+	pbr1(0.95, 0.3, 0.5)             // manicureColor
+	buf.PutFloatAll(0.4, 0.55, 0.65) // areolaSize, bustSoftness, bustWeight
+
+	// wear
+	for wear := int32(0); wear < 11; wear++ {
+		buf.PutInt(wear)       // WEAR_TYPE
+		buf.PutInt(200 + wear) // id
+		pbr2(0.1*float32(wear%10), 0.5, 0.9)
+	}
+	buf.Write([]byte{1, 1, 0}) // isSwimwear, swimOptTop, swimOptBtm
+
+	// accessory
+	for slot := int32(0); slot < 10; slot++ {
+		buf.PutInt(slot % 3)       // ACCESSORY_TYPE
+		buf.PutInt(300 + slot)     // id
+		buf.PutInt(slot)           // nowAttach
+		buf.PutFloatAll(0, 0.1, 0) // addPos
+		buf.PutFloatAll(0, 90, 0)  // addRot
+		buf.PutFloatAll(1, 1, 1)   // addScl
+		pbr2(0.8, 0.7, 0.1)
+	}
+	return buf.Bytes()
+}
+
+func testPHCard(t testing.TB, sex int32) PHCharaCard {
+	card, err := readPHCustomParameter(bbio.NewReaderBytes(testPHCustom(sex)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sexInfo, sErr := phSexByCustom(sex)
+	if sErr != nil {
+		t.Fatal(sErr)
+	}
+	card.sceneSex = sexInfo.scene
+	return card
+}
+
+// testWriteCards is the WriteChara output of every handler
+func testWriteCards(t testing.TB) map[string][]byte {
+	out := make(map[string][]byte)
+
+	var b bytes.Buffer
+	if _, err := NewKKChara().WriteChara(testKKCard(t), &b); err != nil {
+		t.Fatal(err)
+	}
+	out[gameKK] = append([]byte{}, b.Bytes()...)
+
+	b.Reset()
+	if _, err := NewAISChara().WriteChara(testAISCard(t), &b); err != nil {
+		t.Fatal(err)
+	}
+	out[gameAIS] = append([]byte{}, b.Bytes()...)
+
+	b.Reset()
+	if _, err := NewHSChara().WriteChara(testHSCard(t), &b); err != nil {
+		t.Fatal(err)
+	}
+	out[gameHS] = append([]byte{}, b.Bytes()...)
+
+	b.Reset()
+	if _, err := NewPHChara().WriteChara(testPHCard(t, phSexFemale), &b); err != nil {
+		t.Fatal(err)
+	}
+	out[gamePH] = append([]byte{}, b.Bytes()...)
+	return out
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io/ioutil"
+
+	"github.com/hajimehoshi/bitmapfont/v3"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Thumbnail modes
+const (
+	thumbSolid    = "solid"
+	thumbLabel    = "label"
+	thumbTemplate = "template"
+	thumbFace     = "face"
+	thumbScene    = "scene"
+)
+
+// chara card thumbnail size, used when the chara has no card png of its
+// own to take the size from
+var cardThumbSize = image.Point{252, 352}
+
+// labelFace draws the labels, a bitmap font with Japanese glyphs
+var labelFace = bitmapfont.Face
+
+// screenshot size of the studio scene cards, used when the old screenshot
+// can not be read
+var sceneShotSize = image.Point{320, 180}
+
+var thumbColorMale = color.RGBA{0x0, 0x0, 0xff, 0xff}
+var thumbColorFemale = color.RGBA{0xff, 0x80, 0xff, 0xff}
+
+// ThumbInfo strcture, what a chara thumbnail shows
+type ThumbInfo struct {
+	game string
+	// 0 male, 1 female
+	sex  int32
+	name string
+	// embedded face png, KK only
+	face []byte
+	// size of the original card png, zero for scene charas
+	size image.Point
+}
+
+// Thumbnailer renders the png of a written chara card
+type Thumbnailer interface {
+	Render(info ThumbInfo) ([]byte, error)
+}
+
+func thumbSize(info ThumbInfo) image.Point {
+	if info.size.X > 0 && info.size.Y > 0 {
+		return info.size
+	}
+	return cardThumbSize
+}
+
+func thumbColor(sex int32) color.Color {
+	if sex == 0 {
+		return thumbColorMale
+	}
+	return thumbColorFemale
+}
+
+func encodeThumb(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbDrawable reports whether labelFace has a glyph for every rune of str
+func thumbDrawable(str string) bool {
+	for _, r := range str {
+		if _, ok := labelFace.GlyphAdvance(r); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// thumbText cuts str to width pixels, nothing fits on very small images
+func thumbText(str string, width int) string {
+	max := fixed.I(width)
+	if font.MeasureString(labelFace, str) <= max {
+		return str
+	}
+
+	tilde := font.MeasureString(labelFace, "~")
+	runes := []rune(str)
+	for n := len(runes) - 1; n > 0; n-- {
+		cut := string(runes[:n])
+		if font.MeasureString(labelFace, cut)+tilde <= max {
+			return cut + "~"
+		}
+	}
+	return ""
+}
+
+// drawThumbLabel draws lines over a dark band at the bottom of img
+func drawThumbLabel(img draw.Image, lines []string) {
+	metrics := labelFace.Metrics()
+	bounds := img.Bounds()
+	lineHeight := metrics.Height.Ceil() + 2
+
+	band := bounds
+	band.Min.Y = bounds.Max.Y - lineHeight*len(lines) - 8
+	draw.Draw(img, band, image.NewUniform(color.RGBA{0, 0, 0, 0xa0}), image.Point{}, draw.Over)
+
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.White,
+		Face: labelFace,
+	}
+	for i, line := range lines {
+		y := band.Min.Y + 4 + lineHeight*(i+1) - metrics.Descent.Ceil()
+		d.Dot = fixed.P(bounds.Min.X+4, y)
+		d.DrawString(thumbText(line, bounds.Dx()-8))
+	}
+}
+
+// SolidThumb strcture, a blue or pink rectangle
+type SolidThumb struct{}
+
+// Render implements for SolidThumb
+func (t SolidThumb) Render(info ThumbInfo) ([]byte, error) {
+	size := thumbSize(info)
+	return createPng(size.X, size.Y, int(info.sex))
+}
+
+// LabelThumb strcture, a solid thumbnail with name, game and scene
+type LabelThumb struct {
+	scene string
+}
+
+func (t LabelThumb) lines(info ThumbInfo) []string {
+	name := info.name
+	if !thumbDrawable(name) {
+		printWarning(fmt.Errorf("'%s' has characters the thumbnail font can not draw", name))
+	}
+	if name == "" {
+		name = "(no name)"
+	}
+	lines := []string{name, gameNames[info.game]}
+	if t.scene != "" {
+		lines = append(lines, t.scene)
+	}
+	return lines
+}
+
+// Render implements for LabelThumb
+func (t LabelThumb) Render(info ThumbInfo) ([]byte, error) {
+	size := thumbSize(info)
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(img, img.Bounds(), image.NewUniform(thumbColor(info.sex)), image.Point{}, draw.Src)
+
+	drawThumbLabel(img, t.lines(info))
+	return encodeThumb(img)
+}
+
+// TemplateThumb strcture, a user png with the labels on top
+type TemplateThumb struct {
+	LabelThumb
+	template image.Image
+}
+
+// loadThumbImage reads a png or jpeg image
+func loadThumbImage(filePath string) (img image.Image, err error) {
+	b, rErr := ioutil.ReadFile(filePath)
+	if rErr != nil {
+		err = rErr
+		return
+	}
+
+	img, _, err = image.Decode(bytes.NewReader(b))
+	if err == nil && img.Bounds().Empty() {
+		err = errors.New("empty image")
+	}
+	if err != nil {
+		err = fmt.Errorf("Thumbnail image '%s': %v", filePath, err)
+	}
+	return
+}
+
+// decodeThumbPng decodes a png, an image without pixels is an error
+func decodeThumbPng(b []byte) (img image.Image, err error) {
+	img, err = png.Decode(bytes.NewReader(b))
+	if err == nil && img.Bounds().Empty() {
+		err = errors.New("empty image")
+	}
+	return
+}
+
+// Render implements for TemplateThumb, the template is cropped and scaled to
+// the card size
+func (t TemplateThumb) Render(info ThumbInfo) ([]byte, error) {
+	img := cropThumb(t.template, thumbSize(info))
+	drawThumbLabel(img, t.lines(info))
+	return encodeThumb(img)
+}
+
+// FaceThumb strcture, the KK face image scaled and padded to card size.
+// Charas without a face image use the fallback
+type FaceThumb struct {
+	fallback Thumbnailer
+}
+
+// Render implements for FaceThumb
+func (t FaceThumb) Render(info ThumbInfo) ([]byte, error) {
+	if len(info.face) == 0 {
+		return t.fallback.Render(info)
+	}
+
+	face, fErr := decodeThumbPng(info.face)
+	if fErr != nil {
+		printWarning(fmt.Errorf("Face image of '%s' can not be used: %v", info.name, fErr))
+		return t.fallback.Render(info)
+	}
+
+	size := thumbSize(info)
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(img, img.Bounds(), image.NewUniform(thumbColor(info.sex)), image.Point{}, draw.Src)
+
+	// fit inside the card, keeping the aspect ratio
+	fb := face.Bounds()
+	w, h := size.X, fb.Dy()*size.X/fb.Dx()
+	if h > size.Y {
+		w, h = fb.Dx()*size.Y/fb.Dy(), size.Y
+	}
+	dst := image.Rect(0, 0, w, h).Add(image.Pt((size.X-w)/2, (size.Y-h)/2))
+	draw.CatmullRom.Scale(img, dst, face, fb, draw.Over, nil)
+
+	return encodeThumb(img)
+}
+
+// SceneThumb strcture, the scene screenshot cropped to card shape with the
+// labels on top
+type SceneThumb struct {
+	LabelThumb
+	shot image.Image
+}
+
+// cropThumb center crops src to the aspect ratio of size and scales it
+func cropThumb(src image.Image, size image.Point) *image.RGBA {
+	img := image.NewRGBA(image.Rectangle{Max: size})
+
+	sr := src.Bounds()
+	if sr.Dx()*size.Y > sr.Dy()*size.X {
+		w := sr.Dy() * size.X / size.Y
+		sr.Min.X += (sr.Dx() - w) / 2
+		sr.Max.X = sr.Min.X + w
+	} else {
+		h := sr.Dx() * size.Y / size.X
+		sr.Min.Y += (sr.Dy() - h) / 2
+		sr.Max.Y = sr.Min.Y + h
+	}
+	draw.CatmullRom.Scale(img, img.Bounds(), src, sr, draw.Src, nil)
+	return img
+}
+
+// Render implements for SceneThumb
+func (t SceneThumb) Render(info ThumbInfo) ([]byte, error) {
+	if t.shot == nil {
+		return t.LabelThumb.Render(info)
+	}
+
+	img := cropThumb(t.shot, thumbSize(info))
+	drawThumbLabel(img, t.lines(info))
+	return encodeThumb(img)
+}
+
+// ImageThumb strcture, a user image cropped to card size, used by the
+// thumbnail command
+type ImageThumb struct {
+	img image.Image
+}
+
+// Render implements for ImageThumb
+func (t ImageThumb) Render(info ThumbInfo) ([]byte, error) {
+	return encodeThumb(cropThumb(t.img, thumbSize(info)))
+}
+
+func decodeSceneShot(shot []byte) image.Image {
+	if len(shot) == 0 {
+		printWarning(errors.New("Scene screenshot not found, using label thumbnails"))
+		return nil
+	}
+
+	img, err := decodeThumbPng(shot)
+	if err != nil {
+		printWarning(fmt.Errorf("Scene screenshot can not be used, using label thumbnails: %v", err))
+		return nil
+	}
+	return img
+}
+
+// newThumbnailer builds the renderer of opts, nil keeps the default.
+// shot is the screenshot png of the scene, used by thumbScene
+func newThumbnailer(opts ExtractOptions, scene string, shot []byte) (thumb Thumbnailer, err error) {
+	switch opts.thumbMode {
+	case "":
+	case thumbSolid:
+		thumb = SolidThumb{}
+	case thumbLabel:
+		thumb = LabelThumb{scene: scene}
+	case thumbTemplate:
+		if opts.thumbTemplate == "" {
+			err = fmt.Errorf("Thumbnail mode %s needs --thumb-template", thumbTemplate)
+			return
+		}
+
+		tpl, tErr := loadThumbImage(opts.thumbTemplate)
+		if tErr != nil {
+			err = tErr
+			return
+		}
+		thumb = TemplateThumb{LabelThumb: LabelThumb{scene: scene}, template: tpl}
+	case thumbFace:
+		thumb = FaceThumb{fallback: LabelThumb{scene: scene}}
+	case thumbScene:
+		thumb = SceneThumb{LabelThumb: LabelThumb{scene: scene}, shot: decodeSceneShot(shot)}
+	default:
+		err = fmt.Errorf("Unknown thumbnail mode '%s', expected %s, %s, %s, %s or %s", opts.thumbMode, thumbSolid, thumbLabel, thumbTemplate, thumbFace, thumbScene)
+	}
+	return
+}
+
+// renderThumb keeps the original png of a standalone card unless a
+// thumbnail mode was chosen, then adds the text chunks of meta
+func renderThumb(thumb Thumbnailer, meta *CardMeta, pngData []byte, info ThumbInfo) (b []byte, err error) {
+	if pngData != nil {
+		cfg, cErr := png.DecodeConfig(bytes.NewReader(pngData))
+		if cErr == nil {
+			info.size = image.Point{cfg.Width, cfg.Height}
+		}
+	}
+
+	switch {
+	case thumb != nil:
+		b, err = thumb.Render(info)
+	case pngData != nil:
+		b = pngData
+	default:
+		b, err = SolidThumb{}.Render(info)
+	}
+	if err != nil || meta == nil {
+		return
+	}
+	return insertPngText(b, meta.texts(info))
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sulfur/bbio"
+)
+
+// testPngSize decodes the size of a png
+func testPngSize(t testing.TB, b []byte) image.Point {
+	cfg, err := png.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image.Point{cfg.Width, cfg.Height}
+}
+
+func TestThumbSize(t *testing.T) {
+	for _, game := range []string{gameAIS, gameHS2, gameHS, gameKK, gamePH} {
+		if got := thumbSize(ThumbInfo{game: game}); got != (image.Point{252, 352}) {
+			t.Errorf("%s: size %v, want 252x352", game, got)
+		}
+	}
+
+	own := image.Point{300, 420}
+	if got := thumbSize(ThumbInfo{game: gameKK, size: own}); got != own {
+		t.Errorf("card size %v, want %v", got, own)
+	}
+}
+
+func TestRenderThumbCardSize(t *testing.T) {
+	src, err := createPng(300, 420, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := TemplateThumb{template: image.NewRGBA(image.Rect(0, 0, 100, 50))}
+	thumbs := []Thumbnailer{SolidThumb{}, LabelThumb{}, SceneThumb{}, template}
+	for _, thumb := range thumbs {
+		b, rErr := renderThumb(thumb, nil, src, ThumbInfo{game: gameHS, sex: 1, name: "Alice"})
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		if got := testPngSize(t, b); got != (image.Point{300, 420}) {
+			t.Errorf("%T: wrote %v, want the card size", thumb, got)
+		}
+	}
+
+	// scene charas have no png and use the card size
+	b, rErr := renderThumb(LabelThumb{}, nil, nil, ThumbInfo{game: gamePH})
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	if got := testPngSize(t, b); got != cardThumbSize {
+		t.Errorf("scene chara: wrote %v, want %v", got, cardThumbSize)
+	}
+}
+
+// testLabelPixels counts the white pixels of a rendered label thumbnail
+func testLabelPixels(t testing.TB, b []byte) (white int) {
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, g, bl, _ := img.At(x, y).RGBA(); r == 0xffff && g == 0xffff && bl == 0xffff {
+				white++
+			}
+		}
+	}
+	return
+}
+
+func TestThumbLabelJapanese(t *testing.T) {
+	for _, name := range []string{"Alice Smith", "さくら", "ひなた", "お風呂のシーン", "Zoë"} {
+		if !thumbDrawable(name) {
+			t.Errorf("%q can not be drawn", name)
+		}
+	}
+
+	// the glyphs are drawn, not replaced or left out
+	render := func(name string) []byte {
+		b, err := LabelThumb{}.Render(ThumbInfo{game: gameKK, sex: 0, name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	sakura, hinata := render("さくら"), render("ひなた")
+	if bytes.Equal(sakura, hinata) {
+		t.Error("different names render the same thumbnail")
+	}
+	if testLabelPixels(t, sakura) <= testLabelPixels(t, render(" ")) {
+		t.Error("the japanese name drew nothing")
+	}
+}
+
+func TestThumbTextSmallImage(t *testing.T) {
+	tests := []struct {
+		str   string
+		width int
+		want  string
+	}{
+		{"Alice", 0, ""},
+		{"Alice", 30, "Alice"},
+		{"Alice", 18, "Al~"},
+		{"さくら", 36, "さくら"},
+		{"さくら", 30, "さく~"},
+		{"さくら", 17, ""},
+	}
+	for _, tt := range tests {
+		if got := thumbText(tt.str, tt.width); got != tt.want {
+			t.Errorf("thumbText(%q, %d) = %q, want %q", tt.str, tt.width, got, tt.want)
+		}
+	}
+
+	src, err := createPng(8, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, rErr := renderThumb(LabelThumb{}, nil, src, ThumbInfo{game: gameHS, name: "Alice"}); rErr != nil {
+		t.Error(rErr)
+	}
+}
+
+func TestTemplateThumbSize(t *testing.T) {
+	template := TemplateThumb{template: image.NewRGBA(image.Rect(0, 0, 1000, 300))}
+	for _, size := range []image.Point{{}, {300, 420}} {
+		b, err := template.Render(ThumbInfo{game: gameAIS, name: "さくら", size: size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := thumbSize(ThumbInfo{size: size})
+		if got := testPngSize(t, b); got != want {
+			t.Errorf("card size %v: template rendered at %v, want %v", size, got, want)
+		}
+	}
+}
+
+func TestThumbnailSceneShotSize(t *testing.T) {
+	dir := t.TempDir()
+
+	// a wide image is cropped, not stretched, to the screenshot shape
+	img, iErr := createPng(1000, 300, 1)
+	if iErr != nil {
+		t.Fatal(iErr)
+	}
+	imgPath := filepath.Join(dir, "image.png")
+	if wErr := ioutil.WriteFile(imgPath, img, 0644); wErr != nil {
+		t.Fatal(wErr)
+	}
+
+	// the new screenshot keeps the size of the old one
+	payload := append([]byte{0x10, 0, 0, 0}, neoV2Mark...)
+	for _, size := range []image.Point{{640, 480}, {1920, 1080}, sceneShotSize} {
+		shot, err := createPng(size.X, size.Y, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scenePath := filepath.Join(dir, "scene.png")
+		if wErr := ioutil.WriteFile(scenePath, append(shot, payload...), 0644); wErr != nil {
+			t.Fatal(wErr)
+		}
+
+		if tErr := thumbnailCard(scenePath, ExtractOptions{thumbImage: imgPath, verify: true}); tErr != nil {
+			t.Fatal(tErr)
+		}
+		b, rErr := ioutil.ReadFile(scenePath)
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		if got := testPngSize(t, b); got != size {
+			t.Errorf("wrote a %v screenshot, want %v", got, size)
+		}
+		if !bytes.HasSuffix(b, payload) {
+			t.Errorf("%v: scene data changed", size)
+		}
+	}
+}
+
+func TestThumbnailCardTrailing(t *testing.T) {
+	img, err := createPng(300, 420, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgPath := filepath.Join(t.TempDir(), "image.png")
+	if wErr := ioutil.WriteFile(imgPath, img, 0644); wErr != nil {
+		t.Fatal(wErr)
+	}
+
+	// plugins append their own data after the chara block
+	trailing := []byte("plugin data after the chara")
+	cards := testWriteCards(t)
+	for _, game := range []string{gameKK, gameAIS} {
+		card := append(append([]byte{}, cards[game]...), trailing...)
+		filePath := testCardFile(t, t.TempDir(), card)
+		pngSize := getPngSize(bbio.NewReaderBytes(card))
+
+		if tErr := thumbnailCard(filePath, ExtractOptions{thumbImage: imgPath, verify: true}); tErr != nil {
+			t.Fatalf("%s: %v", game, tErr)
+		}
+		b, rErr := ioutil.ReadFile(filePath)
+		if rErr != nil {
+			t.Fatal(rErr)
+		}
+		size := getPngSize(bbio.NewReaderBytes(b))
+		if !bytes.Equal(b[size:], card[pngSize:]) {
+			t.Errorf("%s: bytes after the png changed", game)
+		}
+		if got := testPngSize(t, b); got != testPngSize(t, card) {
+			t.Errorf("%s: thumbnail %v, want the card size", game, got)
+		}
+		if _, lErr := loadCard(filePath, true); lErr != nil {
+			t.Errorf("%s: card does not load: %v", game, lErr)
+		}
+	}
+}
+
+func TestSceneThumbLabel(t *testing.T) {
+	shot, err := createPng(sceneShotSize.X, sceneShotSize.Y, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, tErr := newThumbnailer(ExtractOptions{thumbMode: thumbScene}, "お風呂のシーン", shot)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	scene, ok := thumb.(SceneThumb)
+	if !ok || scene.shot == nil {
+		t.Fatalf("got %T without the screenshot", thumb)
+	}
+
+	lines := scene.lines(ThumbInfo{game: gameAIS, name: "さくら"})
+	if len(lines) != 3 || lines[0] != "さくら" || lines[2] != "お風呂のシーン" {
+		t.Errorf("label lines %q", lines)
+	}
+
+	b, rErr := scene.Render(ThumbInfo{game: gameAIS, sex: 1, name: "さくら"})
+	if rErr != nil {
+		t.Fatal(rErr)
+	}
+	if got := testPngSize(t, b); got != cardThumbSize {
+		t.Errorf("scene chara thumbnail %v, want %v", got, cardThumbSize)
+	}
+}
+
+// testStdout returns what f prints
+func testStdout(t testing.TB, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- b
+	}()
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+func TestThumbImageWarnings(t *testing.T) {
+	info := ThumbInfo{game: gameKK, sex: 1, name: "Hana", face: []byte("not a png")}
+	want, err := LabelThumb{}.Render(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	out := testStdout(t, func() {
+		got, err = FaceThumb{fallback: LabelThumb{}}.Render(info)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("broken face did not use the fallback")
+	}
+	if !strings.Contains(out, "Face image of 'Hana' can not be used: png:") || strings.Contains(out, "<nil>") {
+		t.Errorf("warning %q", out)
+	}
+
+	out = testStdout(t, func() {
+		if decodeSceneShot([]byte("not a png")) != nil {
+			t.Error("broken screenshot decoded")
+		}
+	})
+	if !strings.Contains(out, "using label thumbnails: png:") || strings.Contains(out, "<nil>") {
+		t.Errorf("warning %q", out)
+	}
+}